@@ -3,37 +3,385 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"compress/flate"
+	"crypto/tls"
 	"encoding/binary"
+	"flag"
 	"fmt"
 	"github.com/gdamore/tcell/v2"
+	"github.com/klauspost/compress/zstd"
 	"github.com/lukaspj/go-masterserver/pkg/tcp"
+	"github.com/lukaspj/go-masterserver/pkg/tlsconfig"
+	"io"
 	"log"
 	"net"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rivo/tview"
 )
 
-func readString(buf *bytes.Buffer) (string, error) {
-	readByte, err := buf.ReadByte()
+// codec reads and writes frames with the parameters agreed with the server
+// in the handshake.
+type codec struct {
+	version   byte
+	byteOrder interface {
+		binary.ByteOrder
+		binary.AppendByteOrder
+	}
+	stringLength byte
+	compression  byte
+}
+
+func (c codec) readString(buf *bytes.Buffer) (string, error) {
+	var length uint64
+	var err error
+	switch c.stringLength {
+	case tcp.STRING_LENGTH_VARINT:
+		length, err = binary.ReadUvarint(buf)
+	case tcp.STRING_LENGTH_32:
+		var l uint32
+		err = binary.Read(buf, c.byteOrder, &l)
+		length = uint64(l)
+	case tcp.STRING_LENGTH_16:
+		var l uint16
+		err = binary.Read(buf, c.byteOrder, &l)
+		length = uint64(l)
+	default:
+		var l byte
+		l, err = buf.ReadByte()
+		length = uint64(l)
+	}
+	if err != nil {
+		return "", err
+	}
+	if length > uint64(buf.Len()) {
+		return "", fmt.Errorf("string of %d bytes cut short", length)
+	}
+
+	return string(buf.Next(int(length))), nil
+}
+
+func (c codec) appendString(frame []byte, str string) []byte {
+	switch c.stringLength {
+	case tcp.STRING_LENGTH_VARINT:
+		frame = binary.AppendUvarint(frame, uint64(len(str)))
+	case tcp.STRING_LENGTH_32:
+		frame = c.byteOrder.AppendUint32(frame, uint32(len(str)))
+	case tcp.STRING_LENGTH_16:
+		frame = c.byteOrder.AppendUint16(frame, uint16(len(str)))
+	default:
+		frame = append(frame, byte(len(str)))
+	}
+	return append(frame, str...)
+}
+
+// frame wraps the body of a frame, prefixing it with its length from
+// version 2 of the protocol and ending it with a tab before.
+func (c codec) frame(body []byte) []byte {
+	if c.version < 2 {
+		return append(body, '\t')
+	}
+	return append(c.byteOrder.AppendUint32(nil, uint32(len(body))), body...)
+}
+
+// readFrame reads the body of the next frame.
+func (c codec) readFrame(reader *bufio.Reader) ([]byte, error) {
+	if c.version < 2 {
+		frame, err := reader.ReadBytes('\t')
+		if err != nil {
+			return nil, err
+		}
+		return frame[:len(frame)-1], nil
+	}
+
+	var prefix [4]byte
+	_, err := io.ReadFull(reader, prefix[:])
+	if err != nil {
+		return nil, err
+	}
+	length := c.byteOrder.Uint32(prefix[:])
+	body := make([]byte, length&^(1<<31))
+	_, err = io.ReadFull(reader, body)
+	if err != nil || length&(1<<31) == 0 {
+		return body, err
+	}
+
+	// The top bit of the length marks compressed frames.
+	switch c.compression {
+	case tcp.COMPRESSION_ZSTD:
+		decoder, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer decoder.Close()
+		return decoder.DecodeAll(body, nil)
+	case tcp.COMPRESSION_DEFLATE:
+		return io.ReadAll(flate.NewReader(bytes.NewReader(body)))
+	default:
+		return nil, fmt.Errorf("compressed frame without an agreed compression")
+	}
+}
+
+// handshake offers the server every byte order, string length and
+// compression the codec supports and returns the codec for the parameters
+// the server chose.
+func handshake(conn net.Conn, reader *bufio.Reader, gameId string) (codec, error) {
+	c := codec{version: 1, byteOrder: binary.LittleEndian, stringLength: tcp.STRING_LENGTH_8}
+
+	body := []byte{byte(tcp.HELLO)}
+	body = binary.LittleEndian.AppendUint32(body, 1)
+	body = append(body, tcp.ProtocolVersion)
+	body = c.appendString(body, gameId)
+	body = append(body,
+		tcp.BYTE_ORDER_LITTLE_ENDIAN|tcp.BYTE_ORDER_BIG_ENDIAN,
+		tcp.STRING_LENGTH_8|tcp.STRING_LENGTH_16|tcp.STRING_LENGTH_32|tcp.STRING_LENGTH_VARINT,
+		tcp.COMPRESSION_DEFLATE|tcp.COMPRESSION_ZSTD,
+	)
+	_, err := conn.Write(c.frame(body))
+	if err != nil {
+		return codec{}, err
+	}
+
+	message, err := c.readFrame(reader)
+	if err != nil {
+		return codec{}, err
+	}
+	if len(message) > 6 && tcp.TCP_RESPONSE(message[0]) == tcp.SERVER_ERROR {
+		description, _ := c.readString(bytes.NewBuffer(message[6:]))
+		return codec{}, fmt.Errorf("handshake refused: %s", description)
+	}
+	if len(message) != 9 || tcp.TCP_RESPONSE(message[0]) != tcp.WELCOME {
+		return codec{}, fmt.Errorf("expected WELCOME, got %v", message)
+	}
+
+	c.version = message[5]
+	if message[6] == tcp.BYTE_ORDER_BIG_ENDIAN {
+		c.byteOrder = binary.BigEndian
+	}
+	c.stringLength = message[7]
+	c.compression = message[8]
+	return c, nil
+}
+
+// readAddressing decodes the sender and recipients of a message and formats
+// them as "from alice to bob, carol " for display.
+func (c codec) readAddressing(buf *bytes.Buffer) (string, error) {
+	sender, err := c.readString(buf)
+	if err != nil {
+		return "", err
+	}
+	count, err := buf.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	recipients := make([]string, count)
+	for i := range recipients {
+		recipients[i], err = c.readString(buf)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	addressing := ""
+	if sender != "" {
+		addressing += "from " + sender + " "
+	}
+	if len(recipients) > 0 {
+		addressing += "to " + strings.Join(recipients, ", ") + " "
+	}
+	return addressing, nil
+}
+
+// readMessage decodes a lobby message as written by tcp.Subscriber and
+// formats it for display.
+func (c codec) readMessage(buf *bytes.Buffer) (string, error) {
+	byteOrder := c.byteOrder
+	msgType, err := c.readString(buf)
 	if err != nil {
 		return "", err
 	}
+	var seq uint64
+	err = binary.Read(buf, byteOrder, &seq)
+	if err != nil {
+		return "", err
+	}
+
+	switch msgType {
+	case "text":
+		t := time.Time{}
+		err = t.UnmarshalBinary(buf.Next(15))
+		if err != nil {
+			return "", err
+		}
+		msg, err := c.readString(buf)
+		if err != nil {
+			return "", err
+		}
+		addressing, err := c.readAddressing(buf)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("<text> #%d %s %s- %s", seq, t, addressing, msg), nil
+	case "meta":
+		metaId, err := c.readString(buf)
+		if err != nil {
+			return "", err
+		}
+		metaName, err := c.readString(buf)
+		if err != nil {
+			return "", err
+		}
+		var metaSubscribers int32
+		err = binary.Read(buf, byteOrder, &metaSubscribers)
+		if err != nil {
+			return "", err
+		}
+		var metaLastSeq uint64
+		err = binary.Read(buf, byteOrder, &metaLastSeq)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("<meta> %s, %s, %d, last #%d", metaId, metaName, metaSubscribers, metaLastSeq), nil
+	case "gap":
+		var from, to uint64
+		err = binary.Read(buf, byteOrder, &from)
+		if err != nil {
+			return "", err
+		}
+		err = binary.Read(buf, byteOrder, &to)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("<gap> missed #%d to #%d", from, to), nil
+	case "data":
+		subtype, err := c.readString(buf)
+		if err != nil {
+			return "", err
+		}
+		t := time.Time{}
+		err = t.UnmarshalBinary(buf.Next(15))
+		if err != nil {
+			return "", err
+		}
+		var length uint32
+		err = binary.Read(buf, byteOrder, &length)
+		if err != nil {
+			return "", err
+		}
+		payload := buf.Next(int(length))
+		addressing, err := c.readAddressing(buf)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("<data:%s> #%d %s %s- %q", subtype, seq, t, addressing, payload), nil
+	case "notice":
+		kind, err := c.readString(buf)
+		if err != nil {
+			return "", err
+		}
+		t := time.Time{}
+		err = t.UnmarshalBinary(buf.Next(15))
+		if err != nil {
+			return "", err
+		}
+		content, err := c.readString(buf)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("<notice:%s> #%d %s - %s", kind, seq, t, content), nil
+	case "membership":
+		event, err := c.readString(buf)
+		if err != nil {
+			return "", err
+		}
+		playerId, err := c.readString(buf)
+		if err != nil {
+			return "", err
+		}
+		t := time.Time{}
+		err = t.UnmarshalBinary(buf.Next(15))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("<membership:%s> #%d %s - %s", event, seq, t, playerId), nil
+	case "ready":
+		sender, err := c.readString(buf)
+		if err != nil {
+			return "", err
+		}
+		ready, err := buf.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		t := time.Time{}
+		err = t.UnmarshalBinary(buf.Next(15))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("<ready> #%d %s - %s ready: %t", seq, t, sender, ready != 0), nil
+	default:
+		return "", fmt.Errorf("unknown message type %s", msgType)
+	}
+}
 
-	strBuffer := make([]byte, readByte)
-	_, err = buf.Read(strBuffer)
-	return string(strBuffer), err
+// nextRequestId returns the id after previous, skipping ids containing the
+// frame delimiter and zero, which is reserved for frames nobody asked for.
+func nextRequestId(previous uint32) uint32 {
+	for {
+		previous++
+		if previous != 0 && !bytes.ContainsRune(binary.LittleEndian.AppendUint32(nil, previous), '\t') {
+			return previous
+		}
+	}
 }
 
 func main() {
-	conn, err := net.Dial("tcp", ":3001")
+	addr := flag.String("addr", ":3001", "address of the master server")
+	useTLS := flag.Bool("tls", false, "connect over TLS")
+	caFile := flag.String("tls-ca", "", "PEM file with the authorities to trust besides those of the system, such as a self-signed server certificate")
+	certFile := flag.String("tls-cert", "", "PEM certificate to identify as a trusted client with")
+	keyFile := flag.String("tls-key", "", "PEM private key of the client certificate")
+	serverName := flag.String("tls-server-name", "", "name to verify the server certificate against, the host of -addr if empty")
+	insecure := flag.Bool("tls-insecure", false, "accept any server certificate, for testing only")
+	gameId := flag.String("game-id", "cli", "game id to introduce the client with")
+	flag.Parse()
+
+	var conn net.Conn
+	var err error
+	if *useTLS {
+		clientTLS := tlsconfig.ClientConfig{
+			CAFile:             *caFile,
+			CertFile:           *certFile,
+			KeyFile:            *keyFile,
+			ServerName:         *serverName,
+			InsecureSkipVerify: *insecure,
+		}
+		config, err := clientTLS.Load()
+		if err != nil {
+			log.Fatal(err)
+		}
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: time.Second * 10}, "tcp", *addr, config)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		conn, err = net.Dial("tcp", *addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	reader := bufio.NewReader(conn)
+	c, err := handshake(conn, reader, *gameId)
 	if err != nil {
 		log.Fatal(err)
 	}
+	byteOrder := c.byteOrder
 
 	doneChan := make(chan error)
-	byteOrder := binary.LittleEndian
 
 	app := tview.NewApplication()
 	container := tview.NewFlex().SetDirection(tview.FlexRow)
@@ -52,6 +400,25 @@ func main() {
 
 	container.AddItem(textView, 0, 1, false)
 
+	// Requests are numbered so that responses and errors can be matched to
+	// the commands that caused them.
+	// The handshake used the first id.
+	requestId := uint32(1)
+	var requestMu sync.Mutex
+	request := func(command tcp.TCP_COMMAND, payload []byte) {
+		requestMu.Lock()
+		defer requestMu.Unlock()
+
+		requestId = nextRequestId(requestId)
+		frame := []byte{byte(command)}
+		frame = byteOrder.AppendUint32(frame, requestId)
+		frame = append(frame, payload...)
+		_, err := conn.Write(c.frame(frame))
+		if err != nil {
+			logPrintf("[error]: %+v\n", err)
+		}
+	}
+
 	inputField := tview.NewInputField().
 		SetLabel("Write Command ").
 		SetAutocompleteFunc(func(currentText string) (entries []string) {
@@ -64,15 +431,17 @@ func main() {
 				"create ",
 				"join ",
 				"send ",
+				"watch",
+				"history ",
+				"ping",
+				"data ",
+				"whisper ",
 			}
 		})
 	inputField.
 		SetDoneFunc(func(key tcell.Key) {
 			if strings.HasPrefix(inputField.GetText(), "list") {
-				_, err := conn.Write([]byte{byte(tcp.LIST_LOBBIES), '\t'})
-				if err != nil {
-					logPrintf("[error]: %+v", err)
-				}
+				request(tcp.LIST_LOBBIES, nil)
 			}
 			if strings.HasPrefix(inputField.GetText(), "create") {
 				name := strings.TrimSpace(inputField.GetText()[6:])
@@ -80,37 +449,15 @@ func main() {
 					logPrintf("Invalid Input to create")
 					return
 				}
-				_, err := conn.Write([]byte{byte(tcp.CREATE_LOBBY)})
-				if err != nil {
-					logPrintf("[error]: %+v", err)
-				}
-				_, err = conn.Write([]byte(name))
-				if err != nil {
-					logPrintf("[error]: %+v", err)
-				}
-				_, err = conn.Write([]byte{'\t'})
-				if err != nil {
-					logPrintf("[error]: %+v", err)
-				}
+				request(tcp.CREATE_LOBBY, []byte(name))
 			}
 			if strings.HasPrefix(inputField.GetText(), "join") {
 				id := strings.TrimSpace(inputField.GetText()[4:])
-				if strings.ContainsRune(id, ' ') {
-					logPrintf("Invalid Input to create")
+				if len(strings.Fields(id)) > 2 {
+					logPrintf("Invalid Input to join\n")
 					return
 				}
-				_, err := conn.Write([]byte{byte(tcp.JOIN_LOBBY)})
-				if err != nil {
-					logPrintf("[error]: %+v", err)
-				}
-				_, err = conn.Write([]byte(id))
-				if err != nil {
-					logPrintf("[error]: %+v", err)
-				}
-				_, err = conn.Write([]byte{'\t'})
-				if err != nil {
-					logPrintf("[error]: %+v", err)
-				}
+				request(tcp.JOIN_LOBBY, []byte(id))
 			}
 			if strings.HasPrefix(inputField.GetText(), "send") {
 				message := strings.TrimSpace(inputField.GetText()[4:])
@@ -119,18 +466,51 @@ func main() {
 					return
 				}
 
-				_, err := conn.Write([]byte{byte(tcp.SEND_MESSAGE)})
-				if err != nil {
-					logPrintf("[error]: %+v\n", err)
+				request(tcp.SEND_MESSAGE, []byte(message))
+			}
+			if strings.HasPrefix(inputField.GetText(), "history") {
+				args := strings.TrimSpace(inputField.GetText()[7:])
+				if len(strings.Fields(args)) == 0 || len(strings.Fields(args)) > 3 {
+					logPrintf("Invalid Input to history\n")
+					return
 				}
-				_, err = conn.Write([]byte(message))
-				if err != nil {
-					logPrintf("[error]: %+v\n", err)
+				request(tcp.FETCH_HISTORY, []byte(args))
+			}
+			if strings.HasPrefix(inputField.GetText(), "watch") {
+				request(tcp.WATCH_LOBBIES, nil)
+			}
+			if strings.HasPrefix(inputField.GetText(), "whisper") {
+				args := strings.SplitN(strings.TrimSpace(inputField.GetText()[7:]), " ", 2)
+				if len(args) != 2 {
+					logPrintf("Invalid Input to whisper, expected recipients and message\n")
+					return
 				}
-				_, err = conn.Write([]byte{'\t'})
-				if err != nil {
-					logPrintf("[error]: %+v\n", err)
+				recipients := strings.Split(args[0], ",")
+				if len(recipients) > 255 {
+					logPrintf("Invalid Input to whisper, too many recipients\n")
+					return
 				}
+				frame := []byte{0, byte(len(recipients))}
+				for _, recipient := range recipients {
+					frame = c.appendString(frame, recipient)
+				}
+				frame = append(frame, args[1]...)
+				request(tcp.SEND_MESSAGE, frame)
+			}
+			if strings.HasPrefix(inputField.GetText(), "data") {
+				args := strings.SplitN(strings.TrimSpace(inputField.GetText()[4:]), " ", 2)
+				if len(args) != 2 {
+					logPrintf("Invalid Input to data, expected subtype and payload\n")
+					return
+				}
+				frame := c.appendString(nil, args[0])
+				frame = append(frame, args[1]...)
+				request(tcp.SEND_DATA, frame)
+			}
+			if strings.HasPrefix(inputField.GetText(), "ping") {
+				// The payload is echoed back, so the send time travels with it.
+				sent := strconv.FormatInt(time.Now().UnixNano(), 10)
+				request(tcp.PING, []byte(sent))
 			}
 			inputField.SetText("")
 		})
@@ -138,57 +518,55 @@ func main() {
 		SetOptions([]string{"list"}, nil)
 	dropdown.SetSelectedFunc(func(text string, index int) {
 		if text == "list" {
-			_, err := conn.Write([]byte{byte(tcp.LIST_LOBBIES), '\t'})
-			if err != nil {
-				log.Printf("[error]: %+v", err)
-			}
+			request(tcp.LIST_LOBBIES, nil)
 		}
 	})
 	container.AddItem(inputField, 1, 1, true)
 
 	inputContainer := tview.NewFlex()
 	listLobbiesBtn := tview.NewButton("List Lobbies").SetSelectedFunc(func() {
-		_, err := conn.Write([]byte{byte(tcp.LIST_LOBBIES), '\t'})
-		if err != nil {
-			log.Printf("[error]: %+v", err)
-		}
+		request(tcp.LIST_LOBBIES, nil)
 	})
 	inputContainer.AddItem(listLobbiesBtn, 0, 1, true)
 	createLobbyBtn := tview.NewButton("Create Lobby").SetSelectedFunc(func() {
-		_, err := conn.Write([]byte{byte(tcp.LIST_LOBBIES), '\t'})
-		if err != nil {
-			log.Printf("[error]: %+v", err)
-		}
+		request(tcp.LIST_LOBBIES, nil)
 	})
 	inputContainer.AddItem(listLobbiesBtn, 0, 1, true)
 	inputContainer.AddItem(createLobbyBtn, 0, 1, false)
 
 	go func(doneChan chan<- error) {
-		reader := bufio.NewReader(conn)
 		for {
-			message, err := reader.ReadBytes('\t')
+			message, err := c.readFrame(reader)
 			if err != nil {
 				logPrintf("Error! %+v\n", err)
 				doneChan <- err
 				return
 			}
 
-			if tcp.TCP_RESPONSE(message[0]) == tcp.LOBBY_LIST {
-				logPrintf("->: LOBBY LIST\n")
-				if len(message) == 2 {
+			if len(message) < 5 {
+				logPrintf("Error! frame too short: %v\n", message)
+				continue
+			}
+			response := tcp.TCP_RESPONSE(message[0])
+			id := byteOrder.Uint32(message[1:5])
+			body := message[5:]
+
+			if response == tcp.LOBBY_LIST {
+				logPrintf("->: LOBBY LIST #%d\n", id)
+				if len(body) == 0 {
 					logPrintf("-->: NO LOBBIES\n")
 					continue
 				}
 
-				messageReader := bytes.NewBuffer(message[:len(message)-1])
+				messageReader := bytes.NewBuffer(body)
 				for messageReader.Len() > 0 {
 
-					id, err := readString(messageReader)
+					id, err := c.readString(messageReader)
 					if err != nil {
 						logPrintf("-->: %+v\n", err)
 						break
 					}
-					name, err := readString(messageReader)
+					name, err := c.readString(messageReader)
 					if err != nil {
 						logPrintf("-->: %+v\n", err)
 						break
@@ -208,59 +586,111 @@ func main() {
 					}
 					logPrintf("-->: ID: %s, Name: %s, Ts: %s, Subscribers: %d\n", id, name, t, subscribers)
 				}
-			} else if tcp.TCP_RESPONSE(message[0]) == tcp.LOBBY_CREATED {
-				messageReader := bytes.NewBuffer(message)
-				logPrintf("-->: MESSAGE SIZE: %d\n", messageReader.Len())
-				id, err := readString(messageReader)
+			} else if response == tcp.LOBBY_CREATED {
+				messageReader := bytes.NewBuffer(body)
+				lobbyId, err := c.readString(messageReader)
 				if err != nil {
 					logPrintf("-->: %+v\n", err)
 					break
 				}
-				logPrintf("-->: ID: %s\n", id)
-				messageReader.Next(1)
-			} else if tcp.TCP_RESPONSE(message[0]) == tcp.LOBBY_MESSAGE {
-				messageReader := bytes.NewBuffer(message[1:])
-				msgType, err := readString(messageReader)
+				logPrintf("->: LOBBY CREATED #%d\n", id)
+				logPrintf("-->: ID: %s\n", lobbyId)
+			} else if response == tcp.LOBBY_MESSAGE {
+				messageReader := bytes.NewBuffer(body)
+				msg, err := c.readMessage(messageReader)
 				if err != nil {
 					logPrintf("-->: %+v\n", err)
 					break
 				}
-				msgType = strings.TrimSpace(msgType[:len(msgType)-1])
-				if msgType == "text" {
-					t := time.Time{}
-					err = t.UnmarshalBinary(messageReader.Next(15))
-					if err != nil {
-						logPrintf("-->: %+v\n", err)
-						break
-					}
-					msg, err := readString(messageReader)
-					if err != nil {
-						logPrintf("-->: %+v\n", err)
-						break
-					}
-					logPrintf("->: <text> %s - %s\n", t, msg)
-				} else if msgType == "meta" {
-					metaId, err := readString(messageReader)
-					if err != nil {
-						logPrintf("-->: %+v\n", err)
-						break
-					}
-					metaName, err := readString(messageReader)
-					if err != nil {
-						logPrintf("-->: %+v\n", err)
-						break
-					}
-					var metaSubscribers int32
-					err = binary.Read(messageReader, byteOrder, &metaSubscribers)
+				logPrintf("->: %s\n", msg)
+			} else if response == tcp.HISTORY {
+				messageReader := bytes.NewBuffer(body)
+				lobbyId, err := c.readString(messageReader)
+				if err != nil {
+					logPrintf("-->: %+v\n", err)
+					break
+				}
+				var count uint32
+				err = binary.Read(messageReader, byteOrder, &count)
+				if err != nil {
+					logPrintf("-->: %+v\n", err)
+					break
+				}
+				logPrintf("->: HISTORY #%d %s (%d messages)\n", id, lobbyId, count)
+				for i := uint32(0); i < count; i++ {
+					msg, err := c.readMessage(messageReader)
 					if err != nil {
 						logPrintf("-->: %+v\n", err)
 						break
 					}
-					logPrintf("->: <meta> %s, %s, %d\n", metaId, metaName, metaSubscribers)
-				} else {
-					logPrintf("-->: unknown message type %s\n", msgType)
+					logPrintf("-->: %s\n", msg)
+				}
+			} else if response == tcp.LOBBY_EVENT {
+				messageReader := bytes.NewBuffer(body)
+				eventType, err := c.readString(messageReader)
+				if err != nil {
+					logPrintf("-->: %+v\n", err)
+					break
+				}
+				lobbyId, err := c.readString(messageReader)
+				if err != nil {
+					logPrintf("-->: %+v\n", err)
+					break
+				}
+				name, err := c.readString(messageReader)
+				if err != nil {
+					logPrintf("-->: %+v\n", err)
+					break
+				}
+				t := time.Time{}
+				err = t.UnmarshalBinary(messageReader.Next(15))
+				if err != nil {
+					logPrintf("-->: %+v\n", err)
+					break
+				}
+				var subscribers uint32
+				err = binary.Read(messageReader, byteOrder, &subscribers)
+				if err != nil {
+					logPrintf("-->: %+v\n", err)
+					break
+				}
+				logPrintf("->: <%s> ID: %s, Name: %s, Ts: %s, Subscribers: %d\n", eventType, lobbyId, name, t, subscribers)
+			} else if response == tcp.SERVER_ERROR {
+				messageReader := bytes.NewBuffer(body)
+				command, err := messageReader.ReadByte()
+				if err != nil {
+					logPrintf("-->: %+v\n", err)
+					break
+				}
+				description, err := c.readString(messageReader)
+				if err != nil {
+					logPrintf("-->: %+v\n", err)
+					break
+				}
+				logPrintf("[error]: %s #%d failed: %s\n", tcp.TCP_COMMAND(command), id, description)
+			} else if response == tcp.PONG {
+				messageReader := bytes.NewBuffer(body)
+				serverTime := time.Time{}
+				err = serverTime.UnmarshalBinary(messageReader.Next(15))
+				if err != nil {
+					logPrintf("-->: %+v\n", err)
+					break
+				}
+				sent, err := strconv.ParseInt(messageReader.String(), 10, 64)
+				if err != nil {
+					logPrintf("-->: %+v\n", err)
+					break
+				}
+				logPrintf("->: PONG #%d server time: %s, round trip: %s\n", id, serverTime, time.Since(time.Unix(0, sent)))
+			} else if response == tcp.HEARTBEAT {
+				// Answer quietly so the server does not consider us idle.
+				request(tcp.HEARTBEAT_ACK, nil)
+			} else if response == tcp.ACK {
+				if len(body) != 1 {
+					logPrintf("-->: invalid ACK\n")
+					continue
 				}
-				messageReader.Next(1)
+				logPrintf("->: %s #%d OK\n", tcp.TCP_COMMAND(body[0]), id)
 			} else {
 				logPrintf("unknown command: %d\n", message[0])
 			}
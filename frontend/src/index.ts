@@ -12,7 +12,7 @@ interface LobbyInput {
 }
 
 async function ListLobbies() {
-    const resp = await fetch("http://localhost:3000/lobby", {
+    const resp = await fetch("http://localhost:3000/v1/lobby", {
         method: "GET",
     })
     if (resp.status !== 200) {
@@ -21,7 +21,7 @@ async function ListLobbies() {
     }
 
     let _lobbies = await resp.json() as Array<Lobby>;
-    _lobbies.sort((l1, l2) => l1.Id.localeCompare(l2.Id));
+    _lobbies.sort((l1, l2) => l1.id.localeCompare(l2.id));
     lobbies.splice(0, lobbies.length);
     _lobbies.forEach((l) => lobbies.push(l));
 }
@@ -44,4 +44,12 @@ window["lobbies"] = Alpine.reactive(Array<Lobby>());
 window["createLobby"] = createLobby;
 window["deleteLobby"] = deleteLobby;
 
-setTimeout(ListLobbies);
+// watchLobbies keeps the lobby list current from the server's change feed.
+function watchLobbies() {
+    const watchConnection = new WebSocket("ws://localhost:3000/v1/lobby/watch");
+    watchConnection.addEventListener("open", () => ListLobbies());
+    watchConnection.addEventListener("message", () => ListLobbies());
+    watchConnection.addEventListener("close", () => setTimeout(watchLobbies, 1000));
+}
+
+setTimeout(watchLobbies);
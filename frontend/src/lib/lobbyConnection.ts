@@ -1,10 +1,19 @@
 import './models';
-import {LobbyMessage, LogMessage} from "./models";
+import {Lobby, LobbyMessage, LogMessage, SocketAck, SocketCommand} from "./models";
 
 export class LobbyConnection {
     public id: string;
     public name: string;
     private websocketConnection: WebSocket = null;
+    // lastSeq is the sequence number of the last message received, used to
+    // resume after a reconnect without receiving messages twice.
+    private lastSeq: number = 0;
+    // pending holds the commands sent over the websocket that have not been
+    // acknowledged yet, by id.
+    private pending = new Map<string, (ack: SocketAck) => void>();
+    private nextCommandId: number = 1;
+    // left is set once we leave the lobby, so that we do not reconnect.
+    private left: boolean = false;
     public logMessages: Array<LogMessage> = new Array<LogMessage>();
 
     constructor(id = '', name = '') {
@@ -13,42 +22,49 @@ export class LobbyConnection {
     }
 
     public async create() {
-        const resp = await fetch("http://localhost:3000/lobby", {
+        const resp = await fetch("http://localhost:3000/v1/lobby", {
             method: "POST",
             body: JSON.stringify({name: this.name}),
             headers: new Headers({
                 "Content-Type": "application/json"
             })
         })
-        if (resp.status !== 200) {
+        if (resp.status !== 201) {
             this.appendLog(`Create lobby failed: Unexpected HTTP Status ${resp.status} ${resp.statusText}`, true);
             return;
         }
-        this.id = await resp.text();
+        const lobby = await resp.json() as Lobby;
+        this.id = lobby.id;
     }
 
     public async delete() {
-        const resp = await fetch(`http://localhost:3000/lobby/${this.id}`, {
+        const resp = await fetch(`http://localhost:3000/v1/lobby/${this.id}`, {
             method: "DELETE",
         })
-        if (resp.status !== 200) {
+        if (resp.status !== 204) {
             this.appendLog(`Delete lobby failed: Unexpected HTTP Status ${resp.status} ${resp.statusText}`, true);
             return;
         }
-        this.id = await resp.text();
+        this.id = '';
     }
 
     public async join() {
         if (this.websocketConnection !== null) {
             this.websocketConnection.close();
         }
-        this.websocketConnection = new WebSocket(`ws://localhost:3000/lobby/${this.id}`)
+        this.left = false;
+        this.websocketConnection = new WebSocket(`ws://localhost:3000/v1/lobby/${this.id}?since=${this.lastSeq}`)
 
         this.websocketConnection.addEventListener("close", ev => {
             this.appendLog(`WebSocket Disconnected code: ${ev.code}, reason: ${ev.reason}`, true)
-            if (ev.code !== 1001) {
+            for (const [id, callback] of this.pending) {
+                callback({type: "ack", id, command: "", ok: false, error: "disconnected"});
+            }
+            this.pending.clear();
+            // Codes from 4000 up mean an operator removed us, so stay away.
+            if (!this.left && ev.code !== 1001 && ev.code < 4000) {
                 this.appendLog("Reconnecting in 1s", true)
-                setTimeout(this.join, 1000, this.id)
+                setTimeout(() => this.join(), 1000)
             }
             this.appendLog("websocket disconnected", true)
         });
@@ -64,17 +80,48 @@ export class LobbyConnection {
                 return
             }
 
-            let message: LobbyMessage = JSON.parse(ev.data);
+            let message: LobbyMessage | SocketAck = JSON.parse(ev.data);
+            if (message.type === "ack") {
+                this.acknowledge(message);
+                return;
+            }
+
+            if (message.seq !== 0) {
+                if (message.seq <= this.lastSeq) {
+                    return;
+                }
+                this.lastSeq = message.seq;
+            }
 
             switch (message.type) {
                 case "text":
                     console.log("text message:", message);
-                    this.appendLog(message.text.content, false, new Date(message.text.created));
+                    this.appendLog(this.attribute(message, message.text.content), false, new Date(message.text.created));
                     break;
                 case "meta":
                     console.log("meta message:", message);
                     this.name = message.meta.name;
                     this.id = message.meta.id;
+                    if (message.meta.lastSeq < this.lastSeq) {
+                        // The server has started over, so our position is meaningless.
+                        this.lastSeq = 0;
+                    }
+                    break;
+                case "gap":
+                    this.appendLog(`Missed messages ${message.gap.from} to ${message.gap.to}`, true);
+                    break;
+                case "data":
+                    console.log("data message:", message);
+                    this.appendLog(`[${message.data.subtype}] ${JSON.stringify(message.data.payload ?? message.data.binary)}`, false, new Date(message.data.created));
+                    break;
+                case "ready":
+                    this.appendLog(`${message.sender} is ${message.ready.ready ? "ready" : "not ready"}`, false, new Date(message.ready.created));
+                    break;
+                case "membership":
+                    this.appendLog(`${message.membership.playerId} ${message.membership.event.replace("_", " ")}`, false, new Date(message.membership.created));
+                    break;
+                case "notice":
+                    this.appendLog(`[${message.notice.kind}] ${message.notice.content}`, message.notice.kind !== "announcement" && message.notice.kind !== "direct", new Date(message.notice.created));
                     break;
                 default:
                     console.error('unhandled message type', message);
@@ -83,6 +130,73 @@ export class LobbyConnection {
         this.appendLog(`Joined ${this.id}`);
     }
 
+    // send publishes a text message to the lobby, or whispers it to the
+    // recipients.
+    public async send(content: string, recipients?: string[]) {
+        await this.command({command: "send", content, recipients});
+    }
+
+    // toggleReady flips whether we are ready and reports the new state.
+    public async toggleReady(): Promise<boolean> {
+        const ack = await this.command({command: "ready"});
+        return ack.ready ?? false;
+    }
+
+    public async leave() {
+        this.left = true;
+        await this.command({command: "leave"});
+    }
+
+    // ping reports the round trip time to the server in milliseconds.
+    public async ping(): Promise<number> {
+        const start = performance.now();
+        await this.command({command: "ping"});
+        return performance.now() - start;
+    }
+
+    // command sends a command over the websocket and resolves with its
+    // acknowledgement, or rejects if the server refused it.
+    private command(command: Omit<SocketCommand, "id">): Promise<SocketAck> {
+        const id = `${this.nextCommandId++}`;
+        return new Promise((resolve, reject) => {
+            if (this.websocketConnection === null || this.websocketConnection.readyState !== WebSocket.OPEN) {
+                reject(new Error("not connected"));
+                return;
+            }
+            this.pending.set(id, ack => {
+                if (ack.ok) {
+                    resolve(ack);
+                } else {
+                    this.appendLog(`${ack.command} failed: ${ack.error}`, true);
+                    reject(new Error(ack.error));
+                }
+            });
+            this.websocketConnection.send(JSON.stringify({id, ...command}));
+        });
+    }
+
+    private acknowledge(ack: SocketAck) {
+        const callback = this.pending.get(ack.id);
+        if (callback === undefined) {
+            console.error("unexpected ack", ack);
+            return;
+        }
+        this.pending.delete(ack.id);
+        callback(ack);
+    }
+
+    // attribute prefixes text with the sender of the message and, for
+    // whispers, the players it was sent to.
+    private attribute(message: LobbyMessage, text: string): string {
+        if (message.recipients?.length) {
+            return `${message.sender ?? "?"} -> ${message.recipients.join(", ")}: ${text}`;
+        }
+        if (message.sender) {
+            return `${message.sender}: ${text}`;
+        }
+        return text;
+    }
+
     // appendLog appends the passed text to messageLog.
     private appendLog(text: string, error?: boolean, time: Date = new Date()) {
         let msg = new LogMessage();
@@ -1,6 +1,8 @@
 export interface Lobby {
-    Id: string;
-    Name: string;
+    id: string;
+    name: string;
+    created: string;
+    subscribers: number;
 }
 
 export class LogMessage {
@@ -18,10 +20,72 @@ export class LobbyMeta {
     public name: string;
     public id: string;
     public subscribers: number;
+    public lastSeq: number;
+}
+
+export class LobbyGap {
+    public from: number;
+    public to: number;
+}
+
+export class LobbyData {
+    public subtype: string;
+    // payload holds JSON payloads as is, binary holds any other payload
+    // base64 encoded.
+    public payload?: any;
+    public binary?: string;
+    public created: string;
+}
+
+export class LobbyNotice {
+    public kind: "announcement" | "direct" | "lobby_closed" | "kicked" | "disconnected";
+    public content: string;
+    public created: string;
+}
+
+export class LobbyReady {
+    public ready: boolean;
+    public created: string;
+}
+
+export class LobbyMembership {
+    public event: "joined" | "left" | "timed_out";
+    public playerId: string;
+    public created: string;
 }
 
 export class LobbyMessage {
-    public type: "text" | "meta";
+    public seq: number;
+    public type: "text" | "meta" | "gap" | "data" | "notice" | "ready" | "membership";
     public text: LobbyText;
     public meta: LobbyMeta;
-}
\ No newline at end of file
+    public gap: LobbyGap;
+    public data: LobbyData;
+    public notice: LobbyNotice;
+    public ready: LobbyReady;
+    public membership: LobbyMembership;
+    // sender is the player who published the message, recipients are the
+    // players it was whispered to.
+    public sender?: string;
+    public recipients?: string[];
+}
+export interface SocketCommand {
+    id: string;
+    command: "send" | "ready" | "leave" | "ping";
+    content?: string;
+    subtype?: string;
+    payload?: any;
+    recipients?: string[];
+    ready?: boolean;
+}
+
+export class SocketAck {
+    public type: "ack";
+    public id: string;
+    public command: string;
+    public ok: boolean;
+    public error?: string;
+    public ready?: boolean;
+    public time?: string;
+    public payload?: any;
+}
@@ -29,15 +29,21 @@ publishForm.onsubmit = async ev => {
     messageInput.value = ""
 
     try {
-        const resp = await fetch(`http://localhost:3000/lobby/${lobbyConnection.id}`, {
-            method: "POST",
-            body: msg,
-        })
-        if (resp.status !== 202) {
-            throw new Error(`Unexpected HTTP Status ${resp.status} ${resp.statusText}`)
-        }
+        await lobbyConnection.send(msg)
     } catch (err) {
-        //appendLog(`Publish failed: ${err.message}`, true)
+        console.error("publish failed", err)
+    }
+}
+
+const readyButton = document.getElementById("tmp-ready-button") as HTMLButtonElement;
+
+// onclick toggles whether the user is ready.
+readyButton.onclick = async () => {
+    try {
+        const ready = await lobbyConnection.toggleReady()
+        readyButton.textContent = ready ? "Not ready" : "Ready"
+    } catch (err) {
+        console.error("ready failed", err)
     }
 }
 
@@ -2,31 +2,312 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"github.com/lukaspj/go-masterserver/pkg/broker"
+	"github.com/lukaspj/go-masterserver/pkg/cluster"
+	"github.com/lukaspj/go-masterserver/pkg/grpcserver"
+	"github.com/lukaspj/go-masterserver/pkg/health"
 	"github.com/lukaspj/go-masterserver/pkg/httpserver"
+	"github.com/lukaspj/go-masterserver/pkg/identity"
 	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"github.com/lukaspj/go-masterserver/pkg/logging"
+	"github.com/lukaspj/go-masterserver/pkg/metrics"
+	"github.com/lukaspj/go-masterserver/pkg/moderation"
 	"github.com/lukaspj/go-masterserver/pkg/tcp"
+	"github.com/lukaspj/go-masterserver/pkg/tlsconfig"
+	"github.com/lukaspj/go-masterserver/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"log"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"nhooyr.io/websocket"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 )
 
 func main() {
-	service := lobby.NewService()
+	httpAddr := flag.String("http-addr", ":3000", "address to serve the HTTP API on")
+	tcpAddr := flag.String("tcp-addr", ":3001", "address to serve the TCP protocol on")
+	grpcAddr := flag.String("grpc-addr", ":3002", "address to serve the gRPC API on")
+	metricsAddr := flag.String("metrics-addr", "127.0.0.1:3003", "internal address to serve Prometheus metrics on, which must be reachable by the scraper but not the public, disabled if empty")
+	metricsLobbyLabels := flag.Bool("metrics-lobby-labels", false, "label message metrics with the id of their lobby, which makes a series per lobby")
+	historyDir := flag.String("history-dir", "", "directory to persist lobbies and their message history in, kept in memory if empty")
+	historyMaxCount := flag.Int("history-max-count", lobby.DefaultRetentionPolicy.MaxCount, "maximum number of messages kept per lobby, 0 for unlimited")
+	historyMaxAge := flag.Duration("history-max-age", lobby.DefaultRetentionPolicy.MaxAge, "maximum age of messages kept per lobby, 0 for unlimited")
+	natsUrl := flag.String("nats-url", "", "NATS server with JetStream to share lobbies and their messages with other master servers through, local only if empty")
+	clusterAddr := flag.String("cluster-addr", "", "address to serve the internal cluster API on and advertise to peers, standalone if empty")
+	clusterPeers := flag.String("cluster-peers", "", "comma separated internal addresses of all master servers in the cluster")
+	clusterSecret := flag.String("cluster-secret", os.Getenv("MASTERSERVER_CLUSTER_SECRET"), "secret shared by all master servers in the cluster to authenticate to each other (defaults to $MASTERSERVER_CLUSTER_SECRET)")
+	logLevel := flag.String("log-level", "info", "minimum level of logs to write: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "format to write logs in: text or json")
+	trustedProxies := flag.String("trusted-proxies", "", "comma separated addresses or networks of the reverse proxies in front of the HTTP API, whose X-Forwarded-For and X-Real-IP headers are believed")
+	adminToken := flag.String("admin-token", os.Getenv("MASTERSERVER_ADMIN_TOKEN"), "bearer token for the admin API, disabled if empty (defaults to $MASTERSERVER_ADMIN_TOKEN)")
+	sessionKey := flag.String("session-key", os.Getenv("MASTERSERVER_SESSION_KEY"), "key to sign the session tokens players without a client certificate identify with, issued through the admin API, players stay anonymous if empty (defaults to $MASTERSERVER_SESSION_KEY)")
+	sessionTTL := flag.Duration("session-ttl", time.Hour*24, "how long issued session tokens are valid for")
+	moderationPolicy := flag.String("moderation-policy", "", "JSON file with the moderation policy applied to lobbies without one of their own")
+	profanityList := flag.String("profanity-list", "", "file with a word per line to mask in lobbies that mask profanity")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "host:port of an OTLP/HTTP collector to export traces to, tracing is disabled if empty")
+	tcpHeartbeat := flag.Duration("tcp-heartbeat-interval", time.Second*15, "how often TCP clients are sent a heartbeat to answer, 0 to disable")
+	tcpIdleTimeout := flag.Duration("tcp-idle-timeout", time.Second*60, "close TCP connections that send nothing for this long, 0 to disable")
+	tcpHandshakeTimeout := flag.Duration("tcp-handshake-timeout", time.Second*10, "close TCP connections that send no command for this long after connecting, 0 to disable")
+	tcpMaxConnections := flag.Int("tcp-max-connections", 10000, "maximum number of TCP connections served at once, 0 for no limit")
+	tcpMaxConnectionsPerIP := flag.Int("tcp-max-connections-per-ip", 32, "maximum number of TCP connections served at once from a single IP address, 0 for no limit")
+	compressionThreshold := flag.Int("compression-threshold", 512, "size in bytes from which TCP frames and websocket messages are compressed, negative to disable compression")
+	tlsCert := flag.String("tls-cert", "", "PEM certificate file to serve HTTPS and TCP over TLS with, reloaded when it changes, plaintext if empty")
+	tlsKey := flag.String("tls-key", "", "PEM private key file of the TLS certificate")
+	tlsClientCA := flag.String("tls-client-ca", "", "PEM file with the authorities of trusted client certificates, which identify their player by common name")
+	tlsRequireClientCert := flag.Bool("tls-require-client-cert", false, "refuse TLS clients without a certificate signed by -tls-client-ca")
+	otlpInsecure := flag.Bool("otlp-insecure", false, "export traces over plain HTTP instead of HTTPS")
+	flag.Parse()
+
+	logger, err := logging.New(os.Stderr, *logLevel, *logFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
+
+	if *otlpEndpoint != "" {
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(*otlpEndpoint)}
+		if *otlpInsecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err := otlptracehttp.New(context.Background(), options...)
+		if err != nil {
+			fatal(logger, "failed to create trace exporter", err)
+		}
+		provider := tracing.NewProvider(exporter)
+		otel.SetTracerProvider(provider)
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+			if err := provider.Shutdown(shutdownCtx); err != nil {
+				logger.Warn("failed to flush traces", slog.Any("error", err))
+			}
+		}()
+	}
+
+	retention := lobby.RetentionPolicy{
+		MaxCount: *historyMaxCount,
+		MaxAge:   *historyMaxAge,
+	}
+	var store lobby.MessageStore = lobby.NewInMemoryMessageStore(retention)
+	if *historyDir != "" {
+		store, err = lobby.NewFileMessageStore(*historyDir, retention)
+		if err != nil {
+			fatal(logger, "failed to open message history", err)
+		}
+	}
+
+	checker := health.NewChecker()
+
+	var backend lobby.MessageBackend
+	if *natsUrl != "" {
+		natsBackend, err := broker.NewNatsBackend(*natsUrl)
+		if err != nil {
+			fatal(logger, "failed to connect to NATS", err)
+		}
+		natsBackend.Logger = logger.With(slog.String("component", "nats"))
+		defer natsBackend.Close()
+		err = natsBackend.Setup(context.Background())
+		if err != nil {
+			fatal(logger, "failed to set up NATS", err)
+		}
+		checker.Add("nats", natsBackend.Healthy)
+		backend = natsBackend
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	closeChan := make(chan error)
-	ctx := context.Background()
+	servers := 3
+
+	localRepo := lobby.NewInMemoryRepo(store, backend)
+	err = localRepo.Restore()
+	if err != nil {
+		fatal(logger, "failed to restore lobbies", err)
+	}
+	if backend != nil {
+		err = localRepo.Follow(ctx)
+		if err != nil {
+			fatal(logger, "failed to follow shared lobbies", err)
+		}
+	}
+	m := metrics.New()
+	m.LobbyLabels = *metricsLobbyLabels
+	var repo lobby.Repo = localRepo
+	var node *cluster.Node
+	if *clusterAddr != "" {
+		if *clusterSecret == "" {
+			fatal(logger, "failed to join cluster", errors.New("-cluster-secret is required with -cluster-addr"))
+		}
+		node = cluster.NewNode(*clusterAddr, strings.Split(*clusterPeers, ","), *clusterSecret, localRepo)
+		node.Logger = logger.With(slog.String("component", "cluster"))
+		node.Metrics = m
+		repo = node
+		go node.Run(ctx)
+		go func(closeChan chan<- error) {
+			err := http.ListenAndServe(node.Addr(), node.Handler())
+			closeChan <- err
+		}(closeChan)
+		servers++
+	}
+
+	var proxies []netip.Prefix
+	for _, network := range strings.Split(*trustedProxies, ",") {
+		if network == "" {
+			continue
+		}
+		network = strings.TrimSpace(network)
+		proxy, err := netip.ParsePrefix(network)
+		if addr, addrErr := netip.ParseAddr(network); err != nil && addrErr == nil {
+			// A single address is a network of one.
+			proxy, err = addr.Prefix(addr.BitLen())
+		}
+		if err != nil {
+			fatal(logger, "failed to parse trusted proxies", err)
+		}
+		proxies = append(proxies, proxy)
+	}
+
+	var identities *identity.Signer
+	if *sessionKey != "" {
+		identities = identity.NewSigner([]byte(*sessionKey))
+		identities.TTL = *sessionTTL
+	}
+
+	tlsConfig := tlsconfig.Config{
+		CertFile:          *tlsCert,
+		KeyFile:           *tlsKey,
+		ClientCAFile:      *tlsClientCA,
+		RequireClientCert: *tlsRequireClientCert,
+	}
+	var serverTLS *tls.Config
+	if tlsConfig.Enabled() {
+		serverTLS, err = tlsConfig.Load(ctx, logger.With(slog.String("component", "tls")))
+		if err != nil {
+			fatal(logger, "failed to load TLS configuration", err)
+		}
+	}
+
+	service := lobby.NewServiceWithRepo(repo)
+	service.Metrics = m
+	service.Logger = logger.With(slog.String("component", "lobby"))
+
+	policy := moderation.DefaultPolicy
+	if *moderationPolicy != "" {
+		policy, err = moderation.LoadPolicy(*moderationPolicy)
+		if err != nil {
+			fatal(logger, "failed to load moderation policy", err)
+		}
+	}
+	moderator := moderation.NewModerator(policy)
+	if *profanityList != "" {
+		err = moderator.LoadWords(*profanityList)
+		if err != nil {
+			fatal(logger, "failed to load profanity list", err)
+		}
+	}
+	service.Filters = moderator
+
+	checker.Add("repo", func(ctx context.Context) error {
+		_, err := service.List(ctx)
+		return err
+	})
+	m.CollectLobbyStates(func() map[string]int {
+		states, err := service.LobbiesByState(ctx)
+		if err != nil {
+			logger.Warn("failed to collect lobby states", slog.Any("error", err))
+		}
+		return states
+	})
+
+	httpServer := httpserver.NewServer(service)
+	httpServer.Addr = *httpAddr
+	httpServer.Metrics = m
+	httpServer.Logger = logger.With(slog.String("component", "http"))
+	httpServer.Health = checker
+	httpServer.AdminToken = *adminToken
+	httpServer.TrustedProxies = proxies
+	httpServer.Identities = identities
+	httpServer.Moderation = moderator
+	httpServer.TLSConfig = serverTLS
+	httpServer.SocketCompressionThreshold = *compressionThreshold
+	if *compressionThreshold < 0 {
+		httpServer.SocketCompression = websocket.CompressionDisabled
+	}
+	checker.Add("http", httpServer.Listening)
+
+	tcpServer := tcp.NewServer(service)
+	tcpServer.Addr = *tcpAddr
+	tcpServer.Metrics = m
+	tcpServer.Logger = logger.With(slog.String("component", "tcp"))
+	tcpServer.Bans = httpServer.Bans
+	tcpServer.TLSConfig = serverTLS
+	tcpServer.HeartbeatInterval = *tcpHeartbeat
+	tcpServer.IdleTimeout = *tcpIdleTimeout
+	tcpServer.HandshakeTimeout = *tcpHandshakeTimeout
+	tcpServer.MaxConnections = *tcpMaxConnections
+	tcpServer.MaxConnectionsPerIP = *tcpMaxConnectionsPerIP
+	tcpServer.CompressionThreshold = *compressionThreshold
+	checker.Add("tcp", tcpServer.Listening)
+
+	grpcServer := grpcserver.NewServer(service)
+	grpcServer.Addr = *grpcAddr
+	grpcServer.Logger = logger.With(slog.String("component", "grpc"))
+	grpcServer.Bans = httpServer.Bans
+	grpcServer.TLSConfig = serverTLS
+	grpcServer.Identities = identities
+	checker.Add("grpc", grpcServer.Listening)
+
+	go func(closeChan chan<- error) {
+		err := httpServer.ListenAndServe()
+		closeChan <- err
+	}(closeChan)
 	go func(closeChan chan<- error) {
-		server := httpserver.NewServer(service)
-		err := server.ListenAndServe()
+		err := tcpServer.ListenAndServe(ctx)
 		closeChan <- err
 	}(closeChan)
 	go func(closeChan chan<- error) {
-		server := tcp.NewServer(service)
-		err := server.ListenAndServe(ctx)
+		err := grpcServer.ListenAndServe(ctx)
 		closeChan <- err
 	}(closeChan)
+	if *metricsAddr != "" {
+		go func(closeChan chan<- error) {
+			err := http.ListenAndServe(*metricsAddr, m.Handler())
+			closeChan <- err
+		}(closeChan)
+		servers++
+	}
 
-	for i := 0; i < 2; i++ {
-		err := <-closeChan
-		if err != nil {
-			log.Fatal(err)
+	for i := 0; i < servers; i++ {
+		select {
+		case err := <-closeChan:
+			if err != nil {
+				fatal(logger, "server stopped", err)
+			}
+		case <-ctx.Done():
+			if node != nil {
+				leaveCtx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+				err := node.Leave(leaveCtx)
+				cancel()
+				if err != nil {
+					logger.Error("failed to leave cluster", slog.Any("error", err))
+				}
+			}
+			return
 		}
 	}
 }
+
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, slog.Any("error", err))
+	os.Exit(1)
+}
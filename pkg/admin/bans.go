@@ -0,0 +1,204 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrInvalidBan = errors.New("invalid ban")
+
+type BanKind string
+
+const (
+	// PlayerBan bans a player id. It applies to the players identified by a
+	// client certificate or session token, which players cannot make up.
+	PlayerBan BanKind = "player"
+	// IPBan bans a single IP address or, in CIDR notation, a network.
+	IPBan BanKind = "ip"
+)
+
+type Ban struct {
+	Kind    BanKind
+	Value   string
+	Reason  string
+	Created time.Time
+	// Expires is when the ban is lifted, zero for permanent bans.
+	Expires time.Time
+}
+
+func (b Ban) expired(now time.Time) bool {
+	return !b.Expires.IsZero() && !now.Before(b.Expires)
+}
+
+type banKey struct {
+	kind  BanKind
+	value string
+}
+
+// BanList holds the players and addresses that may not connect.
+//
+// A nil BanList bans nobody.
+type BanList struct {
+	bans     map[banKey]Ban
+	networks map[banKey]*net.IPNet
+	mu       sync.RWMutex
+}
+
+func NewBanList() *BanList {
+	return &BanList{
+		bans:     make(map[banKey]Ban),
+		networks: make(map[banKey]*net.IPNet),
+	}
+}
+
+// Add bans the player or address in ban, replacing an existing ban of it.
+func (l *BanList) Add(ban Ban) (Ban, error) {
+	key := banKey{ban.Kind, ban.Value}
+
+	var network *net.IPNet
+	switch ban.Kind {
+	case PlayerBan:
+		if ban.Value == "" {
+			return Ban{}, fmt.Errorf("%w: player id is empty", ErrInvalidBan)
+		}
+	case IPBan:
+		var err error
+		network, err = parseNetwork(ban.Value)
+		if err != nil {
+			return Ban{}, fmt.Errorf("%w: %w", ErrInvalidBan, err)
+		}
+	default:
+		return Ban{}, fmt.Errorf("%w: unknown kind %q", ErrInvalidBan, ban.Kind)
+	}
+
+	if ban.Created.IsZero() {
+		ban.Created = time.Now()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.bans[key] = ban
+	if network != nil {
+		l.networks[key] = network
+	}
+	return ban, nil
+}
+
+// Remove lifts the ban of the player or address, reporting whether there
+// was one.
+func (l *BanList) Remove(kind BanKind, value string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := banKey{kind, value}
+	_, ok := l.bans[key]
+	delete(l.bans, key)
+	delete(l.networks, key)
+	return ok
+}
+
+// List returns every ban in effect, oldest first.
+func (l *BanList) List() []Ban {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	now := time.Now()
+	bans := make([]Ban, 0, len(l.bans))
+	for _, ban := range l.bans {
+		if !ban.expired(now) {
+			bans = append(bans, ban)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Created.Before(bans[j].Created)
+	})
+	return bans
+}
+
+// PlayerBanned returns the ban in effect for the player id, if any.
+func (l *BanList) PlayerBanned(playerId string) (Ban, bool) {
+	if l == nil || playerId == "" {
+		return Ban{}, false
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	ban, ok := l.bans[banKey{PlayerBan, playerId}]
+	if !ok || ban.expired(time.Now()) {
+		return Ban{}, false
+	}
+	return ban, true
+}
+
+// AddrBanned returns the ban in effect for the address, if any. The address
+// may carry a port, as in net.Conn.RemoteAddr.
+func (l *BanList) AddrBanned(addr string) (Ban, bool) {
+	if l == nil {
+		return Ban{}, false
+	}
+
+	ip := parseIP(addr)
+	if ip == nil {
+		return Ban{}, false
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	now := time.Now()
+	for key, network := range l.networks {
+		ban := l.bans[key]
+		if network.Contains(ip) && !ban.expired(now) {
+			return ban, true
+		}
+	}
+	return Ban{}, false
+}
+
+// Matches reports whether the ban applies to the player or address.
+func (b Ban) Matches(playerId string, addr string) bool {
+	switch b.Kind {
+	case PlayerBan:
+		return playerId != "" && b.Value == playerId
+	case IPBan:
+		network, err := parseNetwork(b.Value)
+		ip := parseIP(addr)
+		return err == nil && ip != nil && network.Contains(ip)
+	}
+	return false
+}
+
+func parseNetwork(value string) (*net.IPNet, error) {
+	_, network, err := net.ParseCIDR(value)
+	if err == nil {
+		return network, nil
+	}
+
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, fmt.Errorf("malformed address %q", value)
+	}
+	bits := 8 * net.IPv6len
+	if ip.To4() != nil {
+		ip = ip.To4()
+		bits = 8 * net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+func parseIP(addr string) net.IP {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(addr)
+}
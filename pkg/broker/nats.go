@@ -0,0 +1,302 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"github.com/nats-io/nats.go"
+	"log/slog"
+)
+
+var natsSubscriptionBufferSize = 256
+
+// NatsBackend is a lobby.MessageBackend and lobby.LobbyDirectory on top of
+// NATS JetStream, so that all master servers connected to the same NATS
+// cluster share lobbies and their traffic.
+//
+// The messages of every lobby are kept as JSON on a subject of its own in
+// a single stream, from which nodes catch up when they start following a
+// lobby. Each message is sequenced by the node publishing it, one after the
+// last message of the lobby in the stream, and the stream refuses it if
+// another node got there first, so that sequence numbers agree on every
+// node. Lobbies are kept in a key-value bucket that every node watches.
+type NatsBackend struct {
+	// SubjectPrefix is prepended to the lobby id to form the subject.
+	//
+	// Defaults to "lobby.".
+	SubjectPrefix string
+
+	// StreamName names the JetStream stream holding the messages of every
+	// lobby.
+	//
+	// Defaults to "LOBBY_MESSAGES".
+	StreamName string
+
+	// BucketName names the key-value bucket holding the lobbies.
+	//
+	// Defaults to "lobbies".
+	BucketName string
+
+	// MaxMessagesPerLobby bounds the messages of each lobby kept in the
+	// stream for nodes to catch up from.
+	//
+	// Defaults to 1000.
+	MaxMessagesPerLobby int64
+
+	// Logger controls where logs are sent.
+	// Defaults to slog.Default().
+	Logger *slog.Logger
+
+	conn    *nats.Conn
+	js      nats.JetStreamContext
+	lobbies nats.KeyValue
+}
+
+// NewNatsBackend connects to the NATS server at url, which must have
+// JetStream enabled.
+func NewNatsBackend(url string) (*NatsBackend, error) {
+	conn, err := nats.Connect(url)
+	if err != nil {
+		return nil, err
+	}
+	backend, err := NewNatsBackendWithConn(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return backend, nil
+}
+
+// NewNatsBackendWithConn constructs a backend on top of an existing
+// connection, for example one to an embedded server.
+func NewNatsBackendWithConn(conn *nats.Conn) (*NatsBackend, error) {
+	js, err := conn.JetStream()
+	if err != nil {
+		return nil, err
+	}
+	return &NatsBackend{
+		SubjectPrefix:       "lobby.",
+		StreamName:          "LOBBY_MESSAGES",
+		BucketName:          "lobbies",
+		MaxMessagesPerLobby: 1000,
+		Logger:              slog.Default(),
+		conn:                conn,
+		js:                  js,
+	}, nil
+}
+
+// Setup creates the stream and the bucket of the backend, or updates the
+// stream to its settings. It must be called once the fields are set and
+// before the backend is used.
+func (b *NatsBackend) Setup(ctx context.Context) error {
+	config := &nats.StreamConfig{
+		Name:              b.StreamName,
+		Subjects:          []string{b.SubjectPrefix + "*"},
+		MaxMsgsPerSubject: b.MaxMessagesPerLobby,
+	}
+	_, err := b.js.StreamInfo(b.StreamName, nats.Context(ctx))
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = b.js.AddStream(config, nats.Context(ctx))
+	} else if err == nil {
+		_, err = b.js.UpdateStream(config, nats.Context(ctx))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set up stream %s: %w", b.StreamName, err)
+	}
+
+	b.lobbies, err = b.js.KeyValue(b.BucketName)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		b.lobbies, err = b.js.CreateKeyValue(&nats.KeyValueConfig{Bucket: b.BucketName})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set up bucket %s: %w", b.BucketName, err)
+	}
+	return nil
+}
+
+func (b *NatsBackend) subject(lobbyId string) string {
+	return b.SubjectPrefix + lobbyId
+}
+
+// Publish sequences msg after the last message of the lobby in the stream,
+// and tries again with the next sequence number for as long as other nodes
+// publish first.
+func (b *NatsBackend) Publish(ctx context.Context, lobbyId string, msg lobby.Message) error {
+	for {
+		lastSeq, streamSeq, err := b.last(ctx, lobbyId)
+		if err != nil {
+			return err
+		}
+
+		msg.Seq = lastSeq + 1
+		data, err := json.Marshal(lobby.Seal(msg))
+		if err != nil {
+			return err
+		}
+		_, err = b.js.Publish(b.subject(lobbyId), data,
+			nats.ExpectLastSequencePerSubject(streamSeq),
+			nats.Context(ctx),
+		)
+		var apiErr *nats.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode == nats.JSErrCodeStreamWrongLastSequence {
+			continue
+		}
+		return err
+	}
+}
+
+// last returns the sequence number of the last message of the lobby, and
+// the sequence of that message in the stream, zero for lobbies without
+// messages.
+func (b *NatsBackend) last(ctx context.Context, lobbyId string) (uint64, uint64, error) {
+	raw, err := b.js.GetLastMsg(b.StreamName, b.subject(lobbyId), nats.Context(ctx))
+	if errors.Is(err, nats.ErrMsgNotFound) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var envelope lobby.Envelope
+	err = json.Unmarshal(raw.Data, &envelope)
+	if err != nil {
+		return 0, 0, fmt.Errorf("malformed last message of lobby %s: %w", lobbyId, err)
+	}
+	return envelope.Seq, raw.Sequence, nil
+}
+
+func (b *NatsBackend) Subscribe(ctx context.Context, lobbyId string, after uint64) (<-chan lobby.Message, error) {
+	raw := make(chan *nats.Msg, natsSubscriptionBufferSize)
+	sub, err := b.js.ChanSubscribe(b.subject(lobbyId), raw, nats.OrderedConsumer(), nats.DeliverAll())
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make(chan lobby.Message)
+	go func() {
+		defer close(messages)
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case natsMsg := <-raw:
+				var envelope lobby.Envelope
+				err := json.Unmarshal(natsMsg.Data, &envelope)
+				if err != nil {
+					b.Logger.Warn("dropping malformed message", slog.String("subject", natsMsg.Subject), slog.Any("error", err))
+					continue
+				}
+				if envelope.Seq <= after {
+					continue
+				}
+				select {
+				case messages <- envelope.Open():
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return messages, nil
+}
+
+func (b *NatsBackend) AddLobby(_ context.Context, l lobby.RepoLobby) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	_, err = b.lobbies.Create(l.Id, data)
+	if errors.Is(err, nats.ErrKeyExists) {
+		return lobby.ErrExists
+	}
+	return err
+}
+
+func (b *NatsBackend) UpdateLobby(_ context.Context, l lobby.RepoLobby) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	_, err = b.lobbies.Put(l.Id, data)
+	return err
+}
+
+// DeleteLobby removes the lobby from the bucket and its messages from the
+// stream, so that a lobby added with the same id starts afresh.
+func (b *NatsBackend) DeleteLobby(ctx context.Context, id string) error {
+	err := b.lobbies.Delete(id)
+	if err != nil {
+		return err
+	}
+	return b.js.PurgeStream(b.StreamName, &nats.StreamPurgeRequest{Subject: b.subject(id)}, nats.Context(ctx))
+}
+
+func (b *NatsBackend) WatchLobbies(ctx context.Context) (<-chan lobby.LobbyChange, error) {
+	watcher, err := b.lobbies.WatchAll(nats.Context(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(chan lobby.LobbyChange)
+	go func() {
+		defer close(changes)
+		defer watcher.Stop()
+
+		for {
+			var entry nats.KeyValueEntry
+			var ok bool
+			select {
+			case <-ctx.Done():
+				return
+			case entry, ok = <-watcher.Updates():
+				if !ok {
+					return
+				}
+			}
+
+			// The watcher marks the end of the existing lobbies with nil.
+			var change lobby.LobbyChange
+			if entry != nil {
+				change.Lobby.Id = entry.Key()
+				change.Deleted = entry.Operation() != nats.KeyValuePut
+				if !change.Deleted {
+					err := json.Unmarshal(entry.Value(), &change.Lobby)
+					if err != nil {
+						b.Logger.Warn("dropping malformed lobby", slog.String("key", entry.Key()), slog.Any("error", err))
+						continue
+					}
+				}
+			}
+
+			select {
+			case changes <- change:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return changes, nil
+}
+
+// Healthy is a health.Check reporting whether the connection to NATS is up,
+// confirmed by a round trip to the server.
+func (b *NatsBackend) Healthy(ctx context.Context) error {
+	if status := b.conn.Status(); status != nats.CONNECTED {
+		return fmt.Errorf("nats connection is %s", status)
+	}
+	return b.conn.FlushWithContext(ctx)
+}
+
+// Close drains pending messages and closes the connection.
+func (b *NatsBackend) Close() error {
+	return b.conn.Drain()
+}
+
+var _ lobby.MessageBackend = &NatsBackend{}
+var _ lobby.LobbyDirectory = &NatsBackend{}
@@ -0,0 +1,242 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startNats runs a NATS server with JetStream in the process and returns its
+// url.
+func startNats(t *testing.T) string {
+	t.Helper()
+
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Start()
+	t.Cleanup(srv.Shutdown)
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	return srv.ClientURL()
+}
+
+// startNode returns the repo of a master server sharing its lobbies through
+// the NATS server at url.
+func startNode(t *testing.T, ctx context.Context, url string) *lobby.InMemoryRepo {
+	t.Helper()
+
+	conn, err := nats.Connect(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(conn.Close)
+	backend, err := NewNatsBackendWithConn(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = backend.Setup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := lobby.NewInMemoryRepo(lobby.NewInMemoryMessageStore(lobby.DefaultRetentionPolicy), backend)
+	err = repo.Follow(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+// eventually fails the test unless cond holds within a few seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func receive(t *testing.T, messages <-chan lobby.Message) lobby.Message {
+	t.Helper()
+
+	select {
+	case msg, ok := <-messages:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+	return lobby.Message{}
+}
+
+func textMessage(content string) lobby.Message {
+	return lobby.Message{Type: lobby.TextMessageType, Text: lobby.TextMessage{Content: content}}
+}
+
+func TestLobbiesAreSharedBetweenNodes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	url := startNats(t)
+
+	a := startNode(t, ctx, url)
+	_, err := a.Add(lobby.RepoLobby{Id: "before", Name: "created before b started"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := startNode(t, ctx, url)
+
+	// Lobbies that existed when the node started are there once Follow
+	// returns.
+	l, err := b.Get("before")
+	if err != nil {
+		t.Fatalf("lobby created before the node started: %v", err)
+	}
+	if l.Name != "created before b started" {
+		t.Errorf("lobby name %q, want %q", l.Name, "created before b started")
+	}
+
+	_, err = b.Add(lobby.RepoLobby{Id: "after", Name: "created on b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "lobby created on b to reach a", func() bool {
+		_, err := a.Get("after")
+		return err == nil
+	})
+
+	_, err = a.Add(lobby.RepoLobby{Id: "after"})
+	if err == nil {
+		t.Error("lobby added with an id taken on another node")
+	}
+
+	_, err = a.Update(lobby.RepoLobby{Id: "after", Name: "renamed on a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "rename on a to reach b", func() bool {
+		l, err := b.Get("after")
+		return err == nil && l.Name == "renamed on a"
+	})
+
+	err = b.Delete("before")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "deletion on b to reach a", func() bool {
+		_, err := a.Get("before")
+		return err != nil
+	})
+}
+
+func TestMessagesAreSequencedAcrossNodes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	url := startNats(t)
+
+	a := startNode(t, ctx, url)
+	b := startNode(t, ctx, url)
+
+	_, err := a.Add(lobby.RepoLobby{Id: "shared"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamA, err := a.GetMessageStream("shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Published before b has heard of the lobby, which b catches up on.
+	err = streamA.Publish(ctx, textMessage("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "lobby to reach b", func() bool {
+		_, err := b.Get("shared")
+		return err == nil
+	})
+	streamB, err := b.GetMessageStream("shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messagesB := streamB.Subscribe(ctx, 0, "")
+	msg := receive(t, messagesB)
+	if msg.Seq != 1 || msg.Text.Content != "first" {
+		t.Fatalf("b received %d %q, want 1 %q", msg.Seq, msg.Text.Content, "first")
+	}
+
+	eventually(t, "first message to come back to a", func() bool {
+		return streamA.LastSeq() == 1
+	})
+	messagesA := streamA.Subscribe(ctx, 1, "")
+
+	// Both nodes see every message once, in the same order.
+	const perNode = 20
+	received := make(chan error, 2)
+	for name, messages := range map[string]<-chan lobby.Message{"a": messagesA, "b": messagesB} {
+		go func(name string, messages <-chan lobby.Message) {
+			for seq := uint64(2); seq <= 1+2*perNode; seq++ {
+				select {
+				case msg, ok := <-messages:
+					if !ok {
+						received <- fmt.Errorf("subscription on %s closed", name)
+						return
+					}
+					if msg.Seq != seq {
+						received <- fmt.Errorf("%s received seq %d, want %d", name, msg.Seq, seq)
+						return
+					}
+				case <-time.After(5 * time.Second):
+					received <- fmt.Errorf("%s received no message %d", name, seq)
+					return
+				}
+			}
+			received <- nil
+		}(name, messages)
+	}
+
+	var wg sync.WaitGroup
+	for _, stream := range []lobby.MessageStream{streamA, streamB} {
+		wg.Add(1)
+		go func(stream lobby.MessageStream) {
+			defer wg.Done()
+			for i := 0; i < perNode; i++ {
+				err := stream.Publish(ctx, textMessage("concurrent"))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(stream)
+	}
+	wg.Wait()
+
+	for i := 0; i < 2; i++ {
+		if err := <-received; err != nil {
+			t.Error(err)
+		}
+	}
+	if streamA.LastSeq() != streamB.LastSeq() {
+		t.Errorf("last seq %d on a and %d on b", streamA.LastSeq(), streamB.LastSeq())
+	}
+}
@@ -0,0 +1,241 @@
+package cluster
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Handler returns the internal API other nodes use to reach the lobbies
+// owned by this node. It should only be reachable from within the cluster,
+// and refuses requests without the secret of the cluster as a bearer token.
+func (n *Node) Handler() http.Handler {
+	r := chi.NewRouter()
+	r.Use(n.requireSecret)
+
+	r.Get("/internal/cluster/ping", n.pingHandler)
+	r.Post("/internal/cluster/leave", n.leaveHandler)
+
+	r.Get("/internal/lobby", n.listHandler)
+	r.Post("/internal/lobby", n.addHandler)
+	r.Post("/internal/lobby/import", n.importHandler)
+	r.Route("/internal/lobby/{lobbyId}", func(r chi.Router) {
+		r.Get("/", n.getHandler)
+		r.Put("/", n.updateHandler)
+		r.Delete("/", n.deleteHandler)
+		r.Get("/stream", n.streamInfoHandler)
+		r.Post("/publish", n.publishHandler)
+		r.Get("/history", n.historyHandler)
+		r.Get("/subscribe", n.subscribeHandler)
+	})
+
+	return r
+}
+
+func (n *Node) requireSecret(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || n.secret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(n.secret)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="cluster"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeError maps errors of the lobby package onto status codes, see
+// errorFromStatus for the reverse.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, lobby.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, lobby.ErrExists):
+		status = http.StatusConflict
+	case errors.Is(err, lobby.ErrClosed):
+		status = http.StatusGone
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+func (n *Node) pingHandler(w http.ResponseWriter, r *http.Request) {
+	if n.isLeaving() {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (n *Node) leaveHandler(w http.ResponseWriter, r *http.Request) {
+	var req leaveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	n.membership.MarkLeft(req.Addr)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (n *Node) listHandler(w http.ResponseWriter, r *http.Request) {
+	lobbies, err := n.local.ListLobbies()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	render.JSON(w, r, lobbies)
+}
+
+func (n *Node) addHandler(w http.ResponseWriter, r *http.Request) {
+	var l lobby.RepoLobby
+	if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	added, err := n.local.Add(l)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	render.JSON(w, r, added)
+}
+
+func (n *Node) importHandler(w http.ResponseWriter, r *http.Request) {
+	var req importRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	err := n.local.Import(req.Lobby, req.History)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (n *Node) getHandler(w http.ResponseWriter, r *http.Request) {
+	l, err := n.local.Get(chi.URLParam(r, "lobbyId"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	render.JSON(w, r, l)
+}
+
+func (n *Node) updateHandler(w http.ResponseWriter, r *http.Request) {
+	var l lobby.RepoLobby
+	if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	l.Id = chi.URLParam(r, "lobbyId")
+	updated, err := n.local.Update(l)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	render.JSON(w, r, updated)
+}
+
+func (n *Node) deleteHandler(w http.ResponseWriter, r *http.Request) {
+	err := n.local.Delete(chi.URLParam(r, "lobbyId"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (n *Node) streamInfoHandler(w http.ResponseWriter, r *http.Request) {
+	stream, err := n.local.GetMessageStream(chi.URLParam(r, "lobbyId"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	render.JSON(w, r, streamInfo{
+		Subscribers: stream.SubscriberCount(),
+		LastSeq:     stream.LastSeq(),
+	})
+}
+
+func (n *Node) publishHandler(w http.ResponseWriter, r *http.Request) {
+	var envelope lobby.Envelope
+	if err := json.NewDecoder(r.Body).Decode(&envelope); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	stream, err := n.local.GetMessageStream(chi.URLParam(r, "lobbyId"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	err = stream.Publish(r.Context(), envelope.Open())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (n *Node) historyHandler(w http.ResponseWriter, r *http.Request) {
+	before, err := strconv.ParseUint(r.URL.Query().Get("before"), 10, 64)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	stream, err := n.local.GetMessageStream(chi.URLParam(r, "lobbyId"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	messages, err := stream.History(before, limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	render.JSON(w, r, messages)
+}
+
+// subscribeHandler streams the messages of a lobby as JSON lines until the
+// subscription ends.
+func (n *Node) subscribeHandler(w http.ResponseWriter, r *http.Request) {
+	since, err := strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusNotImplemented), http.StatusNotImplemented)
+		return
+	}
+	stream, err := n.local.GetMessageStream(chi.URLParam(r, "lobbyId"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	encoder := json.NewEncoder(w)
+	for msg := range stream.Subscribe(r.Context(), since, r.URL.Query().Get("player")) {
+		if encoder.Encode(lobby.Seal(msg)) != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,223 @@
+package cluster
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// peerClient calls the internal API of other nodes.
+type peerClient struct {
+	http *http.Client
+	// streaming is used for long-lived subscriptions and has no timeout.
+	streaming *http.Client
+	secret    string
+}
+
+func newPeerClient(secret string) *peerClient {
+	return &peerClient{
+		http:      &http.Client{Timeout: time.Second * 5},
+		streaming: &http.Client{},
+		secret:    secret,
+	}
+}
+
+// newRequest constructs a request to the internal API of peer, carrying the
+// secret of the cluster.
+func (c *peerClient) newRequest(ctx context.Context, method string, peer string, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, "http://"+peer+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.secret)
+	return req, nil
+}
+
+// errUnauthorized is returned when a peer refuses the secret of the
+// cluster, such as when the nodes were given different secrets.
+var errUnauthorized = errors.New("secret refused")
+
+type streamInfo struct {
+	Subscribers int    `json:"subscribers"`
+	LastSeq     uint64 `json:"lastSeq"`
+}
+
+type importRequest struct {
+	Lobby   lobby.RepoLobby `json:"lobby"`
+	History []lobby.Message `json:"history"`
+}
+
+type leaveRequest struct {
+	Addr string `json:"addr"`
+}
+
+func lobbyPath(id string, rest string) string {
+	return "/internal/lobby/" + url.PathEscape(id) + rest
+}
+
+// errorFromStatus maps the status codes of the internal API back onto the
+// errors of the lobby package.
+func errorFromStatus(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusAccepted, http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return fmt.Errorf("peer %s: %w", resp.Request.URL.Host, lobby.ErrNotFound)
+	case http.StatusConflict:
+		return fmt.Errorf("peer %s: %w", resp.Request.URL.Host, lobby.ErrExists)
+	case http.StatusGone:
+		return fmt.Errorf("peer %s: %w", resp.Request.URL.Host, lobby.ErrClosed)
+	case http.StatusUnauthorized:
+		return fmt.Errorf("peer %s: %w", resp.Request.URL.Host, errUnauthorized)
+	default:
+		return fmt.Errorf("peer %s: unexpected status %s", resp.Request.URL.Host, resp.Status)
+	}
+}
+
+func (c *peerClient) do(ctx context.Context, method string, peer string, path string, body any, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := c.newRequest(ctx, method, peer, path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = errorFromStatus(resp)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *peerClient) ping(ctx context.Context, peer string) error {
+	return c.do(ctx, http.MethodGet, peer, "/internal/cluster/ping", nil, nil)
+}
+
+func (c *peerClient) leave(ctx context.Context, peer string, self string) error {
+	return c.do(ctx, http.MethodPost, peer, "/internal/cluster/leave", leaveRequest{Addr: self}, nil)
+}
+
+func (c *peerClient) list(ctx context.Context, peer string) ([]lobby.Lobby, error) {
+	var lobbies []lobby.Lobby
+	err := c.do(ctx, http.MethodGet, peer, "/internal/lobby", nil, &lobbies)
+	return lobbies, err
+}
+
+func (c *peerClient) get(ctx context.Context, peer string, id string) (lobby.RepoLobby, error) {
+	var l lobby.RepoLobby
+	err := c.do(ctx, http.MethodGet, peer, lobbyPath(id, ""), nil, &l)
+	return l, err
+}
+
+func (c *peerClient) add(ctx context.Context, peer string, l lobby.RepoLobby) (lobby.RepoLobby, error) {
+	var added lobby.RepoLobby
+	err := c.do(ctx, http.MethodPost, peer, "/internal/lobby", l, &added)
+	return added, err
+}
+
+func (c *peerClient) update(ctx context.Context, peer string, l lobby.RepoLobby) (lobby.RepoLobby, error) {
+	var updated lobby.RepoLobby
+	err := c.do(ctx, http.MethodPut, peer, lobbyPath(l.Id, ""), l, &updated)
+	return updated, err
+}
+
+func (c *peerClient) delete(ctx context.Context, peer string, id string) error {
+	return c.do(ctx, http.MethodDelete, peer, lobbyPath(id, ""), nil, nil)
+}
+
+func (c *peerClient) importLobby(ctx context.Context, peer string, l lobby.RepoLobby, history []lobby.Message) error {
+	return c.do(ctx, http.MethodPost, peer, "/internal/lobby/import", importRequest{Lobby: l, History: history}, nil)
+}
+
+func (c *peerClient) streamInfo(ctx context.Context, peer string, id string) (streamInfo, error) {
+	var info streamInfo
+	err := c.do(ctx, http.MethodGet, peer, lobbyPath(id, "/stream"), nil, &info)
+	return info, err
+}
+
+func (c *peerClient) publish(ctx context.Context, peer string, id string, msg lobby.Message) error {
+	return c.do(ctx, http.MethodPost, peer, lobbyPath(id, "/publish"), lobby.Seal(msg), nil)
+}
+
+func (c *peerClient) history(ctx context.Context, peer string, id string, before uint64, limit int) ([]lobby.Message, error) {
+	query := url.Values{}
+	query.Set("before", strconv.FormatUint(before, 10))
+	query.Set("limit", strconv.Itoa(limit))
+
+	var messages []lobby.Message
+	err := c.do(ctx, http.MethodGet, peer, lobbyPath(id, "/history?"+query.Encode()), nil, &messages)
+	return messages, err
+}
+
+// subscribe streams the messages of a lobby from its owner. The channel is
+// closed when ctx is done or the owner ends the stream.
+func (c *peerClient) subscribe(ctx context.Context, peer string, id string, since uint64, playerId string) (<-chan lobby.Message, error) {
+	query := url.Values{}
+	query.Set("since", strconv.FormatUint(since, 10))
+	query.Set("player", playerId)
+	path := lobbyPath(id, "/subscribe?"+query.Encode())
+	req, err := c.newRequest(ctx, http.MethodGet, peer, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.streaming.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	err = errorFromStatus(resp)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	messages := make(chan lobby.Message)
+	go func() {
+		defer close(messages)
+		defer resp.Body.Close()
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var envelope lobby.Envelope
+			if json.Unmarshal(scanner.Bytes(), &envelope) != nil {
+				return
+			}
+			select {
+			case messages <- envelope.Open():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return messages, nil
+}
@@ -0,0 +1,143 @@
+package cluster
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Membership tracks which nodes of a static peer list are alive by probing
+// them periodically. A peer is considered gone after FailureThreshold
+// consecutive failed probes, or immediately when it announces that it is
+// leaving, and is considered alive again after a single successful probe.
+type Membership struct {
+	ProbeInterval    time.Duration
+	FailureThreshold int
+
+	// OnChange is called with the sorted addresses of the alive nodes,
+	// including this node, whenever they change.
+	OnChange func(alive []string)
+
+	self     string
+	peers    []string
+	probe    func(ctx context.Context, peer string) error
+	failures map[string]int
+	alive    map[string]bool
+	mu       sync.Mutex
+}
+
+func NewMembership(self string, peers []string, probe func(ctx context.Context, peer string) error) *Membership {
+	m := &Membership{
+		ProbeInterval:    time.Second,
+		FailureThreshold: 3,
+		OnChange:         func([]string) {},
+		self:             self,
+		probe:            probe,
+		failures:         make(map[string]int),
+		alive:            make(map[string]bool),
+	}
+	for _, peer := range peers {
+		if peer != self {
+			m.peers = append(m.peers, peer)
+			// Peers start out alive so that ownership is stable while a
+			// cluster boots, failing probes take them out.
+			m.alive[peer] = true
+		}
+	}
+	return m
+}
+
+// Alive returns the sorted addresses of the alive nodes, including this node.
+func (m *Membership) Alive() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.aliveLocked()
+}
+
+func (m *Membership) aliveLocked() []string {
+	alive := []string{m.self}
+	for peer, ok := range m.alive {
+		if ok {
+			alive = append(alive, peer)
+		}
+	}
+	sort.Strings(alive)
+	return alive
+}
+
+// Run probes the peers until ctx is done.
+func (m *Membership) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.ProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.probePeers(ctx)
+		}
+	}
+}
+
+func (m *Membership) probePeers(ctx context.Context) {
+	results := make(map[string]error, len(m.peers))
+	var resultsMu sync.Mutex
+	var wg sync.WaitGroup
+	for _, peer := range m.peers {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, m.ProbeInterval)
+			defer cancel()
+			err := m.probe(probeCtx, peer)
+			resultsMu.Lock()
+			results[peer] = err
+			resultsMu.Unlock()
+		}(peer)
+	}
+	wg.Wait()
+
+	m.mu.Lock()
+	changed := false
+	for peer, err := range results {
+		if err == nil {
+			m.failures[peer] = 0
+			changed = m.setAlive(peer, true) || changed
+			continue
+		}
+		m.failures[peer]++
+		if m.failures[peer] >= m.FailureThreshold {
+			changed = m.setAlive(peer, false) || changed
+		}
+	}
+	alive := m.aliveLocked()
+	m.mu.Unlock()
+
+	if changed {
+		m.OnChange(alive)
+	}
+}
+
+// MarkLeft takes a peer out of the alive set right away.
+func (m *Membership) MarkLeft(peer string) {
+	m.mu.Lock()
+	m.failures[peer] = m.FailureThreshold
+	changed := m.setAlive(peer, false)
+	alive := m.aliveLocked()
+	m.mu.Unlock()
+
+	if changed {
+		m.OnChange(alive)
+	}
+}
+
+func (m *Membership) setAlive(peer string, alive bool) bool {
+	if m.alive[peer] == alive {
+		return false
+	}
+	m.alive[peer] = alive
+	return true
+}
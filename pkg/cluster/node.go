@@ -0,0 +1,344 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"github.com/lukaspj/go-masterserver/pkg/metrics"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// transferHistorySize is the number of messages handed over together with a
+// lobby when its ownership moves to another node.
+var transferHistorySize = 100
+
+// Node is a lobby.Repo that shards lobbies across the nodes of a cluster by
+// consistent hashing on the lobby id. Operations on lobbies owned by another
+// node are forwarded to that node through its internal API, see Handler.
+//
+// When membership changes, every node hands the lobbies it no longer owns
+// over to their new owners. Lobbies owned by a node that disappears without
+// leaving are lost, unless the local repo shares its lobbies through a
+// lobby.LobbyDirectory, in which case every node already holds every lobby
+// and nothing is handed over.
+//
+// The nodes authenticate to each other with a secret shared by the cluster.
+type Node struct {
+	// Logger controls where logs are sent.
+	// Defaults to slog.Default().
+	Logger *slog.Logger
+
+	// Metrics forgets the series of lobbies handed over to other nodes.
+	// Defaults to nil, which records nothing.
+	Metrics *metrics.Metrics
+
+	addr       string
+	secret     string
+	local      *lobby.InMemoryRepo
+	ring       *Ring
+	membership *Membership
+	client     *peerClient
+
+	leaving     bool
+	leavingMu   sync.RWMutex
+	rebalanceMu sync.Mutex
+}
+
+// NewNode constructs the node reachable by the other nodes at addr, storing
+// the lobbies it owns in local. The peers are the internal addresses of all
+// nodes of the cluster and may include addr itself. Every node of the
+// cluster must be given the same secret, without which the internal API
+// refuses all requests.
+func NewNode(addr string, peers []string, secret string, local *lobby.InMemoryRepo) *Node {
+	n := &Node{
+		Logger: slog.Default(),
+		addr:   addr,
+		secret: secret,
+		local:  local,
+		ring:   NewRing(defaultRingReplicas),
+		client: newPeerClient(secret),
+	}
+	n.membership = NewMembership(addr, peers, n.client.ping)
+	n.membership.OnChange = n.membershipChanged
+	n.ring.Set(n.membership.Alive())
+	return n
+}
+
+// Addr returns the address other nodes reach this node's internal API at.
+func (n *Node) Addr() string {
+	return n.addr
+}
+
+// Membership exposes the membership of the cluster as seen by this node.
+func (n *Node) Membership() *Membership {
+	return n.membership
+}
+
+// Run probes the other nodes until ctx is done.
+func (n *Node) Run(ctx context.Context) {
+	n.membership.Run(ctx)
+}
+
+// Leave hands all lobbies over to the remaining nodes and tells them that
+// this node is leaving the cluster.
+func (n *Node) Leave(ctx context.Context) error {
+	n.leavingMu.Lock()
+	n.leaving = true
+	n.leavingMu.Unlock()
+
+	remaining := make([]string, 0)
+	for _, node := range n.membership.Alive() {
+		if node != n.addr {
+			remaining = append(remaining, node)
+		}
+	}
+	n.ring.Set(remaining)
+
+	err := n.rebalance(ctx)
+	for _, peer := range remaining {
+		if leaveErr := n.client.leave(ctx, peer, n.addr); leaveErr != nil {
+			n.Logger.Warn("failed to tell peer about leaving", slog.String("peer", peer), slog.Any("error", leaveErr))
+		}
+	}
+	return err
+}
+
+func (n *Node) isLeaving() bool {
+	n.leavingMu.RLock()
+	defer n.leavingMu.RUnlock()
+	return n.leaving
+}
+
+func (n *Node) membershipChanged(alive []string) {
+	if n.isLeaving() {
+		return
+	}
+	n.Logger.Info("cluster membership changed", slog.Any("alive", alive))
+	n.ring.Set(alive)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := n.rebalance(ctx); err != nil {
+			n.Logger.Error("failed to rebalance lobbies", slog.Any("error", err))
+		}
+	}()
+}
+
+// rebalance hands every local lobby that is owned by another node over to
+// its owner. Subscribers of a moved lobby have their subscription closed so
+// they reconnect through the new owner.
+func (n *Node) rebalance(ctx context.Context) error {
+	n.rebalanceMu.Lock()
+	defer n.rebalanceMu.Unlock()
+
+	if n.local.Shared() {
+		// Deleting a shared lobby deletes it on every node, and the owner
+		// holds it already.
+		return nil
+	}
+
+	lobbies, err := n.local.List()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, l := range lobbies {
+		owner := n.ring.Owner(l.Id)
+		if owner == n.addr || owner == "" {
+			continue
+		}
+
+		stream, err := n.local.GetMessageStream(l.Id)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		history, err := stream.History(0, transferHistorySize)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		err = n.client.importLobby(ctx, owner, l, history)
+		if err != nil && !errors.Is(err, lobby.ErrExists) {
+			errs = append(errs, err)
+			continue
+		}
+		err = n.local.Forget(l.Id)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		n.Metrics.LobbyDeleted(l.Id)
+		n.Logger.Info("handed lobby over", slog.String("lobby_id", l.Id), slog.String("owner", owner))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to hand over %d lobbies: %w", len(errs), errs[0])
+	}
+	return nil
+}
+
+func (n *Node) owner(id string) string {
+	return n.ring.Owner(id)
+}
+
+// List returns the lobbies of every reachable node.
+func (n *Node) List() ([]lobby.RepoLobby, error) {
+	listed, err := n.ListLobbies()
+	if err != nil {
+		return nil, err
+	}
+
+	lobbies := make([]lobby.RepoLobby, len(listed))
+	for idx, l := range listed {
+		lobbies[idx] = lobby.RepoLobby{Id: l.Id, Name: l.Name, Created: l.Created}
+	}
+	return lobbies, nil
+}
+
+// ListLobbies returns the lobbies of every reachable node along with their
+// subscriber counts, asking every peer once. Shared lobbies are held by
+// every node, so each is taken from its owner, which its subscribers are
+// forwarded to.
+func (n *Node) ListLobbies() ([]lobby.Lobby, error) {
+	lobbies, err := n.local.ListLobbies()
+	if err != nil {
+		return nil, err
+	}
+	lobbies = n.ownedBy(n.addr, lobbies)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	for _, peer := range n.membership.Alive() {
+		if peer == n.addr {
+			continue
+		}
+		peerLobbies, err := n.client.list(ctx, peer)
+		if err != nil {
+			// A partial list is more useful to players than none at all.
+			n.Logger.Warn("failed to list lobbies of peer", slog.String("peer", peer), slog.Any("error", err))
+			continue
+		}
+		lobbies = append(lobbies, n.ownedBy(peer, peerLobbies)...)
+	}
+	return lobbies, nil
+}
+
+// ownedBy returns the lobbies listed by node that it owns, when lobbies are
+// shared. Otherwise every node lists only the lobbies it holds, which
+// includes those it has yet to hand over.
+func (n *Node) ownedBy(node string, lobbies []lobby.Lobby) []lobby.Lobby {
+	if !n.local.Shared() {
+		return lobbies
+	}
+	owned := make([]lobby.Lobby, 0, len(lobbies))
+	for _, l := range lobbies {
+		if n.owner(l.Id) == node {
+			owned = append(owned, l)
+		}
+	}
+	return owned
+}
+
+func (n *Node) Get(id string) (lobby.RepoLobby, error) {
+	owner := n.owner(id)
+	if owner == n.addr {
+		return n.local.Get(id)
+	}
+	return n.client.get(context.Background(), owner, id)
+}
+
+func (n *Node) Add(l lobby.RepoLobby) (lobby.RepoLobby, error) {
+	if l.Id == "" {
+		l.Id = uuid.NewString()
+	}
+	owner := n.owner(l.Id)
+	if owner == n.addr {
+		return n.local.Add(l)
+	}
+	return n.client.add(context.Background(), owner, l)
+}
+
+func (n *Node) Update(l lobby.RepoLobby) (lobby.RepoLobby, error) {
+	owner := n.owner(l.Id)
+	if owner == n.addr {
+		return n.local.Update(l)
+	}
+	return n.client.update(context.Background(), owner, l)
+}
+
+func (n *Node) Delete(id string) error {
+	owner := n.owner(id)
+	if owner == n.addr {
+		return n.local.Delete(id)
+	}
+	return n.client.delete(context.Background(), owner, id)
+}
+
+func (n *Node) GetMessageStream(id string) (lobby.MessageStream, error) {
+	owner := n.owner(id)
+	if owner == n.addr {
+		return n.local.GetMessageStream(id)
+	}
+
+	_, err := n.client.get(context.Background(), owner, id)
+	if err != nil {
+		return nil, err
+	}
+	return &remoteMessageStream{client: n.client, owner: owner, lobbyId: id, logger: n.Logger}, nil
+}
+
+var _ lobby.Repo = &Node{}
+var _ lobby.LobbyLister = &Node{}
+
+// remoteMessageStream forwards to the stream of a lobby owned by another node.
+type remoteMessageStream struct {
+	client  *peerClient
+	owner   string
+	lobbyId string
+	logger  *slog.Logger
+}
+
+func (s *remoteMessageStream) Publish(ctx context.Context, msg lobby.Message) error {
+	return s.client.publish(ctx, s.owner, s.lobbyId, msg)
+}
+
+func (s *remoteMessageStream) Subscribe(ctx context.Context, since uint64, playerId string) <-chan lobby.Message {
+	messages, err := s.client.subscribe(ctx, s.owner, s.lobbyId, since, playerId)
+	if err != nil {
+		s.logger.Warn("failed to subscribe to remote lobby", slog.String("lobby_id", s.lobbyId), slog.String("owner", s.owner), slog.Any("error", err))
+		closed := make(chan lobby.Message)
+		close(closed)
+		return closed
+	}
+	return messages
+}
+
+func (s *remoteMessageStream) History(before uint64, limit int) ([]lobby.Message, error) {
+	return s.client.history(context.Background(), s.owner, s.lobbyId, before, limit)
+}
+
+func (s *remoteMessageStream) SubscriberCount() int {
+	info, err := s.client.streamInfo(context.Background(), s.owner, s.lobbyId)
+	if err != nil {
+		return 0
+	}
+	return info.Subscribers
+}
+
+func (s *remoteMessageStream) LastSeq() uint64 {
+	info, err := s.client.streamInfo(context.Background(), s.owner, s.lobbyId)
+	if err != nil {
+		return 0
+	}
+	return info.LastSeq
+}
+
+var _ lobby.MessageStream = &remoteMessageStream{}
@@ -0,0 +1,369 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lukaspj/go-masterserver/pkg/broker"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"github.com/lukaspj/go-masterserver/pkg/metrics"
+	"github.com/nats-io/nats-server/v2/server"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSecret = "test-secret"
+
+// testNode is a node of a cluster running in the process, which counts the
+// requests made to its internal API.
+type testNode struct {
+	*Node
+	requests map[string]int
+	mu       sync.Mutex
+}
+
+func (n *testNode) count(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n.mu.Lock()
+		n.requests[r.Method+" "+r.URL.Path]++
+		n.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (n *testNode) requestsTo(route string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.requests[route]
+}
+
+// startCluster starts size nodes serving their internal API on local
+// listeners, each knowing every other.
+func startCluster(t *testing.T, size int) []*testNode {
+	t.Helper()
+
+	return startClusterOf(t, size, func() *lobby.InMemoryRepo {
+		return lobby.NewInMemoryRepo(lobby.NewInMemoryMessageStore(lobby.DefaultRetentionPolicy), nil)
+	})
+}
+
+// startClusterOf starts a cluster like startCluster, storing the lobbies of
+// each node in a repo made by newRepo.
+func startClusterOf(t *testing.T, size int, newRepo func() *lobby.InMemoryRepo) []*testNode {
+	t.Helper()
+
+	listeners := make([]net.Listener, size)
+	peers := make([]string, size)
+	for i := range listeners {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners[i] = listener
+		peers[i] = listener.Addr().String()
+	}
+
+	nodes := make([]*testNode, size)
+	for i, listener := range listeners {
+		node := &testNode{
+			Node:     NewNode(peers[i], peers, testSecret, newRepo()),
+			requests: make(map[string]int),
+		}
+		server := &httptest.Server{
+			Listener: listener,
+			Config:   &http.Server{Handler: node.count(node.Handler())},
+		}
+		server.Start()
+		t.Cleanup(server.Close)
+		nodes[i] = node
+	}
+	return nodes
+}
+
+// addLobbies adds count lobbies through node, returning their ids.
+func addLobbies(t *testing.T, node *testNode, count int) []string {
+	t.Helper()
+
+	ids := make([]string, count)
+	for i := range ids {
+		l, err := node.Add(lobby.RepoLobby{Name: fmt.Sprintf("lobby %d", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = l.Id
+	}
+	return ids
+}
+
+func TestLobbiesAreReachableFromEveryNode(t *testing.T) {
+	nodes := startCluster(t, 3)
+	ids := addLobbies(t, nodes[0], 30)
+
+	owners := make(map[string]int)
+	for _, id := range ids {
+		owners[nodes[0].owner(id)]++
+	}
+	if len(owners) != len(nodes) {
+		t.Fatalf("lobbies owned by %d nodes, want all %d", len(owners), len(nodes))
+	}
+
+	for _, node := range nodes {
+		for _, id := range ids {
+			_, err := node.Get(id)
+			if err != nil {
+				t.Fatalf("node %s failed to get lobby %s: %v", node.Addr(), id, err)
+			}
+		}
+	}
+
+	// A subscriber on one node receives what is published on another.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	id := ids[0]
+	subscribing, err := nodes[1].GetMessageStream(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := subscribing.Subscribe(ctx, 0, "")
+	publishing, err := nodes[2].GetMessageStream(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The subscription to a remote owner is set up asynchronously.
+	deadline := time.Now().Add(5 * time.Second)
+	for publishing.SubscriberCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	err = publishing.Publish(ctx, lobby.Message{Type: lobby.TextMessageType, Text: lobby.TextMessage{Content: "hello"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-messages:
+		if msg.Seq != 1 || msg.Text.Content != "hello" {
+			t.Errorf("received %d %q, want 1 %q", msg.Seq, msg.Text.Content, "hello")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+}
+
+func TestListAsksEveryPeerOnce(t *testing.T) {
+	nodes := startCluster(t, 3)
+	ids := addLobbies(t, nodes[0], 30)
+
+	service := lobby.NewServiceWithRepo(nodes[0])
+	lobbies, err := service.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lobbies) != len(ids) {
+		t.Errorf("listed %d lobbies, want %d", len(lobbies), len(ids))
+	}
+	_, err = service.LobbiesByState(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, peer := range nodes[1:] {
+		if lists := peer.requestsTo("GET /internal/lobby"); lists != 2 {
+			t.Errorf("node %s was asked for its lobbies %d times, want 2", peer.Addr(), lists)
+		}
+		for route, count := range peer.requests {
+			if route != "GET /internal/lobby" && route != "POST /internal/lobby" {
+				t.Errorf("listing made %d requests to %s of %s", count, route, peer.Addr())
+			}
+		}
+	}
+}
+
+func TestInternalAPIRequiresTheSecret(t *testing.T) {
+	nodes := startCluster(t, 2)
+
+	for _, header := range []string{"", "Bearer wrong", "Bearer " + testSecret + "x"} {
+		req, err := http.NewRequest(http.MethodGet, "http://"+nodes[0].Addr()+"/internal/lobby", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("request with authorization %q answered %s, want 401", header, resp.Status)
+		}
+	}
+
+	stranger := newPeerClient("wrong")
+	_, err := stranger.list(context.Background(), nodes[0].Addr())
+	if !errors.Is(err, errUnauthorized) {
+		t.Errorf("listing with the wrong secret returned %v, want %v", err, errUnauthorized)
+	}
+	_, err = nodes[1].client.list(context.Background(), nodes[0].Addr())
+	if err != nil {
+		t.Errorf("listing with the secret of the cluster: %v", err)
+	}
+}
+
+func TestLeavingHandsLobbiesOver(t *testing.T) {
+	nodes := startCluster(t, 3)
+	ids := addLobbies(t, nodes[0], 30)
+
+	leaving := nodes[0]
+	m := metrics.New()
+	m.LobbyLabels = true
+	leaving.Metrics = m
+	var moved []string
+	for _, id := range ids {
+		if leaving.owner(id) == leaving.Addr() {
+			moved = append(moved, id)
+			m.MessagePublished(id)
+		}
+	}
+	if len(moved) == 0 {
+		t.Fatal("leaving node owns no lobbies")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := leaving.Leave(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local, err := leaving.local.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(local) != 0 {
+		t.Errorf("leaving node kept %d lobbies", len(local))
+	}
+	for _, id := range ids {
+		_, err := nodes[1].Get(id)
+		if err != nil {
+			t.Errorf("lobby %s lost: %v", id, err)
+		}
+	}
+
+	families, err := m.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == "masterserver_messages_published_total" && len(family.GetMetric()) > 0 {
+			t.Errorf("leaving node kept %d series of lobbies it handed over", len(family.GetMetric()))
+		}
+	}
+}
+
+// startNats runs a NATS server with JetStream in the process and returns a
+// function making the repos of nodes sharing their lobbies through it.
+func startNats(t *testing.T) func() *lobby.InMemoryRepo {
+	t.Helper()
+
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Start()
+	t.Cleanup(srv.Shutdown)
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return func() *lobby.InMemoryRepo {
+		backend, err := broker.NewNatsBackend(srv.ClientURL())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { backend.Close() })
+		err = backend.Setup(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		repo := lobby.NewInMemoryRepo(lobby.NewInMemoryMessageStore(lobby.DefaultRetentionPolicy), backend)
+		err = repo.Follow(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo
+	}
+}
+
+func TestSharedLobbiesSurviveRebalancing(t *testing.T) {
+	newRepo := startNats(t)
+	nodes := startClusterOf(t, 2, newRepo)
+	ids := addLobbies(t, nodes[0], 10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, id := range ids {
+		stream, err := nodes[0].GetMessageStream(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = stream.Publish(ctx, lobby.Message{Type: lobby.TextMessageType, Text: lobby.TextMessage{Content: "hello"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	service := lobby.NewServiceWithRepo(nodes[1])
+	lobbies, err := service.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lobbies) != len(ids) {
+		t.Errorf("listed %d lobbies, want each of the %d once", len(lobbies), len(ids))
+	}
+
+	nodes[1].membershipChanged([]string{nodes[1].Addr()})
+	err = nodes[0].Leave(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A node joining now finds every lobby and its history in the
+	// directory.
+	joining := newRepo()
+	for _, id := range ids {
+		stream, err := joining.GetMessageStream(id)
+		if err != nil {
+			t.Fatalf("lobby %s lost: %v", id, err)
+		}
+		// The history is replayed from the directory in the background.
+		deadline := time.Now().Add(5 * time.Second)
+		for stream.LastSeq() == 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if stream.LastSeq() != 1 {
+			t.Errorf("lobby %s kept %d messages, want 1", id, stream.LastSeq())
+		}
+	}
+	for _, node := range nodes {
+		local, err := node.local.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(local) != len(ids) {
+			t.Errorf("node %s holds %d lobbies, want all %d", node.Addr(), len(local), len(ids))
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package cluster
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+var defaultRingReplicas = 64
+
+// Ring assigns keys to nodes by consistent hashing, so that a change in
+// membership only moves the keys of the nodes that joined or left.
+type Ring struct {
+	replicas int
+	hashes   []uint64
+	owners   map[uint64]string
+	mu       sync.RWMutex
+}
+
+func NewRing(replicas int) *Ring {
+	return &Ring{
+		replicas: replicas,
+		owners:   make(map[uint64]string),
+	}
+}
+
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// Set replaces the nodes of the ring.
+func (r *Ring) Set(nodes []string) {
+	hashes := make([]uint64, 0, len(nodes)*r.replicas)
+	owners := make(map[uint64]string, len(nodes)*r.replicas)
+	for _, node := range nodes {
+		for i := 0; i < r.replicas; i++ {
+			hash := hashKey(strconv.Itoa(i) + "#" + node)
+			hashes = append(hashes, hash)
+			owners[hash] = node
+		}
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hashes = hashes
+	r.owners = owners
+}
+
+// Owner returns the node responsible for key, or an empty string if the
+// ring has no nodes.
+func (r *Ring) Owner(key string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.hashes) == 0 {
+		return ""
+	}
+
+	hash := hashKey(key)
+	idx := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= hash })
+	if idx == len(r.hashes) {
+		idx = 0
+	}
+	return r.owners[r.hashes[idx]]
+}
+
+// Nodes returns the distinct nodes of the ring.
+func (r *Ring) Nodes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	nodes := make([]string, 0)
+	for _, hash := range r.hashes {
+		if node := r.owners[hash]; !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Strings(nodes)
+	return nodes
+}
@@ -0,0 +1,299 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: masterserver/lobby/v1/lobby.proto
+
+package lobbypb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	LobbyService_ListLobbies_FullMethodName = "/masterserver.lobby.v1.LobbyService/ListLobbies"
+	LobbyService_CreateLobby_FullMethodName = "/masterserver.lobby.v1.LobbyService/CreateLobby"
+	LobbyService_DeleteLobby_FullMethodName = "/masterserver.lobby.v1.LobbyService/DeleteLobby"
+	LobbyService_Publish_FullMethodName     = "/masterserver.lobby.v1.LobbyService/Publish"
+	LobbyService_Subscribe_FullMethodName   = "/masterserver.lobby.v1.LobbyService/Subscribe"
+)
+
+// LobbyServiceClient is the client API for LobbyService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type LobbyServiceClient interface {
+	// ListLobbies returns every lobby.
+	ListLobbies(ctx context.Context, in *ListLobbiesRequest, opts ...grpc.CallOption) (*ListLobbiesResponse, error)
+	// CreateLobby creates a lobby and returns its id.
+	CreateLobby(ctx context.Context, in *CreateLobbyRequest, opts ...grpc.CallOption) (*CreateLobbyResponse, error)
+	// DeleteLobby deletes a lobby, ending the subscriptions to it.
+	DeleteLobby(ctx context.Context, in *DeleteLobbyRequest, opts ...grpc.CallOption) (*DeleteLobbyResponse, error)
+	// Publish sends a text message to a lobby.
+	// Callers publishing too fast are refused with RESOURCE_EXHAUSTED.
+	Publish(ctx context.Context, in *PublishRequest, opts ...grpc.CallOption) (*PublishResponse, error)
+	// Subscribe streams the messages of a lobby until the client cancels or
+	// the lobby is closed.
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (LobbyService_SubscribeClient, error)
+}
+
+type lobbyServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLobbyServiceClient(cc grpc.ClientConnInterface) LobbyServiceClient {
+	return &lobbyServiceClient{cc}
+}
+
+func (c *lobbyServiceClient) ListLobbies(ctx context.Context, in *ListLobbiesRequest, opts ...grpc.CallOption) (*ListLobbiesResponse, error) {
+	out := new(ListLobbiesResponse)
+	err := c.cc.Invoke(ctx, LobbyService_ListLobbies_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lobbyServiceClient) CreateLobby(ctx context.Context, in *CreateLobbyRequest, opts ...grpc.CallOption) (*CreateLobbyResponse, error) {
+	out := new(CreateLobbyResponse)
+	err := c.cc.Invoke(ctx, LobbyService_CreateLobby_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lobbyServiceClient) DeleteLobby(ctx context.Context, in *DeleteLobbyRequest, opts ...grpc.CallOption) (*DeleteLobbyResponse, error) {
+	out := new(DeleteLobbyResponse)
+	err := c.cc.Invoke(ctx, LobbyService_DeleteLobby_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lobbyServiceClient) Publish(ctx context.Context, in *PublishRequest, opts ...grpc.CallOption) (*PublishResponse, error) {
+	out := new(PublishResponse)
+	err := c.cc.Invoke(ctx, LobbyService_Publish_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lobbyServiceClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (LobbyService_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &LobbyService_ServiceDesc.Streams[0], LobbyService_Subscribe_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &lobbyServiceSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type LobbyService_SubscribeClient interface {
+	Recv() (*Message, error)
+	grpc.ClientStream
+}
+
+type lobbyServiceSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *lobbyServiceSubscribeClient) Recv() (*Message, error) {
+	m := new(Message)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LobbyServiceServer is the server API for LobbyService service.
+// All implementations must embed UnimplementedLobbyServiceServer
+// for forward compatibility
+type LobbyServiceServer interface {
+	// ListLobbies returns every lobby.
+	ListLobbies(context.Context, *ListLobbiesRequest) (*ListLobbiesResponse, error)
+	// CreateLobby creates a lobby and returns its id.
+	CreateLobby(context.Context, *CreateLobbyRequest) (*CreateLobbyResponse, error)
+	// DeleteLobby deletes a lobby, ending the subscriptions to it.
+	DeleteLobby(context.Context, *DeleteLobbyRequest) (*DeleteLobbyResponse, error)
+	// Publish sends a text message to a lobby.
+	// Callers publishing too fast are refused with RESOURCE_EXHAUSTED.
+	Publish(context.Context, *PublishRequest) (*PublishResponse, error)
+	// Subscribe streams the messages of a lobby until the client cancels or
+	// the lobby is closed.
+	Subscribe(*SubscribeRequest, LobbyService_SubscribeServer) error
+	mustEmbedUnimplementedLobbyServiceServer()
+}
+
+// UnimplementedLobbyServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedLobbyServiceServer struct {
+}
+
+func (UnimplementedLobbyServiceServer) ListLobbies(context.Context, *ListLobbiesRequest) (*ListLobbiesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListLobbies not implemented")
+}
+func (UnimplementedLobbyServiceServer) CreateLobby(context.Context, *CreateLobbyRequest) (*CreateLobbyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateLobby not implemented")
+}
+func (UnimplementedLobbyServiceServer) DeleteLobby(context.Context, *DeleteLobbyRequest) (*DeleteLobbyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteLobby not implemented")
+}
+func (UnimplementedLobbyServiceServer) Publish(context.Context, *PublishRequest) (*PublishResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Publish not implemented")
+}
+func (UnimplementedLobbyServiceServer) Subscribe(*SubscribeRequest, LobbyService_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedLobbyServiceServer) mustEmbedUnimplementedLobbyServiceServer() {}
+
+// UnsafeLobbyServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LobbyServiceServer will
+// result in compilation errors.
+type UnsafeLobbyServiceServer interface {
+	mustEmbedUnimplementedLobbyServiceServer()
+}
+
+func RegisterLobbyServiceServer(s grpc.ServiceRegistrar, srv LobbyServiceServer) {
+	s.RegisterService(&LobbyService_ServiceDesc, srv)
+}
+
+func _LobbyService_ListLobbies_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListLobbiesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LobbyServiceServer).ListLobbies(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LobbyService_ListLobbies_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LobbyServiceServer).ListLobbies(ctx, req.(*ListLobbiesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LobbyService_CreateLobby_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateLobbyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LobbyServiceServer).CreateLobby(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LobbyService_CreateLobby_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LobbyServiceServer).CreateLobby(ctx, req.(*CreateLobbyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LobbyService_DeleteLobby_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteLobbyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LobbyServiceServer).DeleteLobby(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LobbyService_DeleteLobby_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LobbyServiceServer).DeleteLobby(ctx, req.(*DeleteLobbyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LobbyService_Publish_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PublishRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LobbyServiceServer).Publish(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LobbyService_Publish_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LobbyServiceServer).Publish(ctx, req.(*PublishRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LobbyService_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LobbyServiceServer).Subscribe(m, &lobbyServiceSubscribeServer{stream})
+}
+
+type LobbyService_SubscribeServer interface {
+	Send(*Message) error
+	grpc.ServerStream
+}
+
+type lobbyServiceSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *lobbyServiceSubscribeServer) Send(m *Message) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// LobbyService_ServiceDesc is the grpc.ServiceDesc for LobbyService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var LobbyService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "masterserver.lobby.v1.LobbyService",
+	HandlerType: (*LobbyServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListLobbies",
+			Handler:    _LobbyService_ListLobbies_Handler,
+		},
+		{
+			MethodName: "CreateLobby",
+			Handler:    _LobbyService_CreateLobby_Handler,
+		},
+		{
+			MethodName: "DeleteLobby",
+			Handler:    _LobbyService_DeleteLobby_Handler,
+		},
+		{
+			MethodName: "Publish",
+			Handler:    _LobbyService_Publish_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _LobbyService_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "masterserver/lobby/v1/lobby.proto",
+}
@@ -0,0 +1,77 @@
+package grpcserver
+
+import (
+	"github.com/lukaspj/go-masterserver/pkg/grpcserver/lobbypb"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func MapLobbyToProto(l lobby.Lobby) *lobbypb.Lobby {
+	return &lobbypb.Lobby{
+		Id:          l.Id,
+		Name:        l.Name,
+		Created:     timestamppb.New(l.Created),
+		Subscribers: int32(l.Subscribers),
+	}
+}
+
+func MapLobbiesToProto(ls []lobby.Lobby) []*lobbypb.Lobby {
+	lobbies := make([]*lobbypb.Lobby, len(ls))
+	for i, l := range ls {
+		lobbies[i] = MapLobbyToProto(l)
+	}
+	return lobbies
+}
+
+func MapMessageToProto(m lobby.Message) *lobbypb.Message {
+	msg := &lobbypb.Message{
+		Seq:        m.Seq,
+		Sender:     m.Sender,
+		Recipients: m.Recipients,
+	}
+
+	switch m.Type {
+	case lobby.TextMessageType:
+		msg.Content = &lobbypb.Message_Text{Text: &lobbypb.TextMessage{
+			Content: m.Text.Content,
+			Created: timestamppb.New(m.Text.Created),
+		}}
+	case lobby.MetaMessageType:
+		msg.Content = &lobbypb.Message_Meta{Meta: &lobbypb.MetaMessage{
+			Id:          m.Meta.Id,
+			Name:        m.Meta.Name,
+			Subscribers: int32(m.Meta.Subscribers),
+			LastSeq:     m.Meta.LastSeq,
+		}}
+	case lobby.GapMessageType:
+		msg.Content = &lobbypb.Message_Gap{Gap: &lobbypb.GapMessage{
+			From: m.Gap.From,
+			To:   m.Gap.To,
+		}}
+	case lobby.DataMessageType:
+		msg.Content = &lobbypb.Message_Data{Data: &lobbypb.DataMessage{
+			Subtype: m.Data.Subtype,
+			Payload: m.Data.Payload,
+			Created: timestamppb.New(m.Data.Created),
+		}}
+	case lobby.NoticeMessageType:
+		msg.Content = &lobbypb.Message_Notice{Notice: &lobbypb.NoticeMessage{
+			Kind:    string(m.Notice.Kind),
+			Content: m.Notice.Content,
+			Created: timestamppb.New(m.Notice.Created),
+		}}
+	case lobby.ReadyMessageType:
+		msg.Content = &lobbypb.Message_Ready{Ready: &lobbypb.ReadyMessage{
+			Ready:   m.Ready.Ready,
+			Created: timestamppb.New(m.Ready.Created),
+		}}
+	case lobby.MembershipMessageType:
+		msg.Content = &lobbypb.Message_Membership{Membership: &lobbypb.MembershipMessage{
+			Event:    string(m.Membership.Event),
+			PlayerId: m.Membership.PlayerId,
+			Created:  timestamppb.New(m.Membership.Created),
+		}}
+	}
+
+	return msg
+}
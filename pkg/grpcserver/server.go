@@ -0,0 +1,354 @@
+// Package grpcserver serves the lobbies over gRPC, as described by
+// proto/masterserver/lobby/v1/lobby.proto.
+package grpcserver
+
+//go:generate buf generate --template ../../buf.gen.yaml --output ../.. ../../proto
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/lukaspj/go-masterserver/pkg/admin"
+	"github.com/lukaspj/go-masterserver/pkg/grpcserver/lobbypb"
+	"github.com/lukaspj/go-masterserver/pkg/identity"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"github.com/lukaspj/go-masterserver/pkg/session"
+	"github.com/lukaspj/go-masterserver/pkg/tlsconfig"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"net"
+	"strings"
+	"sync/atomic"
+)
+
+type Server struct {
+	// Addr is the address the server listens on.
+	//
+	// Defaults to ":3002".
+	Addr string
+
+	LobbyService *lobby.Service
+
+	// Logger controls where logs are sent.
+	// Defaults to slog.Default().
+	Logger *slog.Logger
+
+	// Bans rejects calls from banned addresses and players.
+	// Defaults to nil, which bans nobody.
+	Bans *admin.BanList
+
+	// TLSConfig serves gRPC over TLS when set. Clients presenting a
+	// verified certificate are identified by its common name.
+	// Defaults to nil, which serves plaintext.
+	TLSConfig *tls.Config
+
+	// Identities verifies the session tokens callers without a client
+	// certificate identify with.
+	// Defaults to nil, which leaves such callers anonymous.
+	Identities *identity.Signer
+
+	// PublishLimits limits the rate at which each player, or address of
+	// anonymous players, may call Publish, which is not limited by a
+	// session.
+	// Defaults to the defaults of session.NewLimits.
+	PublishLimits *session.Limits
+
+	listening atomic.Bool
+}
+
+func NewServer(service *lobby.Service) *Server {
+	return &Server{
+		Addr:          ":3002",
+		LobbyService:  service,
+		Logger:        slog.Default(),
+		PublishLimits: session.NewLimits(),
+	}
+}
+
+// Listening is a health.Check reporting whether the server has bound its
+// address.
+func (s *Server) Listening(_ context.Context) error {
+	if !s.listening.Load() {
+		return errors.New("grpc server is not listening")
+	}
+	return nil
+}
+
+// ListenAndServe serves until ctx is done, then stops accepting calls and
+// waits for those in flight to finish.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Serve serves calls accepted on listener as ListenAndServe does.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	options := []grpc.ServerOption{
+		grpc.UnaryInterceptor(s.unaryInterceptor),
+		grpc.StreamInterceptor(s.streamInterceptor),
+	}
+	if s.TLSConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(s.TLSConfig)))
+	}
+	grpcServer := grpc.NewServer(options...)
+	lobbypb.RegisterLobbyServiceServer(grpcServer, &lobbyServer{server: s})
+
+	s.listening.Store(true)
+	defer s.listening.Store(false)
+
+	stop := context.AfterFunc(ctx, grpcServer.GracefulStop)
+	defer stop()
+
+	err := grpcServer.Serve(listener)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (s *Server) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := s.identify(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkBanned(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.identify(ss.Context())
+	if err != nil {
+		return err
+	}
+	if err := s.checkBanned(ctx, info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, identifiedStream{ServerStream: ss, ctx: ctx})
+}
+
+// identifiedStream carries the context of the identified caller to the
+// handler of a stream.
+type identifiedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s identifiedStream) Context() context.Context {
+	return s.ctx
+}
+
+type playerIdKey struct{}
+
+// identify establishes the player of a call, which is the common name of
+// its verified client certificate or else the player a session token was
+// issued for. The token is sent as a bearer token in the authorization
+// metadata, and calls with an invalid token are refused.
+func (s *Server) identify(ctx context.Context) (context.Context, error) {
+	var id string
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			id = tlsconfig.PeerIdentity(&info.State)
+		}
+	}
+
+	values := metadata.ValueFromIncomingContext(ctx, "authorization")
+	if id == "" && len(values) > 0 {
+		token, _ := strings.CutPrefix(values[0], "Bearer ")
+		var err error
+		if s.Identities != nil {
+			id, err = s.Identities.Verify(token)
+		} else {
+			err = identity.ErrInvalidToken
+		}
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+	}
+	return context.WithValue(ctx, playerIdKey{}, id), nil
+}
+
+// checkBanned refuses calls from banned addresses and players.
+func (s *Server) checkBanned(ctx context.Context, method string) error {
+	remoteAddr := remoteAddr(ctx)
+	ban, ok := s.Bans.AddrBanned(remoteAddr)
+	if !ok {
+		ban, ok = s.Bans.PlayerBanned(playerId(ctx))
+	}
+	if ok {
+		s.Logger.Info("rejected banned call",
+			slog.String("remote_addr", remoteAddr),
+			slog.String("method", method),
+			slog.String("ban", ban.Value),
+		)
+		return status.Error(codes.PermissionDenied, "banned")
+	}
+	return nil
+}
+
+func remoteAddr(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	return p.Addr.String()
+}
+
+// playerId returns the player established by identify, empty for
+// anonymous callers.
+func playerId(ctx context.Context) string {
+	id, _ := ctx.Value(playerIdKey{}).(string)
+	return id
+}
+
+// lobbyServer implements the LobbyService of the proto on top of the
+// lobby.Service of the Server.
+type lobbyServer struct {
+	lobbypb.UnimplementedLobbyServiceServer
+	server *Server
+}
+
+var _ lobbypb.LobbyServiceServer = &lobbyServer{}
+
+func (ls *lobbyServer) ListLobbies(ctx context.Context, _ *lobbypb.ListLobbiesRequest) (*lobbypb.ListLobbiesResponse, error) {
+	lobbies, err := ls.server.LobbyService.List(ctx)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &lobbypb.ListLobbiesResponse{Lobbies: MapLobbiesToProto(lobbies)}, nil
+}
+
+func (ls *lobbyServer) CreateLobby(ctx context.Context, req *lobbypb.CreateLobbyRequest) (*lobbypb.CreateLobbyResponse, error) {
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing required name")
+	}
+
+	lobbyId, err := ls.server.LobbyService.Create(ctx, req.GetName())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &lobbypb.CreateLobbyResponse{Id: lobbyId}, nil
+}
+
+func (ls *lobbyServer) DeleteLobby(ctx context.Context, req *lobbypb.DeleteLobbyRequest) (*lobbypb.DeleteLobbyResponse, error) {
+	err := ls.server.LobbyService.Delete(ctx, req.GetId())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &lobbypb.DeleteLobbyResponse{}, nil
+}
+
+func (ls *lobbyServer) Publish(ctx context.Context, req *lobbypb.PublishRequest) (*lobbypb.PublishResponse, error) {
+	if !ls.server.PublishLimits.Allow(playerId(ctx), remoteAddr(ctx)) {
+		return nil, status.Error(codes.ResourceExhausted, "publishing too fast")
+	}
+	err := ls.server.LobbyService.Publish(ctx, req.GetLobbyId(), playerId(ctx), []byte(req.GetContent()), req.GetRecipients())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &lobbypb.PublishResponse{}, nil
+}
+
+func (ls *lobbyServer) Subscribe(req *lobbypb.SubscribeRequest, stream lobbypb.LobbyService_SubscribeServer) error {
+	ctx := stream.Context()
+	conn := newStreamConnection(stream, remoteAddr(ctx))
+
+	sess := session.New(ls.server.LobbyService, conn, playerId(ctx))
+	sess.Logger = ls.server.Logger.With(slog.String("remote_addr", conn.remoteAddr))
+	err := sess.Serve(ctx, func(ctx context.Context) error {
+		return sess.Subscribe(ctx, req.GetLobbyId(), req.GetSince())
+	})
+	if errors.Is(err, lobby.ErrClosed) {
+		return nil
+	}
+	if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, lobby.ErrNotFound) &&
+		!errors.Is(err, lobby.ErrKicked) && !errors.Is(err, lobby.ErrDisconnected) {
+		sess.Logger.Error("subscription failed", slog.String("lobby_id", req.GetLobbyId()), slog.Any("error", err))
+	}
+	return statusError(err)
+}
+
+// statusError translates errors of the lobby service to gRPC statuses.
+func statusError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, lobby.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, lobby.ErrExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, lobby.ErrRejected):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, lobby.ErrKicked):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, lobby.ErrDisconnected):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, lobby.ErrTooSlow):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+// StreamConnection writes lobby messages to the stream of a Subscribe
+// call. gRPC keeps the connection alive itself, so it is not a
+// session.Pinger.
+type StreamConnection struct {
+	stream     lobbypb.LobbyService_SubscribeServer
+	remoteAddr string
+	// sending holds a token while a message is sent, for as long as the
+	// send blocks, which may outlive the write that started it.
+	sending chan struct{}
+}
+
+// newStreamConnection constructs the connection of a client reached at
+// remoteAddr through stream.
+func newStreamConnection(stream lobbypb.LobbyService_SubscribeServer, remoteAddr string) StreamConnection {
+	return StreamConnection{stream: stream, remoteAddr: remoteAddr, sending: make(chan struct{}, 1)}
+}
+
+var _ session.Transport = StreamConnection{}
+
+// WriteMessage gives up once ctx is done, which ends the session and with
+// it the stream, unblocking the send. Messages written in the meantime are
+// refused, as a stream cannot send two messages at once.
+func (sc StreamConnection) WriteMessage(ctx context.Context, message lobby.Message) error {
+	select {
+	case sc.sending <- struct{}{}:
+	default:
+		return errors.New("a message that took too long to send is still being sent")
+	}
+
+	sent := make(chan error, 1)
+	go func() {
+		err := sc.stream.Send(MapMessageToProto(message))
+		<-sc.sending
+		sent <- err
+	}()
+
+	select {
+	case err := <-sent:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (sc StreamConnection) Name() string {
+	return "grpc"
+}
+
+func (sc StreamConnection) RemoteAddr() string {
+	return sc.remoteAddr
+}
@@ -0,0 +1,209 @@
+package grpcserver
+
+import (
+	"context"
+	"github.com/lukaspj/go-masterserver/pkg/grpcserver/lobbypb"
+	"github.com/lukaspj/go-masterserver/pkg/identity"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"testing"
+	"time"
+)
+
+// dial serves the lobbies of service over an in-memory connection until
+// the test ends, and returns a client of them.
+func dial(t *testing.T, service *lobby.Service) lobbypb.LobbyServiceClient {
+	t.Helper()
+	return dialServer(t, NewServer(service))
+}
+
+// dialServer serves s over an in-memory connection like dial.
+func dialServer(t *testing.T, s *Server) lobbypb.LobbyServiceClient {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Serve(ctx, listener)
+	}()
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		cancel()
+		<-done
+	})
+	return lobbypb.NewLobbyServiceClient(conn)
+}
+
+func TestCreateListAndDeleteLobbies(t *testing.T) {
+	client := dial(t, lobby.NewService())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	created, err := client.CreateLobby(ctx, &lobbypb.CreateLobbyRequest{Name: "rumble"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := client.ListLobbies(ctx, &lobbypb.ListLobbiesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.GetLobbies()) != 1 || list.GetLobbies()[0].GetId() != created.GetId() || list.GetLobbies()[0].GetName() != "rumble" {
+		t.Fatalf("listed %v, want the created lobby", list.GetLobbies())
+	}
+
+	_, err = client.DeleteLobby(ctx, &lobbypb.DeleteLobbyRequest{Id: created.GetId()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.DeleteLobby(ctx, &lobbypb.DeleteLobbyRequest{Id: created.GetId()})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("deleting a deleted lobby: got %v, want NotFound", err)
+	}
+}
+
+func TestCreateLobbyRequiresName(t *testing.T) {
+	client := dial(t, lobby.NewService())
+
+	_, err := client.CreateLobby(context.Background(), &lobbypb.CreateLobbyRequest{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("got %v, want InvalidArgument", err)
+	}
+}
+
+func TestSubscribeReceivesPublishedMessages(t *testing.T) {
+	client := dial(t, lobby.NewService())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	created, err := client.CreateLobby(ctx, &lobbypb.CreateLobbyRequest{Name: "rumble"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Publish(ctx, &lobbypb.PublishRequest{LobbyId: created.GetId(), Content: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := client.Subscribe(ctx, &lobbypb.SubscribeRequest{LobbyId: created.GetId()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text := msg.GetText(); text != nil {
+			if text.GetContent() != "hello" || msg.GetSeq() == 0 {
+				t.Errorf("received %v, want the published message", msg)
+			}
+			return
+		}
+	}
+}
+
+func TestSubscribeToUnknownLobby(t *testing.T) {
+	client := dial(t, lobby.NewService())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.Subscribe(ctx, &lobbypb.SubscribeRequest{LobbyId: "missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stream.Recv()
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("got %v, want NotFound", err)
+	}
+}
+
+func TestCallersIdentifyWithSessionTokens(t *testing.T) {
+	service := lobby.NewService()
+	s := NewServer(service)
+	s.Identities = identity.NewSigner([]byte("0123456789abcdef0123456789abcdef"))
+	client := dialServer(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	created, err := client.CreateLobby(ctx, &lobbypb.CreateLobbyRequest{Name: "whispers"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	whisper := &lobbypb.PublishRequest{LobbyId: created.GetId(), Content: "psst", Recipients: []string{"bob"}}
+
+	alice, _ := s.Identities.Issue("alice")
+	_, err = client.Publish(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+alice), whisper)
+	if err != nil {
+		t.Errorf("whisper from alice: %v", err)
+	}
+
+	_, err = client.Publish(metadata.AppendToOutgoingContext(ctx, "x-player-id", "alice"), whisper)
+	if status.Code(err) == codes.OK {
+		t.Error("whisper from a player claimed by metadata was published")
+	}
+	_, err = client.Publish(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer alice"), whisper)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("whisper with a forged token returned %v, want %s", err, codes.Unauthenticated)
+	}
+}
+
+// stuckStream is a Subscribe stream whose sends block until unblocked.
+type stuckStream struct {
+	lobbypb.LobbyService_SubscribeServer
+	unblock chan struct{}
+}
+
+func (s stuckStream) Send(*lobbypb.Message) error {
+	<-s.unblock
+	return nil
+}
+
+func TestStreamWritesGiveUpWhenTheContextEnds(t *testing.T) {
+	stream := stuckStream{unblock: make(chan struct{})}
+	conn := newStreamConnection(stream, "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := conn.WriteMessage(ctx, lobby.Message{Type: lobby.TextMessageType, Text: lobby.TextMessage{Content: "stuck"}})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("blocked write returned %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	err = conn.WriteMessage(context.Background(), lobby.Message{Type: lobby.TextMessageType, Text: lobby.TextMessage{Content: "next"}})
+	if err == nil {
+		t.Errorf("write during a blocked send succeeded, want an error")
+	}
+
+	// The abandoned send finishes in the background once unblocked.
+	close(stream.unblock)
+	deadline := time.Now().Add(time.Second)
+	for {
+		err = conn.WriteMessage(context.Background(), lobby.Message{Type: lobby.TextMessageType, Text: lobby.TextMessage{Content: "after"}})
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Errorf("write after the send was unblocked returned %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Check reports whether a dependency of the server is usable, returning nil
+// if it is.
+type Check func(ctx context.Context) error
+
+// Checker aggregates the readiness checks of the server.
+type Checker struct {
+	// Timeout bounds how long all checks may take together.
+	//
+	// Defaults to 2 seconds.
+	Timeout time.Duration
+
+	checks map[string]Check
+	mu     sync.RWMutex
+}
+
+func NewChecker() *Checker {
+	return &Checker{
+		Timeout: time.Second * 2,
+		checks:  make(map[string]Check),
+	}
+}
+
+// Add registers a check under name, replacing any check of the same name.
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks[name] = check
+}
+
+// Check runs every check concurrently and returns the error of each by name.
+func (c *Checker) Check(ctx context.Context) map[string]error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	results := make(map[string]error, len(c.checks))
+	var resultsMu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range c.checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			err := check(ctx)
+			resultsMu.Lock()
+			results[name] = err
+			resultsMu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	return results
+}
+
+type CheckResponse struct {
+	Name  string `json:"name"`
+	Ok    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type StatusResponse struct {
+	Status string          `json:"status"`
+	Checks []CheckResponse `json:"checks,omitempty"`
+}
+
+// LivenessHandler reports that the process is up and serving requests.
+func LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, StatusResponse{Status: "ok"})
+}
+
+// ReadinessHandler runs every check and responds with 503 Service
+// Unavailable if any of them fails.
+func (c *Checker) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	results := c.Check(r.Context())
+
+	response := StatusResponse{Status: "ok"}
+	for name, err := range results {
+		check := CheckResponse{Name: name, Ok: err == nil}
+		if err != nil {
+			check.Error = err.Error()
+			response.Status = "unavailable"
+		}
+		response.Checks = append(response.Checks, check)
+	}
+	sort.Slice(response.Checks, func(i, j int) bool {
+		return response.Checks[i].Name < response.Checks[j].Name
+	})
+
+	status := http.StatusOK
+	if response.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, response)
+}
+
+type VersionResponse struct {
+	Path      string `json:"path"`
+	Version   string `json:"version"`
+	GoVersion string `json:"goVersion"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified"`
+}
+
+// Version returns the build information embedded in the binary.
+func Version() VersionResponse {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return VersionResponse{Version: "unknown"}
+	}
+
+	version := VersionResponse{
+		Path:      info.Main.Path,
+		Version:   info.Main.Version,
+		GoVersion: info.GoVersion,
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			version.Revision = setting.Value
+		case "vcs.time":
+			version.Time = setting.Value
+		case "vcs.modified":
+			version.Modified = setting.Value == "true"
+		}
+	}
+	return version
+}
+
+// VersionHandler responds with the build information of the binary.
+func VersionHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, Version())
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,338 @@
+package httpserver
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/lukaspj/go-masterserver/pkg/admin"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"github.com/lukaspj/go-masterserver/pkg/logging"
+	"github.com/lukaspj/go-masterserver/pkg/moderation"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// adminRoutes lets operators inspect and intervene on the server. Every
+// route requires the admin token as a bearer token.
+func (s *Server) adminRoutes(r chi.Router) {
+	r.Use(s.requireAdminToken)
+
+	r.Get("/connections", s.listConnectionsHandler)
+	r.Post("/lobby/{lobbyId}/kick", s.kickHandler)
+	r.Post("/lobby/{lobbyId}/close", s.closeLobbyHandler)
+	r.Post("/lobby/{lobbyId}/notices", s.notifyHandler)
+	r.Get("/bans", s.listBansHandler)
+	r.Post("/bans", s.banHandler)
+	r.Delete("/bans/{kind}/{value}", s.unbanHandler)
+	r.Post("/announcements", s.announceHandler)
+	if s.Identities != nil {
+		r.Post("/tokens", s.issueTokenHandler)
+	}
+
+	if s.Moderation != nil {
+		r.Get("/moderation", s.getDefaultPolicyHandler)
+		r.Put("/moderation", s.setDefaultPolicyHandler)
+		r.Get("/lobby/{lobbyId}/moderation", s.getLobbyPolicyHandler)
+		r.Put("/lobby/{lobbyId}/moderation", s.setLobbyPolicyHandler)
+		r.Delete("/lobby/{lobbyId}/moderation", s.resetLobbyPolicyHandler)
+		r.Get("/mutes", s.listMutesHandler)
+		r.Post("/mutes", s.muteHandler)
+		r.Delete("/mutes/{playerId}", s.unmuteHandler)
+	}
+}
+
+func (s *Server) requireAdminToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			renderError(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rejectBanned refuses requests from banned addresses and players.
+func (s *Server) rejectBanned(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ban, ok := s.Bans.AddrBanned(r.RemoteAddr)
+		if !ok {
+			ban, ok = s.Bans.PlayerBanned(playerId(r))
+		}
+		if ok {
+			logging.ForRequest(s.Logger, r).Info("rejected banned request", slog.String("ban", ban.Value))
+			renderError(w, r, http.StatusForbidden, http.StatusText(http.StatusForbidden))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) listConnectionsHandler(w http.ResponseWriter, r *http.Request) {
+	render.RenderList(w, r, MapConnectionsToResponseRenderer(s.LobbyService.Connections()))
+}
+
+func (s *Server) kickHandler(w http.ResponseWriter, r *http.Request) {
+	lobbyId := chi.URLParam(r, "lobbyId")
+
+	data := KickRequest{}
+	if err := render.Bind(r, &data); err != nil {
+		renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	kicked := s.LobbyService.Kick(lobbyId, data.PlayerId, data.Reason)
+	if kicked == 0 {
+		renderError(w, r, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	render.JSON(w, r, CountResponse{Count: kicked})
+}
+
+func (s *Server) closeLobbyHandler(w http.ResponseWriter, r *http.Request) {
+	lobbyId := chi.URLParam(r, "lobbyId")
+
+	data := CloseLobbyRequest{}
+	if err := render.Bind(r, &data); err != nil {
+		renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err := s.LobbyService.CloseLobby(r.Context(), lobbyId, data.Reason)
+	if errors.Is(err, lobby.ErrNotFound) {
+		renderError(w, r, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
+
+func (s *Server) listBansHandler(w http.ResponseWriter, r *http.Request) {
+	render.RenderList(w, r, MapBansToResponseRenderer(s.Bans.List()))
+}
+
+// banHandler bans a player or address and disconnects the connections the
+// ban applies to.
+func (s *Server) banHandler(w http.ResponseWriter, r *http.Request) {
+	data := BanRequest{}
+	if err := render.Bind(r, &data); err != nil {
+		renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ban := admin.Ban{
+		Kind:   admin.BanKind(data.Kind),
+		Value:  data.Value,
+		Reason: data.Reason,
+	}
+	if data.Duration != "" {
+		duration, err := time.ParseDuration(data.Duration)
+		if err != nil || duration <= 0 {
+			renderError(w, r, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+			return
+		}
+		ban.Expires = time.Now().Add(duration)
+	}
+
+	ban, err := s.Bans.Add(ban)
+	if errors.Is(err, admin.ErrInvalidBan) {
+		renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	disconnected := s.LobbyService.Disconnect(func(info lobby.ConnectionInfo) bool {
+		return ban.Matches(info.PlayerId, info.RemoteAddr)
+	}, ban.Reason)
+
+	response := MapBanToResponse(ban)
+	response.Disconnected = disconnected
+	render.Status(r, http.StatusCreated)
+	render.Render(w, r, response)
+}
+
+func (s *Server) unbanHandler(w http.ResponseWriter, r *http.Request) {
+	kind := admin.BanKind(chi.URLParam(r, "kind"))
+	// Networks in CIDR notation arrive with their slash escaped.
+	value, err := url.PathUnescape(chi.URLParam(r, "value"))
+	if err != nil {
+		renderError(w, r, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	if !s.Bans.Remove(kind, value) {
+		renderError(w, r, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
+
+func (s *Server) announceHandler(w http.ResponseWriter, r *http.Request) {
+	data := AnnouncementRequest{}
+	if err := render.Bind(r, &data); err != nil {
+		renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	reached, err := s.LobbyService.Announce(r.Context(), data.Content)
+	if err != nil {
+		logging.ForRequest(s.Logger, r).Error("announcement failed", slog.Int("reached", reached), slog.Any("error", err))
+		renderError(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	render.JSON(w, r, CountResponse{Count: reached})
+}
+
+// issueTokenHandler issues a session token for a player the backend of the
+// game has authenticated, which the player identifies with from then on.
+func (s *Server) issueTokenHandler(w http.ResponseWriter, r *http.Request) {
+	data := TokenRequest{}
+	if err := render.Bind(r, &data); err != nil {
+		renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	token, expires := s.Identities.Issue(data.PlayerId)
+	render.Status(r, http.StatusCreated)
+	render.Render(w, r, TokenResponse{Token: token, Expires: expires})
+}
+
+// notifyHandler sends a notice to some of the players in a lobby, which
+// no one else in the lobby sees.
+func (s *Server) notifyHandler(w http.ResponseWriter, r *http.Request) {
+	lobbyId := chi.URLParam(r, "lobbyId")
+
+	data := NotifyRequest{}
+	if err := render.Bind(r, &data); err != nil {
+		renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err := s.LobbyService.Notify(r.Context(), lobbyId, data.PlayerIds, data.Content)
+	if errors.Is(err, lobby.ErrNotFound) {
+		renderError(w, r, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
+
+func (s *Server) getDefaultPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, s.Moderation.DefaultPolicy())
+}
+
+func (s *Server) setDefaultPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	policy := moderation.Policy{}
+	if err := render.DecodeJSON(r.Body, &policy); err != nil {
+		renderError(w, r, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	s.Moderation.SetDefaultPolicy(policy)
+	render.JSON(w, r, policy)
+}
+
+func (s *Server) getLobbyPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	lobbyId := chi.URLParam(r, "lobbyId")
+
+	policy, custom := s.Moderation.Policy(lobbyId)
+	render.JSON(w, r, ModerationPolicyResponse{Policy: policy, Custom: custom})
+}
+
+// setLobbyPolicyHandler gives an existing lobby a policy of its own.
+// Fields missing from the request keep their value in the default policy.
+func (s *Server) setLobbyPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	lobbyId := chi.URLParam(r, "lobbyId")
+
+	_, err := s.LobbyService.Get(r.Context(), lobbyId)
+	if errors.Is(err, lobby.ErrNotFound) {
+		renderError(w, r, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	policy := s.Moderation.DefaultPolicy()
+	if err := render.DecodeJSON(r.Body, &policy); err != nil {
+		renderError(w, r, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	s.Moderation.SetPolicy(lobbyId, policy)
+	render.JSON(w, r, ModerationPolicyResponse{Policy: policy, Custom: true})
+}
+
+func (s *Server) resetLobbyPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	lobbyId := chi.URLParam(r, "lobbyId")
+
+	if !s.Moderation.ResetPolicy(lobbyId) {
+		renderError(w, r, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
+
+func (s *Server) listMutesHandler(w http.ResponseWriter, r *http.Request) {
+	render.RenderList(w, r, MapMutesToResponseRenderer(s.Moderation.Mutes.List()))
+}
+
+func (s *Server) muteHandler(w http.ResponseWriter, r *http.Request) {
+	data := MuteRequest{}
+	if err := render.Bind(r, &data); err != nil {
+		renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	mute := moderation.Mute{
+		PlayerId: data.PlayerId,
+		LobbyId:  data.LobbyId,
+		Reason:   data.Reason,
+	}
+	if data.Duration != "" {
+		duration, err := time.ParseDuration(data.Duration)
+		if err != nil || duration <= 0 {
+			renderError(w, r, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+			return
+		}
+		mute.Expires = time.Now().Add(duration)
+	}
+
+	mute = s.Moderation.Mutes.Add(mute)
+	render.Status(r, http.StatusCreated)
+	render.Render(w, r, MapMuteToResponse(mute))
+}
+
+// unmuteHandler lifts the mute of a player, in the lobby given by the lobby
+// query parameter or otherwise their mute in every lobby.
+func (s *Server) unmuteHandler(w http.ResponseWriter, r *http.Request) {
+	playerId := chi.URLParam(r, "playerId")
+
+	if !s.Moderation.Mutes.Remove(playerId, r.URL.Query().Get("lobby")) {
+		renderError(w, r, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
@@ -0,0 +1,106 @@
+package httpserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"nhooyr.io/websocket"
+	"strings"
+)
+
+// The websocket subprotocols clients can ask for in Sec-WebSocket-Protocol
+// to choose how frames are encoded. Clients that ask for none are sent JSON
+// text frames holding every section of lobby messages, as before
+// subprotocols were offered.
+const (
+	// SubprotocolJSON sends JSON text frames without the unused sections of
+	// lobby messages.
+	SubprotocolJSON = "masterserver.json"
+	// SubprotocolMessagePack sends MessagePack binary frames without the
+	// unused sections of lobby messages.
+	SubprotocolMessagePack = "masterserver.msgpack"
+	// SubprotocolCBOR sends CBOR binary frames without the unused sections
+	// of lobby messages.
+	SubprotocolCBOR = "masterserver.cbor"
+)
+
+// subprotocols are offered to clients in order of preference.
+var subprotocols = []string{SubprotocolMessagePack, SubprotocolCBOR, SubprotocolJSON}
+
+// socketCodec encodes the frames sent over a websocket, and decodes those
+// received, in the encoding of the subprotocol agreed with the client.
+// Frames keep the field names of their JSON tags in every encoding.
+type socketCodec struct {
+	// frame is the type of the frames written, and expected from the
+	// client.
+	frame websocket.MessageType
+	// compact leaves the unused sections out of lobby messages.
+	compact   bool
+	marshal   func(v any) ([]byte, error)
+	unmarshal func(data []byte, v any) error
+}
+
+var jsonCodec = socketCodec{
+	frame:     websocket.MessageText,
+	marshal:   json.Marshal,
+	unmarshal: json.Unmarshal,
+}
+
+// cborEncMode writes times as RFC 3339 strings, as in JSON, rather than
+// the default of whole seconds.
+var cborEncMode, _ = cbor.EncOptions{
+	Time:    cbor.TimeRFC3339Nano,
+	TimeTag: cbor.EncTagRequired,
+}.EncMode()
+
+// codecFor returns the codec of the subprotocol agreed with the client.
+func codecFor(subprotocol string) socketCodec {
+	switch strings.ToLower(subprotocol) {
+	case SubprotocolJSON:
+		codec := jsonCodec
+		codec.compact = true
+		return codec
+	case SubprotocolMessagePack:
+		return socketCodec{
+			frame:     websocket.MessageBinary,
+			compact:   true,
+			marshal:   marshalMessagePack,
+			unmarshal: unmarshalMessagePack,
+		}
+	case SubprotocolCBOR:
+		return socketCodec{
+			frame:     websocket.MessageBinary,
+			compact:   true,
+			marshal:   cborEncMode.Marshal,
+			unmarshal: cbor.Unmarshal,
+		}
+	default:
+		return jsonCodec
+	}
+}
+
+func marshalMessagePack(v any) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	enc := msgpack.NewEncoder(buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	err := enc.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func unmarshalMessagePack(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+func frameName(typ websocket.MessageType) string {
+	if typ == websocket.MessageBinary {
+		return "binary"
+	}
+	return "text"
+}
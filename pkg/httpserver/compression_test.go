@@ -0,0 +1,142 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"nhooyr.io/websocket"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingConn counts the bytes read from the connection.
+type countingConn struct {
+	net.Conn
+	read *atomic.Int64
+}
+
+func (c countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+func lobbyListPayload(tb testing.TB, n int) []byte {
+	tb.Helper()
+
+	lobbies := make([]lobby.Lobby, n)
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := range lobbies {
+		lobbies[i] = lobby.Lobby{
+			Id:          uuid.NewString(),
+			Name:        fmt.Sprintf("EU West #%d - capture the flag, casual", i),
+			Created:     created.Add(time.Duration(i) * time.Minute),
+			Subscribers: i % 16,
+		}
+	}
+	payload, err := json.Marshal(lobbies)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return payload
+}
+
+// receiveFrames has the server send count copies of payload over a
+// websocket accepted with its options, and returns the bytes the client
+// read for them and the handshake.
+func receiveFrames(tb testing.TB, s *Server, payload []byte, count int) int64 {
+	tb.Helper()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, s.acceptOptions())
+		if err != nil {
+			return
+		}
+		defer conn.Close(websocket.StatusInternalError, "")
+		for i := 0; i < count; i++ {
+			err = conn.Write(r.Context(), websocket.MessageText, payload)
+			if err != nil {
+				return
+			}
+		}
+		conn.Close(websocket.StatusNormalClosure, "")
+	}))
+	defer ts.Close()
+
+	read := new(atomic.Int64)
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return countingConn{conn, read}, nil
+		},
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(ts.URL, "http"), &websocket.DialOptions{
+		HTTPClient:      client,
+		CompressionMode: websocket.CompressionNoContextTakeover,
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+	conn.SetReadLimit(int64(len(payload)) + 1)
+
+	for i := 0; i < count; i++ {
+		_, got, err := conn.Read(ctx)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if len(got) != len(payload) {
+			tb.Fatalf("read %d bytes, want %d", len(got), len(payload))
+		}
+	}
+	return read.Load()
+}
+
+func TestSocketCompressionShrinksLargeMessages(t *testing.T) {
+	payload := lobbyListPayload(t, 100)
+
+	s := NewServer(lobby.NewService())
+	compressed := receiveFrames(t, s, payload, 1)
+	s.SocketCompression = websocket.CompressionDisabled
+	plain := receiveFrames(t, s, payload, 1)
+
+	if compressed >= plain/2 {
+		t.Errorf("read %d bytes compressed and %d plain, want less than half", compressed, plain)
+	}
+}
+
+// BenchmarkSocketLobbyList reports the bytes read by a client for a JSON
+// list of 100 lobbies with and without permessage-deflate, as wire-B/op.
+func BenchmarkSocketLobbyList(b *testing.B) {
+	modes := []struct {
+		name string
+		mode websocket.CompressionMode
+	}{
+		{"disabled", websocket.CompressionDisabled},
+		{"no_context_takeover", websocket.CompressionNoContextTakeover},
+	}
+	payload := lobbyListPayload(b, 100)
+	for _, m := range modes {
+		b.Run(m.name, func(b *testing.B) {
+			s := NewServer(lobby.NewService())
+			s.SocketCompression = m.mode
+
+			b.ResetTimer()
+			read := receiveFrames(b, s, payload, b.N)
+			b.ReportMetric(float64(read)/float64(b.N), "wire-B/op")
+			b.ReportMetric(100*(1-float64(read)/float64(b.N)/float64(len(payload))), "%saved")
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package httpserver
+
+import (
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"net/http"
+	"strings"
+)
+
+// renderError writes an ErrorResponse with the status and message, and the
+// id of the request so that clients can point operators at its logs. The
+// unversioned lobby routes answer with the message in plain text instead,
+// as they did before the API was versioned.
+func renderError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if isLegacy(r) {
+		http.Error(w, message, status)
+		return
+	}
+	render.Render(w, r, ErrorResponse{
+		HTTPStatusCode: status,
+		Code:           errorCode(status),
+		Message:        message,
+		RequestId:      middleware.GetReqID(r.Context()),
+	})
+}
+
+// errorCode names a status for programs to match on, such as "not_found"
+// for 404.
+func errorCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	renderError(w, r, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+}
+
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	renderError(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+}
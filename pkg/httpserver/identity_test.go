@@ -0,0 +1,201 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/lukaspj/go-masterserver/pkg/identity"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"nhooyr.io/websocket"
+	"strings"
+	"testing"
+	"time"
+)
+
+// request makes a request to the server with the headers, and returns the
+// status and body of the response.
+func request(t *testing.T, handler http.Handler, method string, target string, body string, headers map[string]string) (int, string) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code, rec.Body.String()
+}
+
+func bearer(token string) map[string]string {
+	return map[string]string{"Authorization": "Bearer " + token}
+}
+
+func TestPlayersIdentifyWithSessionTokens(t *testing.T) {
+	service := lobby.NewService()
+	id, err := service.Create(context.Background(), "whispers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(service)
+	s.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	s.Identities = identity.NewSigner([]byte("0123456789abcdef0123456789abcdef"))
+	handler := s.Handler()
+	alice, _ := s.Identities.Issue("alice")
+	bob, _ := s.Identities.Issue("bob")
+
+	lobbyPath := "/v1/lobby/" + id + "/"
+	status, body := request(t, handler, http.MethodPost, lobbyPath+"?to=bob", "psst", bearer(alice))
+	if status != http.StatusAccepted {
+		t.Fatalf("whisper from alice answered %d %s, want 202", status, body)
+	}
+
+	// Claims that are not backed by a token identify no one, and anonymous
+	// players cannot whisper.
+	for name, headers := range map[string]map[string]string{
+		"anonymous":          nil,
+		"claimed by header":  {"X-Player-Id": "alice"},
+		"claimed by query":   nil,
+		"claimed by a guess": bearer("alice"),
+	} {
+		target := lobbyPath + "?to=bob"
+		if name == "claimed by query" {
+			target += "&player=alice"
+		}
+		status, body := request(t, handler, http.MethodPost, target, "psst", headers)
+		want := http.StatusUnprocessableEntity
+		if name == "claimed by a guess" {
+			want = http.StatusUnauthorized
+		}
+		if status != want {
+			t.Errorf("%s whisper answered %d %s, want %d", name, status, body, want)
+		}
+	}
+
+	history := func(headers map[string]string, query string) []lobby.Message {
+		t.Helper()
+		status, body := request(t, handler, http.MethodGet, lobbyPath+"messages"+query, "", headers)
+		if status != http.StatusOK {
+			t.Fatalf("history answered %d %s", status, body)
+		}
+		var messages []lobby.Message
+		err := json.Unmarshal([]byte(body), &messages)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return messages
+	}
+	if messages := history(bearer(bob), ""); len(messages) != 1 || messages[0].Sender != "alice" {
+		t.Errorf("bob sees %+v, want the whisper from alice", messages)
+	}
+	if messages := history(nil, "?token="+url.QueryEscape(bob)); len(messages) != 1 {
+		t.Errorf("bob identified by query parameter sees %d messages, want 1", len(messages))
+	}
+	if messages := history(map[string]string{"X-Player-Id": "bob"}, "?player=bob"); len(messages) != 0 {
+		t.Errorf("someone claiming to be bob sees %d messages, want none", len(messages))
+	}
+}
+
+func TestTokensAreIssuedThroughTheAdminAPI(t *testing.T) {
+	s := NewServer(lobby.NewService())
+	s.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	s.AdminToken = "admin"
+	s.Identities = identity.NewSigner([]byte("0123456789abcdef0123456789abcdef"))
+	handler := s.Handler()
+
+	headers := bearer("admin")
+	headers["Content-Type"] = "application/json"
+	status, body := request(t, handler, http.MethodPost, "/admin/tokens", `{"playerId":"alice"}`, headers)
+	if status != http.StatusCreated {
+		t.Fatalf("issuing a token answered %d %s, want 201", status, body)
+	}
+	var issued TokenResponse
+	err := json.Unmarshal([]byte(body), &issued)
+	if err != nil {
+		t.Fatal(err)
+	}
+	playerId, err := s.Identities.Verify(issued.Token)
+	if err != nil || playerId != "alice" {
+		t.Errorf("issued token names %q (%v), want alice", playerId, err)
+	}
+
+	status, _ = request(t, handler, http.MethodPost, "/admin/tokens", `{"playerId":"alice"}`, map[string]string{"Content-Type": "application/json"})
+	if status != http.StatusUnauthorized {
+		t.Errorf("issuing a token without the admin token answered %d, want 401", status)
+	}
+}
+
+func TestAnonymousSocketsCannotWhisper(t *testing.T) {
+	service := lobby.NewService()
+	id, err := service.Create(context.Background(), "whispers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(service)
+	s.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(ts.URL, "http")+"/v1/lobby/"+id+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	// read returns the next frame of the type, skipping the others.
+	read := func(typ string) map[string]any {
+		t.Helper()
+		for {
+			_, data, err := conn.Read(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var frame map[string]any
+			err = json.Unmarshal(data, &frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if frame["type"] == typ {
+				return frame
+			}
+		}
+	}
+	send := func(command string) map[string]any {
+		t.Helper()
+		err := conn.Write(ctx, websocket.MessageText, []byte(command))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return read("ack")
+	}
+	read("meta")
+
+	ack := send(`{"id":"1","command":"send","content":"psst","recipients":["bob"]}`)
+	if ack["ok"] != false || !strings.Contains(fmt.Sprint(ack["error"]), "identified") {
+		t.Errorf("anonymous whisper acknowledged with %v, want it refused", ack)
+	}
+	ack = send(`{"id":"2","command":"ready"}`)
+	if ack["ok"] != false {
+		t.Errorf("anonymous ready acknowledged with %v, want it refused", ack)
+	}
+	ack = send(`{"id":"3","command":"send","content":"hello"}`)
+	if ack["ok"] != true {
+		t.Errorf("anonymous message to the lobby acknowledged with %v, want it sent", ack)
+	}
+
+	messages, err := service.History(ctx, id, "bob", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range messages {
+		if len(msg.Recipients) > 0 {
+			t.Errorf("bob received a whisper from %q", msg.Sender)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"net/http"
+)
+
+// legacyLobbyRoutes are the lobby routes from before the API was versioned,
+// kept for older clients. They answer with the shapes those clients know,
+// and point them at their successors under /v1.
+func (s *Server) legacyLobbyRoutes(r chi.Router) {
+	r.Use(legacy)
+	r.Use(s.identify)
+	r.Use(s.rejectBanned)
+
+	r.Get("/lobby", s.legacyListLobbiesHandler)
+	r.Post("/lobby", s.legacyCreateLobbyHandler)
+	r.Get("/lobby/watch", s.watchLobbiesHandler)
+	r.Route("/lobby/{lobbyId}", func(r chi.Router) {
+		r.Get("/", s.subscribeHandler)
+		r.Get("/events", s.eventsHandler)
+		r.Get("/messages", s.historyHandler)
+		r.Post("/", s.publishHandler)
+		r.Post("/data/{subtype}", s.publishDataHandler)
+		r.Patch("/", s.legacyUpdateLobbyHandler)
+		r.Delete("/", s.legacyDeleteLobbyHandler)
+	})
+}
+
+type legacyKey struct{}
+
+// legacy marks the responses of unversioned routes as deprecated, with a
+// link to the same route under /v1, and tells the handlers to answer as
+// they did before the API was versioned.
+func legacy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", fmt.Sprintf(`</v1%s>; rel="successor-version"`, r.URL.EscapedPath()))
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), legacyKey{}, true)))
+	})
+}
+
+func isLegacy(r *http.Request) bool {
+	legacy, _ := r.Context().Value(legacyKey{}).(bool)
+	return legacy
+}
+
+// renderPublished answers a published message with the PublishResponse, or
+// with an empty body on the unversioned routes.
+func renderPublished(w http.ResponseWriter, r *http.Request, published PublishResponse) {
+	if isLegacy(r) {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	render.Status(r, http.StatusAccepted)
+	render.Render(w, r, published)
+}
+
+// legacyListLobbiesHandler answers with the lobbies as they are stored.
+func (s *Server) legacyListLobbiesHandler(w http.ResponseWriter, r *http.Request) {
+	lobbies, err := s.LobbyService.List(r.Context())
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	render.JSON(w, r, lobbies)
+}
+
+// legacyCreateLobbyHandler answers with only the id of the lobby, and
+// accepts lobbies without a name.
+func (s *Server) legacyCreateLobbyHandler(w http.ResponseWriter, r *http.Request) {
+	data := CreateLobbyRequest{}
+	if err := render.Decode(r, &data); err != nil {
+		renderError(w, r, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	lobbyId, err := s.LobbyService.Create(r.Context(), data.Name)
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	render.JSON(w, r, lobbyId)
+}
+
+func (s *Server) legacyUpdateLobbyHandler(w http.ResponseWriter, r *http.Request) {
+	lobbyId := chi.URLParam(r, "lobbyId")
+
+	data := UpdateLobbyRequest{}
+	if err := render.Bind(r, &data); err != nil {
+		renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err := s.LobbyService.Rename(r.Context(), lobbyId, data.Name)
+	if errors.Is(err, lobby.ErrNotFound) {
+		renderError(w, r, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) legacyDeleteLobbyHandler(w http.ResponseWriter, r *http.Request) {
+	lobbyId := chi.URLParam(r, "lobbyId")
+
+	err := s.LobbyService.Delete(r.Context(), lobbyId)
+	if errors.Is(err, lobby.ErrNotFound) {
+		renderError(w, r, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,76 @@
+package httpserver
+
+import (
+	"context"
+	"github.com/lukaspj/go-masterserver/pkg/identity"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestPublishesAreThrottled(t *testing.T) {
+	service := lobby.NewService()
+	id, err := service.Create(context.Background(), "throttled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(service)
+	s.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	s.Identities = identity.NewSigner([]byte("0123456789abcdef0123456789abcdef"))
+	s.PublishLimits.Limit = rate.Every(time.Hour)
+	handler := s.Handler()
+	alice, _ := s.Identities.Issue("alice")
+	bob, _ := s.Identities.Issue("bob")
+
+	publish := func(path string, headers map[string]string, remoteAddr string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/v1/lobby/"+id+path, nil)
+		req.RemoteAddr = remoteAddr
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Text and data messages share the limit of the player, whatever
+	// address they come from.
+	for i := 0; i < s.PublishLimits.Burst; i++ {
+		path := "/"
+		if i%2 == 1 {
+			path = "/data/move"
+		}
+		if rec := publish(path, bearer(alice), "192.0.2.1:4000"); rec.Code != http.StatusAccepted {
+			t.Fatalf("publish %d of alice answered %d %s, want 202", i, rec.Code, rec.Body)
+		}
+	}
+	for _, path := range []string{"/", "/data/move"} {
+		rec := publish(path, bearer(alice), "192.0.2.2:4000")
+		if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+			t.Errorf("publish to %s past the burst of alice answered %d, want 429 with Retry-After", path, rec.Code)
+		}
+	}
+	if rec := publish("/", bearer(bob), "192.0.2.1:4000"); rec.Code != http.StatusAccepted {
+		t.Errorf("publish of bob answered %d, want 202", rec.Code)
+	}
+
+	// Anonymous players are limited by address.
+	for i := 0; i < s.PublishLimits.Burst; i++ {
+		if rec := publish("/", nil, "198.51.100.1:4000"); rec.Code != http.StatusAccepted {
+			t.Fatalf("anonymous publish %d answered %d %s, want 202", i, rec.Code, rec.Body)
+		}
+	}
+	if rec := publish("/", nil, "198.51.100.1:4001"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("anonymous publish past the burst answered %d, want 429", rec.Code)
+	}
+	if rec := publish("/", nil, "198.51.100.2:4000"); rec.Code != http.StatusAccepted {
+		t.Errorf("anonymous publish from another address answered %d, want 202", rec.Code)
+	}
+}
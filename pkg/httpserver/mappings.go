@@ -2,7 +2,9 @@ package httpserver
 
 import (
 	"github.com/go-chi/render"
+	"github.com/lukaspj/go-masterserver/pkg/admin"
 	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"github.com/lukaspj/go-masterserver/pkg/moderation"
 )
 
 func MapLobbyToResponse(l lobby.Lobby) LobbyResponse {
@@ -21,3 +23,100 @@ func MapLobbiesToResponseRenderer(ls []lobby.Lobby) []render.Renderer {
 	}
 	return lobbyResponses
 }
+
+func MapLobbyEventToResponse(e lobby.LobbyEvent) LobbyEventResponse {
+	return LobbyEventResponse{
+		Type:  string(e.Type),
+		Lobby: MapLobbyToResponse(e.Lobby),
+		Time:  e.Time,
+	}
+}
+
+func MapMessageToSocketMessage(m lobby.Message) SocketMessage {
+	msg := SocketMessage{
+		Seq:        m.Seq,
+		Type:       m.Type,
+		Sender:     m.Sender,
+		Recipients: m.Recipients,
+	}
+
+	switch m.Type {
+	case lobby.TextMessageType:
+		msg.Text = &m.Text
+	case lobby.MetaMessageType:
+		msg.Meta = &m.Meta
+	case lobby.GapMessageType:
+		msg.Gap = &m.Gap
+	case lobby.DataMessageType:
+		msg.Data = &m.Data
+	case lobby.NoticeMessageType:
+		msg.Notice = &m.Notice
+	case lobby.ReadyMessageType:
+		msg.Ready = &m.Ready
+	case lobby.MembershipMessageType:
+		msg.Membership = &m.Membership
+	}
+
+	return msg
+}
+
+func MapConnectionToResponse(c lobby.ConnectionInfo) ConnectionResponse {
+	return ConnectionResponse{
+		Id:         c.Id,
+		PlayerId:   c.PlayerId,
+		RemoteAddr: c.RemoteAddr,
+		Transport:  c.Transport,
+		Connected:  c.Connected,
+		Lobbies:    c.Lobbies,
+	}
+}
+
+func MapConnectionsToResponseRenderer(cs []lobby.ConnectionInfo) []render.Renderer {
+	connectionResponses := make([]render.Renderer, len(cs), len(cs))
+	for i, c := range cs {
+		connectionResponses[i] = MapConnectionToResponse(c)
+	}
+	return connectionResponses
+}
+
+func MapBanToResponse(b admin.Ban) BanResponse {
+	response := BanResponse{
+		Kind:    string(b.Kind),
+		Value:   b.Value,
+		Reason:  b.Reason,
+		Created: b.Created,
+	}
+	if !b.Expires.IsZero() {
+		response.Expires = &b.Expires
+	}
+	return response
+}
+
+func MapBansToResponseRenderer(bs []admin.Ban) []render.Renderer {
+	banResponses := make([]render.Renderer, len(bs), len(bs))
+	for i, b := range bs {
+		banResponses[i] = MapBanToResponse(b)
+	}
+	return banResponses
+}
+
+func MapMuteToResponse(m moderation.Mute) MuteResponse {
+	response := MuteResponse{
+		PlayerId: m.PlayerId,
+		LobbyId:  m.LobbyId,
+		Reason:   m.Reason,
+		Created:  m.Created,
+	}
+	if !m.Expires.IsZero() {
+		response.Expires = &m.Expires
+	}
+	return response
+}
+
+func MapMutesToResponseRenderer(ms []moderation.Mute) []render.Renderer {
+	muteResponses := make([]render.Renderer, len(ms), len(ms))
+	for i, m := range ms {
+		muteResponses[i] = MapMuteToResponse(m)
+	}
+	return muteResponses
+}
@@ -1,7 +1,11 @@
 package httpserver
 
 import (
+	"encoding/json"
+	"errors"
 	"github.com/go-chi/render"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"github.com/lukaspj/go-masterserver/pkg/moderation"
 	"net/http"
 	"time"
 )
@@ -19,12 +23,282 @@ func (l LobbyResponse) Render(w http.ResponseWriter, r *http.Request) error {
 
 var _ render.Renderer = LobbyResponse{}
 
+// ErrorResponse is the body of every error of the API.
+type ErrorResponse struct {
+	HTTPStatusCode int `json:"-"`
+	// Code names the kind of error for programs, such as "not_found".
+	Code string `json:"code"`
+	// Message explains the error to people.
+	Message string `json:"message"`
+	// RequestId identifies the request in the logs of the server.
+	RequestId string `json:"requestId,omitempty"`
+}
+
+func (e ErrorResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	render.Status(r, e.HTTPStatusCode)
+	return nil
+}
+
+var _ render.Renderer = ErrorResponse{}
+
 type CreateLobbyRequest struct {
 	Name string `json:"name"`
 }
 
 func (c CreateLobbyRequest) Bind(r *http.Request) error {
+	if c.Name == "" {
+		return errors.New("name is required")
+	}
 	return nil
 }
 
 var _ render.Binder = CreateLobbyRequest{}
+
+type UpdateLobbyRequest struct {
+	Name string `json:"name"`
+}
+
+func (u UpdateLobbyRequest) Bind(r *http.Request) error {
+	if u.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+var _ render.Binder = UpdateLobbyRequest{}
+
+// PublishResponse tells that a message was accepted for delivery to the
+// lobby, whispered to the recipients if any.
+type PublishResponse struct {
+	LobbyId    string   `json:"lobbyId"`
+	Recipients []string `json:"recipients,omitempty"`
+}
+
+func (p PublishResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+var _ render.Renderer = PublishResponse{}
+
+type LobbyEventResponse struct {
+	Type  string        `json:"type"`
+	Lobby LobbyResponse `json:"lobby"`
+	Time  time.Time     `json:"time"`
+}
+
+// SocketMessage is a lobby message as sent to websocket clients that agree
+// to a subprotocol, holding only the section of its type.
+type SocketMessage struct {
+	Seq        uint64                   `json:"seq,omitempty"`
+	Type       lobby.MessageType        `json:"type"`
+	Text       *lobby.TextMessage       `json:"text,omitempty"`
+	Meta       *lobby.MetaMessage       `json:"meta,omitempty"`
+	Gap        *lobby.GapMessage        `json:"gap,omitempty"`
+	Data       *lobby.DataMessage       `json:"data,omitempty"`
+	Notice     *lobby.NoticeMessage     `json:"notice,omitempty"`
+	Ready      *lobby.ReadyMessage      `json:"ready,omitempty"`
+	Membership *lobby.MembershipMessage `json:"membership,omitempty"`
+	Sender     string                   `json:"sender,omitempty"`
+	Recipients []string                 `json:"recipients,omitempty"`
+}
+
+type ConnectionResponse struct {
+	Id         string    `json:"id"`
+	PlayerId   string    `json:"playerId"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Transport  string    `json:"transport"`
+	Connected  time.Time `json:"connected"`
+	Lobbies    []string  `json:"lobbies"`
+}
+
+func (c ConnectionResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+var _ render.Renderer = ConnectionResponse{}
+
+type KickRequest struct {
+	PlayerId string `json:"playerId"`
+	Reason   string `json:"reason"`
+}
+
+func (k KickRequest) Bind(r *http.Request) error {
+	if k.PlayerId == "" {
+		return errors.New("playerId is required")
+	}
+	return nil
+}
+
+var _ render.Binder = KickRequest{}
+
+type TokenRequest struct {
+	PlayerId string `json:"playerId"`
+}
+
+func (t TokenRequest) Bind(r *http.Request) error {
+	if t.PlayerId == "" {
+		return errors.New("playerId is required")
+	}
+	return nil
+}
+
+var _ render.Binder = TokenRequest{}
+
+type TokenResponse struct {
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+func (t TokenResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+var _ render.Renderer = TokenResponse{}
+
+type CloseLobbyRequest struct {
+	Reason string `json:"reason"`
+}
+
+func (c CloseLobbyRequest) Bind(r *http.Request) error {
+	return nil
+}
+
+var _ render.Binder = CloseLobbyRequest{}
+
+type BanRequest struct {
+	Kind   string `json:"kind"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+	// Duration is a Go duration such as "24h", empty for permanent bans.
+	Duration string `json:"duration"`
+}
+
+func (b BanRequest) Bind(r *http.Request) error {
+	return nil
+}
+
+var _ render.Binder = BanRequest{}
+
+type BanResponse struct {
+	Kind    string     `json:"kind"`
+	Value   string     `json:"value"`
+	Reason  string     `json:"reason"`
+	Created time.Time  `json:"created"`
+	Expires *time.Time `json:"expires,omitempty"`
+	// Disconnected is the number of connections the ban closed.
+	Disconnected int `json:"disconnected,omitempty"`
+}
+
+func (b BanResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+var _ render.Renderer = BanResponse{}
+
+type AnnouncementRequest struct {
+	Content string `json:"content"`
+}
+
+func (a AnnouncementRequest) Bind(r *http.Request) error {
+	if a.Content == "" {
+		return errors.New("content is required")
+	}
+	return nil
+}
+
+var _ render.Binder = AnnouncementRequest{}
+
+type NotifyRequest struct {
+	PlayerIds []string `json:"playerIds"`
+	Content   string   `json:"content"`
+}
+
+func (n NotifyRequest) Bind(r *http.Request) error {
+	if len(n.PlayerIds) == 0 {
+		return errors.New("playerIds is required")
+	}
+	if n.Content == "" {
+		return errors.New("content is required")
+	}
+	return nil
+}
+
+var _ render.Binder = NotifyRequest{}
+
+type CountResponse struct {
+	Count int `json:"count"`
+}
+
+type MuteRequest struct {
+	PlayerId string `json:"playerId"`
+	// LobbyId limits the mute to a single lobby, empty mutes the player in
+	// every lobby.
+	LobbyId string `json:"lobbyId"`
+	Reason  string `json:"reason"`
+	// Duration is a Go duration such as "10m", empty for permanent mutes.
+	Duration string `json:"duration"`
+}
+
+func (m MuteRequest) Bind(r *http.Request) error {
+	if m.PlayerId == "" {
+		return errors.New("playerId is required")
+	}
+	return nil
+}
+
+var _ render.Binder = MuteRequest{}
+
+type MuteResponse struct {
+	PlayerId string     `json:"playerId"`
+	LobbyId  string     `json:"lobbyId,omitempty"`
+	Reason   string     `json:"reason"`
+	Created  time.Time  `json:"created"`
+	Expires  *time.Time `json:"expires,omitempty"`
+}
+
+func (m MuteResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+var _ render.Renderer = MuteResponse{}
+
+type ModerationPolicyResponse struct {
+	moderation.Policy
+	// Custom tells whether the lobby has a policy of its own rather than
+	// the default.
+	Custom bool `json:"custom"`
+}
+
+// SocketCommand is a frame websocket clients send to act on the lobby they
+// are subscribed to.
+type SocketCommand struct {
+	// Id is chosen by the client and echoed in the acknowledgement.
+	Id string `json:"id"`
+	// Command is one of "send", "ready", "leave" or "ping".
+	Command string `json:"command"`
+	// Content is the text of the message to send. Given a Subtype, Payload
+	// is sent as a data message instead.
+	Content string          `json:"content,omitempty"`
+	Subtype string          `json:"subtype,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// Recipients whispers the message to only these players.
+	Recipients []string `json:"recipients,omitempty"`
+	// Ready sets whether the player is ready, nil toggles it.
+	Ready *bool `json:"ready,omitempty"`
+}
+
+// SocketAck acknowledges a SocketCommand. It is told apart from lobby
+// messages by its type of "ack".
+type SocketAck struct {
+	Type    string `json:"type"`
+	Id      string `json:"id"`
+	Command string `json:"command"`
+	Ok      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+	// Ready is whether the player is ready after a ready command.
+	Ready *bool `json:"ready,omitempty"`
+	// Time is the time of the server when it answered a ping, whose
+	// payload is echoed back.
+	Time    *time.Time      `json:"time,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
@@ -0,0 +1,17 @@
+package httpserver
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPI describes the lobby API under /v1. It is written by hand, so
+// update it along with the routes and models.
+//
+//go:embed openapi.json
+var openAPI []byte
+
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPI)
+}
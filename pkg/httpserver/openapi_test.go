@@ -0,0 +1,315 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type openAPIDocument struct {
+	Servers []struct {
+		Url string `json:"url"`
+	} `json:"servers"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+	components map[string]any
+}
+
+type operation struct {
+	Responses map[string]struct {
+		Ref     string `json:"$ref"`
+		Content map[string]struct {
+			Schema *schema `json:"schema"`
+		} `json:"content"`
+	} `json:"responses"`
+}
+
+type schema struct {
+	Ref        string             `json:"$ref"`
+	Type       string             `json:"type"`
+	Enum       []any              `json:"enum"`
+	Required   []string           `json:"required"`
+	Properties map[string]*schema `json:"properties"`
+	Items      *schema            `json:"items"`
+	OneOf      []*schema          `json:"oneOf"`
+}
+
+func loadOpenAPI(t *testing.T) *openAPIDocument {
+	t.Helper()
+
+	var doc openAPIDocument
+	err := json.Unmarshal(openAPI, &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw struct {
+		Components map[string]any `json:"components"`
+	}
+	err = json.Unmarshal(openAPI, &raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.components = raw.Components
+	return &doc
+}
+
+// operation returns the operation documented for the method on the path.
+func (d *openAPIDocument) operation(t *testing.T, method string, path string) operation {
+	t.Helper()
+
+	var op operation
+	err := json.Unmarshal(d.Paths[path][strings.ToLower(method)], &op)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	for status, response := range op.Responses {
+		if response.Ref == "" {
+			continue
+		}
+		name := strings.TrimPrefix(response.Ref, "#/components/responses/")
+		encoded, err := json.Marshal(d.components["responses"].(map[string]any)[name])
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = json.Unmarshal(encoded, &response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		op.Responses[status] = response
+	}
+	return op
+}
+
+// validate returns the first difference between the value and the schema.
+func (d *openAPIDocument) validate(s *schema, value any, at string) error {
+	if s.Ref != "" {
+		return d.validate(d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")], value, at)
+	}
+	if len(s.OneOf) > 0 {
+		for _, option := range s.OneOf {
+			if d.validate(option, value, at) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: %v matches none of its schemas", at, value)
+	}
+
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: %v is not an object", at, value)
+		}
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s: %s is missing", at, name)
+			}
+		}
+		if len(s.Properties) == 0 {
+			return nil
+		}
+		for name, property := range object {
+			if s.Properties[name] == nil {
+				return fmt.Errorf("%s: %s is not documented", at, name)
+			}
+			if err := d.validate(s.Properties[name], property, at+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: %v is not an array", at, value)
+		}
+		for i, item := range array {
+			if err := d.validate(s.Items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s: %v is not a string", at, value)
+		}
+	case "integer", "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s: %v is not a number", at, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: %v is not a boolean", at, value)
+		}
+	}
+	if len(s.Enum) > 0 {
+		for _, allowed := range s.Enum {
+			if value == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: %v is not one of %v", at, value, s.Enum)
+	}
+	return nil
+}
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	doc := loadOpenAPI(t)
+	if len(doc.Servers) != 1 || doc.Servers[0].Url != "/v1" {
+		t.Fatalf("servers %+v, want /v1", doc.Servers)
+	}
+
+	var documented []string
+	for path, item := range doc.Paths {
+		for method := range item {
+			if method != "parameters" {
+				documented = append(documented, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+
+	var routed []string
+	router := NewServer(lobby.NewService()).Handler().(chi.Routes)
+	err := chi.Walk(router, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		path, ok := strings.CutPrefix(route, "/v1")
+		if ok {
+			routed = append(routed, method+" "+strings.TrimSuffix(path, "/"))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(documented)
+	sort.Strings(routed)
+	if strings.Join(documented, "\n") != strings.Join(routed, "\n") {
+		t.Errorf("documented routes\n%s\nwant the routes under /v1\n%s", strings.Join(documented, "\n"), strings.Join(routed, "\n"))
+	}
+}
+
+func TestResponsesMatchTheOpenAPIDocument(t *testing.T) {
+	doc := loadOpenAPI(t)
+	s := NewServer(lobby.NewService())
+	s.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := s.Handler()
+
+	var lobbyId string
+	for _, test := range []struct {
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{http.MethodPost, "/lobby", `{"name":"documented"}`, http.StatusCreated},
+		{http.MethodPost, "/lobby", `{}`, http.StatusBadRequest},
+		{http.MethodGet, "/lobby", "", http.StatusOK},
+		{http.MethodPatch, "/lobby/{lobbyId}", `{"name":"renamed"}`, http.StatusOK},
+		{http.MethodPatch, "/lobby/{lobbyId}", `{}`, http.StatusBadRequest},
+		{http.MethodPost, "/lobby/{lobbyId}", "hello", http.StatusAccepted},
+		{http.MethodPost, "/lobby/{lobbyId}/data/{subtype}", `{"x":1}`, http.StatusAccepted},
+		{http.MethodGet, "/lobby/{lobbyId}/messages", "", http.StatusOK},
+		{http.MethodGet, "/lobby/{lobbyId}/messages?limit=0", "", http.StatusBadRequest},
+		{http.MethodDelete, "/lobby/{lobbyId}", "", http.StatusNoContent},
+		{http.MethodDelete, "/lobby/{lobbyId}", "", http.StatusNotFound},
+		{http.MethodPatch, "/lobby/{lobbyId}", `{"name":"renamed"}`, http.StatusNotFound},
+		{http.MethodPost, "/lobby/{lobbyId}", "hello", http.StatusNotFound},
+	} {
+		path, _, _ := strings.Cut(test.path, "?")
+		name := test.method + " " + test.path
+		target := "/v1" + strings.NewReplacer("{lobbyId}", lobbyId, "{subtype}", "move").Replace(test.path)
+		status, body := request(t, handler, test.method, target, test.body, map[string]string{"Content-Type": "application/json"})
+		if status != test.want {
+			t.Fatalf("%s answered %d %s, want %d", name, status, body, test.want)
+		}
+
+		response, ok := doc.operation(t, test.method, path).Responses[fmt.Sprint(status)]
+		if !ok {
+			t.Errorf("%s answered %d, which is not documented", name, status)
+			continue
+		}
+		content, ok := response.Content["application/json"]
+		if !ok {
+			if body != "" {
+				t.Errorf("%s answered %q, but no body is documented", name, body)
+			}
+			continue
+		}
+		var value any
+		err := json.Unmarshal([]byte(body), &value)
+		if err != nil {
+			t.Errorf("%s answered %q: %v", name, body, err)
+			continue
+		}
+		if err := doc.validate(content.Schema, value, "body"); err != nil {
+			t.Errorf("%s answered %s: %v", name, body, err)
+		}
+
+		if status == http.StatusCreated {
+			lobbyId = value.(map[string]any)["id"].(string)
+		}
+	}
+}
+
+func TestLegacyRoutesKeepTheirShapes(t *testing.T) {
+	service := lobby.NewService()
+	s := NewServer(service)
+	s.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := s.Handler()
+	headers := map[string]string{"Content-Type": "application/json"}
+
+	status, body := request(t, handler, http.MethodPost, "/lobby", `{}`, headers)
+	if status != http.StatusOK {
+		t.Fatalf("creating a lobby answered %d %s, want 200", status, body)
+	}
+	var lobbyId string
+	err := json.Unmarshal([]byte(body), &lobbyId)
+	if err != nil {
+		t.Fatalf("creating a lobby answered %s, want its id: %v", body, err)
+	}
+
+	status, body = request(t, handler, http.MethodGet, "/lobby", "", nil)
+	var lobbies []lobby.Lobby
+	err = json.Unmarshal([]byte(body), &lobbies)
+	if status != http.StatusOK || err != nil || len(lobbies) != 1 || lobbies[0].Id != lobbyId || !strings.Contains(body, `"Id"`) {
+		t.Errorf("listing lobbies answered %d %s, want the stored lobbies", status, body)
+	}
+
+	for _, test := range []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodPatch, "/lobby/" + lobbyId, `{"name":"renamed"}`},
+		{http.MethodPost, "/lobby/" + lobbyId, "hello"},
+		{http.MethodDelete, "/lobby/" + lobbyId, ""},
+	} {
+		status, body := request(t, handler, test.method, test.path, test.body, headers)
+		if status != http.StatusOK || body != "" {
+			t.Errorf("%s %s answered %d %q, want an empty 200", test.method, test.path, status, body)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/lobby/"+lobbyId, nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("deleting a deleted lobby answered %d %s, want a plain text 404", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if rec.Header().Get("Deprecation") != "true" {
+		t.Errorf("legacy route is not marked deprecated")
+	}
+
+	_, err = service.Get(context.Background(), lobbyId)
+	if err == nil {
+		t.Errorf("deleted lobby is still there")
+	}
+}
@@ -0,0 +1,63 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// realIP replaces the remote address of requests relayed by trusted proxies
+// with the address of the client they were relayed for, as found in the
+// X-Forwarded-For or X-Real-IP header. The headers of other requests are
+// ignored, as anyone can set them to evade bans and connection limits.
+func (s *Server) realIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if client, ok := s.forwardedFor(r); ok {
+			r.RemoteAddr = client.String()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedFor returns the address of the client a trusted proxy relayed
+// the request for. X-Forwarded-For is read from the right, where the
+// address each proxy appends is, skipping trusted proxies, so that
+// addresses the client put in front are never believed.
+func (s *Server) forwardedFor(r *http.Request) (netip.Addr, bool) {
+	peer, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil || !s.trustedProxy(peer.Addr()) {
+		return netip.Addr{}, false
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	if len(hops) == 0 {
+		client, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP")))
+		return client.Unmap(), err == nil
+	}
+
+	var client netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = hop.Unmap()
+		if !s.trustedProxy(client) {
+			break
+		}
+	}
+	return client, client.IsValid()
+}
+
+func (s *Server) trustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, network := range s.TrustedProxies {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
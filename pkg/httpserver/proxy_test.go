@@ -0,0 +1,70 @@
+package httpserver
+
+import (
+	"github.com/lukaspj/go-masterserver/pkg/admin"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestForwardingHeadersAreOnlyBelievedFromTrustedProxies(t *testing.T) {
+	s := NewServer(lobby.NewService())
+	s.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	for _, test := range []struct {
+		name       string
+		remoteAddr string
+		headers    map[string][]string
+		want       string
+	}{
+		{"direct", "203.0.113.7:4000", nil, "203.0.113.7:4000"},
+		{"spoofed by a client", "203.0.113.7:4000", map[string][]string{"X-Forwarded-For": {"198.51.100.1"}}, "203.0.113.7:4000"},
+		{"real ip spoofed by a client", "203.0.113.7:4000", map[string][]string{"X-Real-IP": {"198.51.100.1"}}, "203.0.113.7:4000"},
+		{"through a proxy", "10.0.0.2:4000", map[string][]string{"X-Forwarded-For": {"203.0.113.7"}}, "203.0.113.7"},
+		{"through a proxy setting X-Real-IP", "10.0.0.2:4000", map[string][]string{"X-Real-IP": {"203.0.113.7"}}, "203.0.113.7"},
+		{"through two proxies", "10.0.0.2:4000", map[string][]string{"X-Forwarded-For": {"203.0.113.7, 10.0.0.3"}}, "203.0.113.7"},
+		{"spoofed through a proxy", "10.0.0.2:4000", map[string][]string{"X-Forwarded-For": {"198.51.100.1, 203.0.113.7"}}, "203.0.113.7"},
+		{"spoofed in a header of its own", "10.0.0.2:4000", map[string][]string{"X-Forwarded-For": {"198.51.100.1", "203.0.113.7"}}, "203.0.113.7"},
+		{"garbage through a proxy", "10.0.0.2:4000", map[string][]string{"X-Forwarded-For": {"not an address"}}, "10.0.0.2:4000"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		for name, values := range test.headers {
+			for _, value := range values {
+				req.Header.Add(name, value)
+			}
+		}
+
+		var got string
+		s.realIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.RemoteAddr
+		})).ServeHTTP(httptest.NewRecorder(), req)
+		if got != test.want {
+			t.Errorf("%s: remote address %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestBannedAddressesCannotForwardTheirWayIn(t *testing.T) {
+	s := NewServer(lobby.NewService())
+	s.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	_, err := s.Bans.Add(admin.Ban{Kind: admin.IPBan, Value: "192.0.2.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := s.Handler()
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/lobby", nil)
+	req.RemoteAddr = "192.0.2.1:4000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	req.Header.Set("X-Real-IP", "198.51.100.1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("banned address with forwarding headers answered %d, want 403", rec.Code)
+	}
+}
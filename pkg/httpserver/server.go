@@ -2,74 +2,297 @@ package httpserver
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
 	"errors"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/go-chi/render"
+	"github.com/lukaspj/go-masterserver/pkg/admin"
+	"github.com/lukaspj/go-masterserver/pkg/health"
+	"github.com/lukaspj/go-masterserver/pkg/identity"
 	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"github.com/lukaspj/go-masterserver/pkg/logging"
+	"github.com/lukaspj/go-masterserver/pkg/metrics"
+	"github.com/lukaspj/go-masterserver/pkg/moderation"
+	"github.com/lukaspj/go-masterserver/pkg/session"
+	"github.com/lukaspj/go-masterserver/pkg/tlsconfig"
+	"github.com/lukaspj/go-masterserver/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"nhooyr.io/websocket"
+	"strconv"
+	"strings"
+	"sync/atomic"
 )
 
 type Server struct {
+	// Addr is the address the server listens on.
+	//
+	// Defaults to ":3000".
+	Addr string
+
 	LobbyService *lobby.Service
+
+	// Metrics records request latencies. It is not served by this server,
+	// see metrics.Metrics.Handler.
+	// Defaults to nil, which records nothing.
+	Metrics *metrics.Metrics
+
+	// Logger controls where logs are sent.
+	// Defaults to slog.Default().
+	Logger *slog.Logger
+
+	// Tracer records a span for every request.
+	// Defaults to the tracer of the global provider.
+	Tracer trace.Tracer
+
+	// Health runs the checks reported on /readyz.
+	// Defaults to a checker without checks.
+	Health *health.Checker
+
+	// Identities verifies the session tokens players without a client
+	// certificate identify with, and issues them through the admin API.
+	// Defaults to nil, which leaves such players anonymous.
+	Identities *identity.Signer
+
+	// AdminToken is the bearer token required by the admin API under
+	// /admin. Defaults to empty, which disables the admin API.
+	AdminToken string
+
+	// Bans rejects requests from banned addresses and players, and is
+	// managed through the admin API.
+	// Defaults to an empty ban list.
+	Bans *admin.BanList
+
+	// PublishLimits limits the rate at which each player, or address of
+	// anonymous players, may publish through the publish routes, which are
+	// not limited by a session.
+	// Defaults to the defaults of session.NewLimits.
+	PublishLimits *session.Limits
+
+	// TrustedProxies are the networks of the reverse proxies in front of
+	// the server, whose X-Forwarded-For and X-Real-IP headers tell the
+	// address of the client.
+	// Defaults to none, which takes the address of every connection as that
+	// of the client.
+	TrustedProxies []netip.Prefix
+
+	// Moderation is configured through the admin API when set.
+	// Defaults to nil, which leaves the moderation routes out.
+	Moderation *moderation.Moderator
+
+	// TLSConfig serves HTTPS and WSS when set. Clients presenting a
+	// verified certificate are identified by its common name.
+	// Defaults to nil, which serves plain HTTP.
+	TLSConfig *tls.Config
+
+	// SocketCompression is the permessage-deflate mode offered to websocket
+	// clients.
+	// Defaults to websocket.CompressionNoContextTakeover, which compresses
+	// every message on its own and keeps no state between them.
+	SocketCompression websocket.CompressionMode
+
+	// SocketCompressionThreshold is the size from which websocket messages
+	// are compressed.
+	// Defaults to 512 bytes.
+	SocketCompressionThreshold int
+
+	listening atomic.Bool
 }
 
 func NewServer(service *lobby.Service) *Server {
 	return &Server{
+		Addr:         ":3000",
 		LobbyService: service,
+		Logger:       slog.Default(),
+		Tracer:       otel.Tracer("github.com/lukaspj/go-masterserver/pkg/httpserver"),
+		Health:       health.NewChecker(),
+		Bans:         admin.NewBanList(),
+
+		PublishLimits: session.NewLimits(),
+
+		SocketCompression:          websocket.CompressionNoContextTakeover,
+		SocketCompressionThreshold: 512,
 	}
 }
 
+// Listening is a health.Check reporting whether the server has bound its
+// address.
+func (s *Server) Listening(_ context.Context) error {
+	if !s.listening.Load() {
+		return errors.New("http server is not listening")
+	}
+	return nil
+}
+
 func (s *Server) ListenAndServe() error {
+	handler := s.Handler()
+
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	if s.TLSConfig != nil {
+		listener = tls.NewListener(listener, s.TLSConfig)
+	}
+	s.listening.Store(true)
+	defer s.listening.Store(false)
+
+	return http.Serve(listener, handler)
+}
+
+// Handler returns the routes of the server, for serving with the options it
+// was configured with at the time.
+func (s *Server) Handler() http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
+	r.Use(s.realIP)
+	r.Use(logging.RequestLogger(s.Logger))
 	r.Use(middleware.Recoverer)
+	r.Use(s.Metrics.Middleware)
+	r.Use(tracing.Middleware(s.Tracer))
 
 	r.Use(cors.AllowAll().Handler)
 
+	r.Get("/healthz", health.LivenessHandler)
+	r.Get("/readyz", s.Health.ReadinessHandler)
+	r.Get("/version", health.VersionHandler)
+	if s.AdminToken != "" {
+		r.Route("/admin", s.adminRoutes)
+	}
+
+	r.NotFound(notFoundHandler)
+	r.MethodNotAllowed(methodNotAllowedHandler)
+	r.Get("/openapi.json", openAPIHandler)
+
+	r.Route("/v1", s.lobbyRoutes)
+	r.Group(s.legacyLobbyRoutes)
+
+	return r
+}
+
+// lobbyRoutes are the routes of the lobby API, described by the OpenAPI
+// document served on /openapi.json.
+func (s *Server) lobbyRoutes(r chi.Router) {
+	r.Use(s.identify)
+	r.Use(s.rejectBanned)
+
 	r.Get("/lobby", s.listLobbiesHandler)
 	r.Post("/lobby", s.createLobbyHandler)
+	r.Get("/lobby/watch", s.watchLobbiesHandler)
 	r.Route("/lobby/{lobbyId}", func(r chi.Router) {
 		r.Get("/", s.subscribeHandler)
+		r.Get("/events", s.eventsHandler)
+		r.Get("/messages", s.historyHandler)
 		r.Post("/", s.publishHandler)
+		r.Post("/data/{subtype}", s.publishDataHandler)
+		r.Patch("/", s.updateLobbyHandler)
 		r.Delete("/", s.deleteLobbyHandler)
 	})
+}
 
-	return http.ListenAndServe(":3000", r)
+// acceptOptions configures the websockets the server accepts.
+func (s *Server) acceptOptions() *websocket.AcceptOptions {
+	return &websocket.AcceptOptions{
+		Subprotocols:         subprotocols,
+		InsecureSkipVerify:   true,
+		CompressionMode:      s.SocketCompression,
+		CompressionThreshold: s.SocketCompressionThreshold,
+	}
 }
 
+// SocketConnection is the session transport of websocket clients, which
+// receive lobby messages as JSON text frames, or in the encoding of the
+// subprotocol they agreed to.
 type SocketConnection struct {
-	conn *websocket.Conn
+	conn       *websocket.Conn
+	codec      socketCodec
+	remoteAddr string
 }
 
+var _ session.Transport = SocketConnection{}
+var _ session.Pinger = SocketConnection{}
+
 func (sc SocketConnection) WriteMessage(ctx context.Context, message lobby.Message) error {
-	bytes, err := json.Marshal(message)
+	var v any = message
+	if sc.codec.compact {
+		v = MapMessageToSocketMessage(message)
+	}
+	bytes, err := sc.codec.marshal(v)
 	if err != nil {
 		return err
 	}
-	return sc.conn.Write(ctx, websocket.MessageText, bytes)
+	return sc.conn.Write(ctx, sc.codec.frame, bytes)
+}
+
+func (sc SocketConnection) Name() string {
+	return "websocket"
+}
+
+func (sc SocketConnection) Ping(ctx context.Context) error {
+	return sc.conn.Ping(ctx)
+}
+
+func (sc SocketConnection) RemoteAddr() string {
+	return sc.remoteAddr
 }
 
 func (s *Server) subscribeHandler(w http.ResponseWriter, r *http.Request) {
 	lobbyId := chi.URLParam(r, "lobbyId")
 
-	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{InsecureSkipVerify: true})
+	since, err := parseSince(r)
+	if err != nil {
+		renderError(w, r, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	logger := logging.ForRequest(s.Logger, r).With(slog.String("lobby_id", lobbyId))
+
+	conn, err := websocket.Accept(w, r, s.acceptOptions())
 	if err != nil {
-		s.LobbyService.Logf("%v", err)
+		logger.Warn("failed to accept websocket", slog.Any("error", err))
 		return
 	}
 	defer conn.Close(websocket.StatusInternalError, "")
 
-	ctx := conn.CloseRead(r.Context())
-	err = s.LobbyService.Subscribe(ctx, lobbyId, SocketConnection{conn})
-	if errors.Is(err, context.Canceled) {
+	codec := codecFor(conn.Subprotocol())
+	sess := session.New(s.LobbyService, SocketConnection{conn, codec, r.RemoteAddr}, playerId(r))
+	sess.Logger = logger
+	commands := &socketCommands{session: sess, conn: conn, codec: codec, lobbyId: lobbyId, logger: logger}
+
+	err = sess.Serve(r.Context(), func(ctx context.Context) error {
+		go commands.read(ctx)
+		return sess.Subscribe(ctx, lobbyId, since)
+	})
+	if errors.Is(err, errLeft) {
+		conn.Close(websocket.StatusNormalClosure, errLeft.Error())
+		return
+	}
+	if errors.Is(err, lobby.ErrTooSlow) {
+		conn.Close(websocket.StatusPolicyViolation, err.Error())
+		return
+	}
+	if errors.Is(err, lobby.ErrClosed) {
+		conn.Close(websocket.StatusNormalClosure, "lobby closed")
+		return
+	}
+	if errors.Is(err, lobby.ErrKicked) {
+		conn.Close(StatusKicked, err.Error())
+		return
+	}
+	if errors.Is(err, lobby.ErrDisconnected) {
+		conn.Close(StatusDisconnected, err.Error())
+		return
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, session.ErrKeepaliveFailed) {
 		return
 	}
 	if websocket.CloseStatus(err) == websocket.StatusNormalClosure ||
@@ -77,24 +300,214 @@ func (s *Server) subscribeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err != nil {
-		s.LobbyService.Logf("%v", err)
+		logger.Error("subscription failed", slog.Any("error", err))
+		return
+	}
+}
+
+// watchLobbiesHandler streams lobby lifecycle events over a WebSocket
+// until either side goes away.
+func (s *Server) watchLobbiesHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.ForRequest(s.Logger, r)
+
+	conn, err := websocket.Accept(w, r, s.acceptOptions())
+	if err != nil {
+		logger.Warn("failed to accept websocket", slog.Any("error", err))
 		return
 	}
+	defer conn.Close(websocket.StatusInternalError, "")
+
+	codec := codecFor(conn.Subprotocol())
+	ctx := conn.CloseRead(r.Context())
+	for event := range s.LobbyService.Watch(ctx) {
+		bytes, err := codec.marshal(MapLobbyEventToResponse(event))
+		if err != nil {
+			logger.Error("failed to encode lobby event", slog.Any("error", err))
+			return
+		}
+		err = conn.Write(ctx, codec.frame, bytes)
+		if err != nil {
+			return
+		}
+	}
+
+	if ctx.Err() == nil {
+		conn.Close(websocket.StatusPolicyViolation, "connection too slow to keep up with lobby events")
+	}
+}
+
+// Close codes in the range reserved for applications, telling clients not
+// to reconnect.
+const (
+	StatusKicked       websocket.StatusCode = 4001
+	StatusDisconnected websocket.StatusCode = 4003
+)
+
+type playerIdKey struct{}
+
+// identify establishes the player of the request, which is the common name
+// of its verified client certificate or else the player a session token
+// was issued for. The token is taken from the Authorization header as a
+// bearer token, or from the token query parameter for websockets and
+// EventSource, which cannot set headers. Requests with an invalid token are
+// refused rather than served anonymously.
+func (s *Server) identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := tlsconfig.PeerIdentity(r.TLS)
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			token = r.URL.Query().Get("token")
+		}
+		if id == "" && token != "" {
+			var err error
+			if s.Identities != nil {
+				id, err = s.Identities.Verify(token)
+			} else {
+				err = identity.ErrInvalidToken
+			}
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="player", error="invalid_token"`)
+				renderError(w, r, http.StatusUnauthorized, err.Error())
+				return
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), playerIdKey{}, id)))
+	})
 }
 
+// playerId returns the player established by identify, empty for anonymous
+// clients.
+func playerId(r *http.Request) string {
+	id, _ := r.Context().Value(playerIdKey{}).(string)
+	return id
+}
+
+// parseSince reads the sequence number a subscriber wants to resume after,
+// either from the since query parameter or the Last-Event-ID header that
+// EventSource sends when reconnecting.
+func parseSince(r *http.Request) (uint64, error) {
+	since := r.URL.Query().Get("since")
+	if since == "" {
+		since = r.Header.Get("Last-Event-ID")
+	}
+	if since == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(since, 10, 64)
+}
+
+const defaultHistoryLimit = 50
+const maxHistoryLimit = 200
+
+// historyHandler returns messages published before the sequence number
+// given by the before query parameter, so clients can scroll back.
+func (s *Server) historyHandler(w http.ResponseWriter, r *http.Request) {
+	lobbyId := chi.URLParam(r, "lobbyId")
+
+	var before uint64
+	if v := r.URL.Query().Get("before"); v != "" {
+		var err error
+		before, err = strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			renderError(w, r, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+			return
+		}
+	}
+
+	limit := defaultHistoryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxHistoryLimit {
+			renderError(w, r, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+			return
+		}
+	}
+
+	messages, err := s.LobbyService.History(r.Context(), lobbyId, playerId(r), before, limit)
+	if errors.Is(err, lobby.ErrNotFound) {
+		renderError(w, r, http.StatusNotFound, "lobby not found")
+		return
+	}
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	render.JSON(w, r, messages)
+}
+
+// publishHandler publishes the request body as a text message, whispered to
+// the players given by repeated to query parameters, as in ?to=alice&to=bob.
 func (s *Server) publishHandler(w http.ResponseWriter, r *http.Request) {
 	lobbyId := chi.URLParam(r, "lobbyId")
 
+	if !s.PublishLimits.Allow(playerId(r), r.RemoteAddr) {
+		w.Header().Set("Retry-After", "1")
+		renderError(w, r, http.StatusTooManyRequests, "publishing too fast")
+		return
+	}
+
 	body := http.MaxBytesReader(w, r.Body, 8192)
 	msg, err := io.ReadAll(body)
 	if err != nil {
-		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		renderError(w, r, http.StatusRequestEntityTooLarge, http.StatusText(http.StatusRequestEntityTooLarge))
+		return
+	}
+
+	recipients := r.URL.Query()["to"]
+	err = s.LobbyService.Publish(r.Context(), lobbyId, playerId(r), msg, recipients)
+	if errors.Is(err, lobby.ErrNotFound) {
+		renderError(w, r, http.StatusNotFound, "lobby not found")
+		return
+	}
+	if errors.Is(err, lobby.ErrRejected) {
+		renderError(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	renderPublished(w, r, PublishResponse{LobbyId: lobbyId, Recipients: recipients})
+}
+
+// publishDataHandler publishes the request body as the payload of a data
+// message with the subtype given in the path, whispered like publishHandler.
+func (s *Server) publishDataHandler(w http.ResponseWriter, r *http.Request) {
+	lobbyId := chi.URLParam(r, "lobbyId")
+	subtype := chi.URLParam(r, "subtype")
+
+	if !s.PublishLimits.Allow(playerId(r), r.RemoteAddr) {
+		w.Header().Set("Retry-After", "1")
+		renderError(w, r, http.StatusTooManyRequests, "publishing too fast")
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, 8192)
+	payload, err := io.ReadAll(body)
+	if err != nil {
+		renderError(w, r, http.StatusRequestEntityTooLarge, http.StatusText(http.StatusRequestEntityTooLarge))
 		return
 	}
 
-	s.LobbyService.Publish(r.Context(), lobbyId, msg)
+	recipients := r.URL.Query()["to"]
+	err = s.LobbyService.PublishData(r.Context(), lobbyId, playerId(r), subtype, payload, recipients)
+	if errors.Is(err, lobby.ErrNotFound) {
+		renderError(w, r, http.StatusNotFound, "lobby not found")
+		return
+	}
+	if errors.Is(err, lobby.ErrRejected) {
+		renderError(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
 
-	render.Status(r, http.StatusAccepted)
+	renderPublished(w, r, PublishResponse{LobbyId: lobbyId, Recipients: recipients})
 }
 
 func (s *Server) deleteLobbyHandler(w http.ResponseWriter, r *http.Request) {
@@ -102,39 +515,79 @@ func (s *Server) deleteLobbyHandler(w http.ResponseWriter, r *http.Request) {
 
 	err := s.LobbyService.Delete(r.Context(), lobbyId)
 	if errors.Is(err, lobby.ErrNotFound) {
-		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		renderError(w, r, http.StatusNotFound, "lobby not found")
+		return
+	}
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	render.NoContent(w, r)
+}
+
+func (s *Server) updateLobbyHandler(w http.ResponseWriter, r *http.Request) {
+	lobbyId := chi.URLParam(r, "lobbyId")
+
+	data := UpdateLobbyRequest{}
+	if err := render.Bind(r, &data); err != nil {
+		renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err := s.LobbyService.Rename(r.Context(), lobbyId, data.Name)
+	if errors.Is(err, lobby.ErrNotFound) {
+		renderError(w, r, http.StatusNotFound, "lobby not found")
+		return
+	}
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	l, err := s.LobbyService.Get(r.Context(), lobbyId)
+	if errors.Is(err, lobby.ErrNotFound) {
+		renderError(w, r, http.StatusNotFound, "lobby not found")
 		return
 	}
 	if err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		renderError(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
 
-	render.Status(r, http.StatusOK)
+	render.Render(w, r, MapLobbyToResponse(l))
 }
 
 func (s *Server) createLobbyHandler(w http.ResponseWriter, r *http.Request) {
 	data := CreateLobbyRequest{}
 	if err := render.Bind(r, &data); err != nil {
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		renderError(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	lobbyId, err := s.LobbyService.Create(r.Context(), data.Name)
 	if err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		renderError(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	l, err := s.LobbyService.Get(r.Context(), lobbyId)
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
 
-	render.JSON(w, r, lobbyId)
+	w.Header().Set("Location", "/v1/lobby/"+url.PathEscape(lobbyId))
+	render.Status(r, http.StatusCreated)
+	render.Render(w, r, MapLobbyToResponse(l))
 }
 
 func (s *Server) listLobbiesHandler(w http.ResponseWriter, r *http.Request) {
 	lobbies, err := s.LobbyService.List(r.Context())
 	if err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		renderError(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
 
-	render.JSON(w, r, lobbies)
+	render.RenderList(w, r, MapLobbiesToResponseRenderer(lobbies))
 }
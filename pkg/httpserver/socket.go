@@ -0,0 +1,129 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"github.com/lukaspj/go-masterserver/pkg/session"
+	"log/slog"
+	"nhooyr.io/websocket"
+	"time"
+)
+
+// errLeft is the cause of sessions the client ended with a leave command.
+var errLeft = errors.New("left lobby")
+
+var errUnknownCommand = errors.New("unknown command")
+
+// socketCommands handles the commands a websocket client sends to the lobby
+// it is subscribed to, mirroring the commands of the TCP protocol.
+type socketCommands struct {
+	session *session.Session
+	conn    *websocket.Conn
+	codec   socketCodec
+	lobbyId string
+	logger  *slog.Logger
+}
+
+// read reads and handles commands until the connection fails or the client
+// leaves, then ends the session.
+func (sc *socketCommands) read(ctx context.Context) {
+	for {
+		typ, data, err := sc.conn.Read(ctx)
+		if err != nil {
+			sc.session.Close(err)
+			return
+		}
+
+		if typ != sc.codec.frame {
+			sc.ack(ctx, SocketAck{Error: fmt.Sprintf("commands must be sent as %s frames", frameName(sc.codec.frame))})
+			continue
+		}
+
+		var command SocketCommand
+		err = sc.codec.unmarshal(data, &command)
+		if err != nil {
+			sc.ack(ctx, SocketAck{Error: "malformed command"})
+			continue
+		}
+
+		ack := sc.handle(ctx, command)
+		ack.Id = command.Id
+		ack.Command = command.Command
+		ack.Ok = ack.Error == ""
+		sc.ack(ctx, ack)
+
+		if command.Command == "leave" {
+			sc.session.Close(errLeft)
+			return
+		}
+	}
+}
+
+func (sc *socketCommands) handle(ctx context.Context, command SocketCommand) SocketAck {
+	var err error
+	ack := SocketAck{}
+
+	switch command.Command {
+	case "send":
+		if command.Subtype != "" {
+			err = sc.session.PublishData(ctx, sc.lobbyId, command.Subtype, command.Payload, command.Recipients)
+		} else {
+			err = sc.session.Publish(ctx, sc.lobbyId, []byte(command.Content), command.Recipients)
+		}
+	case "ready":
+		var ready bool
+		ready, err = sc.session.SetReady(ctx, sc.lobbyId, command.Ready)
+		if err == nil {
+			ack.Ready = &ready
+		}
+	case "leave":
+	case "ping":
+		now := time.Now()
+		ack.Time = &now
+		ack.Payload = command.Payload
+	default:
+		err = fmt.Errorf("%w %q", errUnknownCommand, command.Command)
+	}
+
+	if err != nil {
+		ack.Error = sc.describe(err)
+	}
+	return ack
+}
+
+// describe explains to the client why their command failed, without
+// revealing internal errors.
+func (sc *socketCommands) describe(err error) string {
+	if errors.Is(err, lobby.ErrNotFound) {
+		return "lobby not found"
+	}
+	if errors.Is(err, lobby.ErrRejected) ||
+		errors.Is(err, lobby.ErrUnidentified) ||
+		errors.Is(err, session.ErrNotJoined) ||
+		errors.Is(err, errUnknownCommand) {
+		return err.Error()
+	}
+
+	sc.logger.Warn("websocket command failed", slog.Any("error", err))
+	return "internal error"
+}
+
+// ack queues the acknowledgement of a command after the messages queued
+// before it.
+func (sc *socketCommands) ack(ctx context.Context, ack SocketAck) {
+	ack.Type = "ack"
+	bytes, err := sc.codec.marshal(ack)
+	if err != nil {
+		sc.logger.Error("failed to marshal ack", slog.Any("error", err))
+		return
+	}
+
+	err = sc.session.Enqueue(ctx, func(ctx context.Context) error {
+		return sc.conn.Write(ctx, sc.codec.frame, bytes)
+	})
+	if err != nil {
+		sc.logger.Debug("failed to queue ack", slog.Any("error", err))
+	}
+}
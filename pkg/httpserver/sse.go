@@ -0,0 +1,115 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"github.com/lukaspj/go-masterserver/pkg/logging"
+	"github.com/lukaspj/go-masterserver/pkg/session"
+	"log/slog"
+	"net/http"
+)
+
+// SSEConnection writes lobby messages as server-sent events. Stream messages
+// carry their sequence number as the event id so that EventSource resumes
+// where it left off when it reconnects.
+type SSEConnection struct {
+	w          http.ResponseWriter
+	flusher    http.Flusher
+	remoteAddr string
+}
+
+var _ session.Transport = SSEConnection{}
+var _ session.Pinger = SSEConnection{}
+
+func (sc SSEConnection) WriteMessage(ctx context.Context, message lobby.Message) error {
+	bytes, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	if message.Seq != 0 {
+		_, err = fmt.Fprintf(sc.w, "id: %d\n", message.Seq)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(sc.w, "event: %s\ndata: %s\n\n", message.Type, bytes)
+	if err != nil {
+		return err
+	}
+
+	sc.flusher.Flush()
+	return nil
+}
+
+func (sc SSEConnection) Name() string {
+	return "sse"
+}
+
+// Ping writes a comment, which EventSource ignores, to find out whether the
+// client is still there and to keep proxies from closing the stream.
+func (sc SSEConnection) Ping(ctx context.Context) error {
+	_, err := fmt.Fprint(sc.w, ": keepalive\n\n")
+	if err != nil {
+		return err
+	}
+
+	sc.flusher.Flush()
+	return nil
+}
+
+func (sc SSEConnection) RemoteAddr() string {
+	return sc.remoteAddr
+}
+
+func (s *Server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	lobbyId := chi.URLParam(r, "lobbyId")
+
+	since, err := parseSince(r)
+	if err != nil {
+		renderError(w, r, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	// EventSource reconnects to streams that end, so unknown lobbies are
+	// refused before the stream starts.
+	_, err = s.LobbyService.Get(r.Context(), lobbyId)
+	if errors.Is(err, lobby.ErrNotFound) {
+		renderError(w, r, http.StatusNotFound, "lobby not found")
+		return
+	}
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		renderError(w, r, http.StatusNotImplemented, http.StatusText(http.StatusNotImplemented))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	sess := session.New(s.LobbyService, SSEConnection{w, flusher, r.RemoteAddr}, playerId(r))
+	sess.Logger = logging.ForRequest(s.Logger, r)
+	err = sess.Serve(r.Context(), func(ctx context.Context) error {
+		return sess.Subscribe(ctx, lobbyId, since)
+	})
+	if errors.Is(err, context.Canceled) || errors.Is(err, lobby.ErrClosed) ||
+		errors.Is(err, lobby.ErrKicked) || errors.Is(err, lobby.ErrDisconnected) ||
+		errors.Is(err, session.ErrKeepaliveFailed) {
+		return
+	}
+	if err != nil {
+		logging.ForRequest(s.Logger, r).Error("subscription failed", slog.String("lobby_id", lobbyId), slog.Any("error", err))
+		return
+	}
+}
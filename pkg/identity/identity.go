@@ -0,0 +1,87 @@
+// Package identity issues and verifies the session tokens players prove who
+// they are with when they have no client certificate.
+package identity
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned for tokens that are malformed, signed with
+// another key or expired.
+var ErrInvalidToken = errors.New("invalid session token")
+
+// Signer issues session tokens naming a player, which are signed with a key
+// only the master servers and the backend of the game know. A token is the
+// player id and its expiry, followed by their HMAC-SHA256, all separated by
+// dots.
+type Signer struct {
+	// TTL is how long issued tokens are valid for.
+	// Defaults to 24 hours.
+	TTL time.Duration
+
+	key []byte
+}
+
+// NewSigner constructs a signer for the key, which should be at least 32
+// random bytes.
+func NewSigner(key []byte) *Signer {
+	return &Signer{
+		TTL: time.Hour * 24,
+		key: key,
+	}
+}
+
+var encoding = base64.RawURLEncoding
+
+// Issue returns a token for the player and the time it expires at.
+func (s *Signer) Issue(playerId string) (string, time.Time) {
+	expires := time.Now().Add(s.TTL).Truncate(time.Second)
+	payload := encoding.EncodeToString([]byte(playerId)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + encoding.EncodeToString(s.sign(payload)), expires
+}
+
+// Verify returns the player the token was issued for.
+func (s *Signer) Verify(token string) (string, error) {
+	payload, signature, ok := cutLast(token, ".")
+	if !ok {
+		return "", ErrInvalidToken
+	}
+	mac, err := encoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.sign(payload)) {
+		return "", ErrInvalidToken
+	}
+
+	encodedId, expiry, ok := strings.Cut(payload, ".")
+	if !ok {
+		return "", ErrInvalidToken
+	}
+	expires, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().After(time.Unix(expires, 0)) {
+		return "", ErrInvalidToken
+	}
+	playerId, err := encoding.DecodeString(encodedId)
+	if err != nil || len(playerId) == 0 {
+		return "", ErrInvalidToken
+	}
+	return string(playerId), nil
+}
+
+func (s *Signer) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func cutLast(s string, sep string) (string, string, bool) {
+	idx := strings.LastIndex(s, sep)
+	if idx < 0 {
+		return "", "", false
+	}
+	return s[:idx], s[idx+len(sep):], true
+}
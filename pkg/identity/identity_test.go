@@ -0,0 +1,54 @@
+package identity
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIssuedTokensNameTheirPlayer(t *testing.T) {
+	signer := NewSigner([]byte("0123456789abcdef0123456789abcdef"))
+
+	for _, playerId := range []string{"alice", "bob.with.dots", "名前"} {
+		token, expires := signer.Issue(playerId)
+		if time.Until(expires) <= 0 {
+			t.Errorf("token for %s expires at %s, in the past", playerId, expires)
+		}
+		got, err := signer.Verify(token)
+		if err != nil {
+			t.Fatalf("verifying token for %s: %v", playerId, err)
+		}
+		if got != playerId {
+			t.Errorf("token names %q, want %q", got, playerId)
+		}
+	}
+}
+
+func TestForgedTokensAreRefused(t *testing.T) {
+	signer := NewSigner([]byte("0123456789abcdef0123456789abcdef"))
+	token, _ := signer.Issue("alice")
+	payload := token[:strings.LastIndex(token, ".")]
+	signature := token[strings.LastIndex(token, ".")+1:]
+
+	expired := NewSigner([]byte("0123456789abcdef0123456789abcdef"))
+	expired.TTL = -time.Minute
+	expiredToken, _ := expired.Issue("alice")
+	otherKeyToken, _ := NewSigner([]byte("another key")).Issue("alice")
+	bobPayload := strings.Replace(payload, encoding.EncodeToString([]byte("alice")), encoding.EncodeToString([]byte("bob")), 1)
+
+	for name, token := range map[string]string{
+		"empty":          "",
+		"unsigned":       payload,
+		"other player":   bobPayload + "." + signature,
+		"other key":      otherKeyToken,
+		"expired":        expiredToken,
+		"bad signature":  payload + ".AAAA",
+		"player id only": "alice",
+	} {
+		_, err := signer.Verify(token)
+		if !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s token: got %v, want %v", name, err, ErrInvalidToken)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package lobby
+
+import (
+	"context"
+	"sync"
+)
+
+// MessageBackend carries published messages to every node serving a lobby.
+//
+// The backend sequences the messages of a lobby itself, so that every node
+// sees them with the same sequence numbers, in the same order, and that
+// subscribers can resume on any node.
+type MessageBackend interface {
+	// Publish assigns msg the next sequence number of the lobby across all
+	// nodes and delivers it to every subscription for the lobby, including
+	// the ones on the publishing node.
+	Publish(ctx context.Context, lobbyId string, msg Message) error
+	// Subscribe returns a channel of the messages of the lobby with a
+	// sequence number greater than after, starting with those the backend
+	// still holds, which is closed once ctx is done or the backend gives up
+	// on it.
+	Subscribe(ctx context.Context, lobbyId string, after uint64) (<-chan Message, error)
+}
+
+// LobbyDirectory is implemented by backends that share the lobbies
+// themselves between nodes, so that a lobby created on one node can be
+// found, joined and published to on every other.
+type LobbyDirectory interface {
+	// AddLobby adds the lobby for every node, failing with ErrExists if a
+	// lobby with its id exists already.
+	AddLobby(ctx context.Context, lobby RepoLobby) error
+	// UpdateLobby replaces the lobby for every node.
+	UpdateLobby(ctx context.Context, lobby RepoLobby) error
+	// DeleteLobby removes the lobby and its messages for every node.
+	DeleteLobby(ctx context.Context, id string) error
+	// WatchLobbies returns a channel of every lobby that exists, followed by
+	// a change with an empty lobby id once they have all been sent, and then
+	// of every change to the lobbies. It is closed once ctx is done or the
+	// backend gives up on it.
+	WatchLobbies(ctx context.Context) (<-chan LobbyChange, error)
+}
+
+// LobbyChange is a lobby added, updated or deleted on any node.
+type LobbyChange struct {
+	Lobby   RepoLobby
+	Deleted bool
+}
+
+// Envelope carries a message between nodes along with its trace context,
+// which the JSON of a Message leaves out.
+type Envelope struct {
+	Message
+	TraceContext map[string]string `json:"traceContext,omitempty"`
+}
+
+// Seal puts msg in an envelope.
+func Seal(msg Message) Envelope {
+	return Envelope{Message: msg, TraceContext: msg.TraceContext}
+}
+
+// Open takes the message out of the envelope.
+func (e Envelope) Open() Message {
+	msg := e.Message
+	msg.TraceContext = e.TraceContext
+	return msg
+}
+
+// BackendMessageStream is a MessageStream that publishes through a
+// MessageBackend, so that subscribers on other nodes receive the messages
+// too. Messages arriving from the backend keep the sequence numbers it
+// assigned, and are stored and fanned out by a local InMemoryMessageStream.
+type BackendMessageStream struct {
+	*InMemoryMessageStream
+
+	lobbyId string
+	backend MessageBackend
+	cancel  context.CancelFunc
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewBackendMessageStream subscribes to the lobby on the backend right
+// away, catching up on the messages published after the last one in store.
+func NewBackendMessageStream(lobbyId string, store MessageStore, backend MessageBackend) (*BackendMessageStream, error) {
+	local, err := NewInMemoryMessageStream(lobbyId, store)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	incoming, err := backend.Subscribe(ctx, lobbyId, local.LastSeq())
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	stream := &BackendMessageStream{
+		InMemoryMessageStream: local,
+		lobbyId:               lobbyId,
+		backend:               backend,
+		cancel:                cancel,
+		done:                  make(chan struct{}),
+	}
+
+	go func() {
+		defer close(stream.done)
+		for msg := range incoming {
+			// Errors only occur once the stream is closed.
+			_ = local.deliver(msg)
+		}
+	}()
+
+	return stream, nil
+}
+
+func (s *BackendMessageStream) Publish(ctx context.Context, msg Message) error {
+	select {
+	case <-s.done:
+		return ErrClosed
+	default:
+	}
+
+	return s.backend.Publish(ctx, s.lobbyId, msg)
+}
+
+// Close stops receiving from the backend and ends every local subscription.
+func (s *BackendMessageStream) Close() error {
+	s.once.Do(s.cancel)
+	return s.InMemoryMessageStream.Close()
+}
+
+var _ MessageStream = &BackendMessageStream{}
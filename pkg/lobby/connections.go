@@ -0,0 +1,298 @@
+package lobby
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/lukaspj/go-masterserver/pkg/tracing"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrKicked is returned by Subscribe when an operator removed the
+// connection from the lobby.
+var ErrKicked = errors.New("kicked from lobby")
+
+// ErrDisconnected is returned by Subscribe when an operator disconnected
+// the connection, for example because the player was banned.
+var ErrDisconnected = errors.New("disconnected by operator")
+
+// operatorError is the cancellation cause of subscriptions ended by an
+// operator. Subscribe tells the connection why before it returns.
+type operatorError struct {
+	kind   NoticeKind
+	reason string
+	err    error
+}
+
+func (e *operatorError) Error() string {
+	if e.reason == "" {
+		return e.err.Error()
+	}
+	return e.err.Error() + ": " + e.reason
+}
+
+func (e *operatorError) Unwrap() error {
+	return e.err
+}
+
+// ConnectionInfo describes a connection to the server for operators.
+type ConnectionInfo struct {
+	Id         string
+	PlayerId   string
+	RemoteAddr string
+	Transport  string
+	Connected  time.Time
+	// Lobbies holds the ids of the lobbies the connection is subscribed to.
+	Lobbies []string
+}
+
+type trackedConnection struct {
+	info       ConnectionInfo
+	disconnect context.CancelCauseFunc
+	lobbies    map[string]context.CancelCauseFunc
+	// implicit connections were tracked by their subscription rather than
+	// registered, and are forgotten when it ends.
+	implicit bool
+}
+
+type connectionRegistry struct {
+	connections map[Connection]*trackedConnection
+	mu          sync.Mutex
+}
+
+func newConnectionRegistry() *connectionRegistry {
+	return &connectionRegistry{
+		connections: make(map[Connection]*trackedConnection),
+	}
+}
+
+func (r *connectionRegistry) track(conn Connection, disconnect context.CancelCauseFunc, implicit bool) *trackedConnection {
+	tracked := &trackedConnection{
+		info: ConnectionInfo{
+			Id:         uuid.NewString(),
+			PlayerId:   conn.PlayerId(),
+			RemoteAddr: conn.RemoteAddr(),
+			Transport:  conn.Transport(),
+			Connected:  time.Now(),
+		},
+		disconnect: disconnect,
+		lobbies:    make(map[string]context.CancelCauseFunc),
+		implicit:   implicit,
+	}
+	r.connections[conn] = tracked
+	return tracked
+}
+
+// Register tracks conn as connected to the server until the returned
+// function is called, so that operators can list and disconnect it.
+// Transports that keep a connection open across lobbies, like TCP, register
+// it once; other connections are tracked for as long as their subscription.
+func (ls *Service) Register(conn Connection, disconnect context.CancelCauseFunc) (unregister func()) {
+	ls.connections.mu.Lock()
+	defer ls.connections.mu.Unlock()
+
+	ls.connections.track(conn, disconnect, false)
+	return func() {
+		ls.connections.mu.Lock()
+		defer ls.connections.mu.Unlock()
+
+		delete(ls.connections.connections, conn)
+	}
+}
+
+// join records that conn is subscribed to the lobby until the returned
+// function is called. cancel ends the subscription.
+func (ls *Service) join(conn Connection, lobbyId string, cancel context.CancelCauseFunc) (leave func()) {
+	ls.connections.mu.Lock()
+	defer ls.connections.mu.Unlock()
+
+	tracked, ok := ls.connections.connections[conn]
+	if !ok {
+		tracked = ls.connections.track(conn, cancel, true)
+	}
+	tracked.lobbies[lobbyId] = cancel
+
+	return func() {
+		ls.connections.mu.Lock()
+		defer ls.connections.mu.Unlock()
+
+		delete(tracked.lobbies, lobbyId)
+		if tracked.implicit {
+			delete(ls.connections.connections, conn)
+		}
+	}
+}
+
+// subscribed reports whether any connection of the player is subscribed
+// to the lobby.
+func (r *connectionRegistry) subscribed(lobbyId string, playerId string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, tracked := range r.connections {
+		if _, ok := tracked.lobbies[lobbyId]; ok && tracked.info.PlayerId == playerId {
+			return true
+		}
+	}
+	return false
+}
+
+// Connections lists every connection to the server, oldest first.
+func (ls *Service) Connections() []ConnectionInfo {
+	ls.connections.mu.Lock()
+	defer ls.connections.mu.Unlock()
+
+	infos := make([]ConnectionInfo, 0, len(ls.connections.connections))
+	for _, tracked := range ls.connections.connections {
+		info := tracked.info
+		info.Lobbies = make([]string, 0, len(tracked.lobbies))
+		for lobbyId := range tracked.lobbies {
+			info.Lobbies = append(info.Lobbies, lobbyId)
+		}
+		sort.Strings(info.Lobbies)
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Connected.Before(infos[j].Connected)
+	})
+	return infos
+}
+
+// Kick ends the subscriptions of the player to the lobby, telling them the
+// reason. It returns the number of subscriptions that were ended.
+func (ls *Service) Kick(lobbyId string, playerId string, reason string) int {
+	ls.connections.mu.Lock()
+	defer ls.connections.mu.Unlock()
+
+	kicked := 0
+	for _, tracked := range ls.connections.connections {
+		cancel, ok := tracked.lobbies[lobbyId]
+		if !ok || tracked.info.PlayerId != playerId {
+			continue
+		}
+		cancel(&operatorError{kind: KickedNotice, reason: reason, err: ErrKicked})
+		kicked++
+	}
+
+	if kicked > 0 {
+		ls.Logger.Info("player kicked",
+			slog.String("lobby_id", lobbyId),
+			slog.String("player_id", playerId),
+			slog.String("reason", reason),
+		)
+	}
+	return kicked
+}
+
+// Disconnect closes every connection that match reports true for, telling
+// them the reason. It returns the number of connections that were closed.
+func (ls *Service) Disconnect(match func(info ConnectionInfo) bool, reason string) int {
+	ls.connections.mu.Lock()
+	defer ls.connections.mu.Unlock()
+
+	cause := &operatorError{kind: DisconnectedNotice, reason: reason, err: ErrDisconnected}
+	disconnected := 0
+	for _, tracked := range ls.connections.connections {
+		if !match(tracked.info) {
+			continue
+		}
+		for _, cancel := range tracked.lobbies {
+			cancel(cause)
+		}
+		tracked.disconnect(cause)
+		disconnected++
+	}
+
+	if disconnected > 0 {
+		ls.Logger.Info("connections disconnected", slog.Int("count", disconnected), slog.String("reason", reason))
+	}
+	return disconnected
+}
+
+// CloseLobby tells the subscribers of the lobby why it is being closed and
+// then deletes it.
+func (ls *Service) CloseLobby(ctx context.Context, id string, reason string) error {
+	stream, err := ls.getMessageStream(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = stream.Publish(ctx, noticeMessage(ctx, LobbyClosedNotice, reason))
+	if err != nil {
+		return err
+	}
+
+	ls.Logger.Info("lobby closed", slog.String("lobby_id", id), slog.String("reason", reason))
+	return ls.Delete(ctx, id)
+}
+
+// Announce publishes content to every lobby and returns the number of
+// lobbies it reached.
+func (ls *Service) Announce(ctx context.Context, content string) (int, error) {
+	lobbies, err := ls.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	msg := noticeMessage(ctx, AnnouncementNotice, content)
+	reached := 0
+	for _, l := range lobbies {
+		stream, err := ls.getMessageStream(ctx, l.Id)
+		if errors.Is(err, ErrNotFound) {
+			// Deleted since it was listed.
+			continue
+		}
+		if err != nil {
+			return reached, err
+		}
+
+		err = stream.Publish(ctx, msg)
+		if errors.Is(err, ErrClosed) {
+			continue
+		}
+		if err != nil {
+			return reached, err
+		}
+		ls.Metrics.MessagePublished(l.Id)
+		reached++
+	}
+	return reached, nil
+}
+
+// Notify sends a notice from the server to only the given players in the
+// lobby.
+func (ls *Service) Notify(ctx context.Context, id string, playerIds []string, content string) error {
+	if len(playerIds) == 0 {
+		return fmt.Errorf("notify needs at least one player")
+	}
+
+	stream, err := ls.getMessageStream(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	msg := noticeMessage(ctx, DirectNotice, content)
+	msg.Recipients = playerIds
+	err = stream.Publish(ctx, msg)
+	if err != nil {
+		return err
+	}
+	ls.Metrics.MessagePublished(id)
+	return nil
+}
+
+func noticeMessage(ctx context.Context, kind NoticeKind, content string) Message {
+	return Message{
+		Type: NoticeMessageType,
+		Notice: NoticeMessage{
+			Kind:    kind,
+			Content: content,
+			Created: time.Now(),
+		},
+		TraceContext: tracing.Inject(ctx),
+	}
+}
@@ -0,0 +1,137 @@
+package lobby
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type LobbyEventType string
+
+const (
+	LobbyCreatedEvent     LobbyEventType = "created"
+	LobbyUpdatedEvent     LobbyEventType = "updated"
+	LobbyDeletedEvent     LobbyEventType = "deleted"
+	LobbySubscribersEvent LobbyEventType = "subscribers"
+)
+
+// LobbyEvent describes a change to the set of lobbies.
+type LobbyEvent struct {
+	Type  LobbyEventType
+	Lobby Lobby
+	Time  time.Time
+}
+
+var lobbyFeedBufferSize = 32
+var lobbyFeedCoalesceInterval = time.Millisecond * 250
+
+// LobbyFeed fans out lobby lifecycle events to every watcher.
+//
+// Subscriber count changes are coalesced per lobby so that a burst of
+// joins and leaves results in a single event carrying the latest count.
+type LobbyFeed struct {
+	// resolve looks up the current state of a lobby when a coalesced
+	// subscriber count change is flushed.
+	resolve func(id string) (Lobby, error)
+
+	watchers   map[chan LobbyEvent]any
+	pending    map[string]any
+	flushTimer *time.Timer
+	mu         sync.Mutex
+}
+
+func NewLobbyFeed(resolve func(id string) (Lobby, error)) *LobbyFeed {
+	return &LobbyFeed{
+		resolve:  resolve,
+		watchers: make(map[chan LobbyEvent]any),
+		pending:  make(map[string]any),
+	}
+}
+
+// Watch registers a watcher that receives every event until ctx is done.
+// Watchers that cannot keep up have their channel closed instead of
+// silently missing events, so they should re-list and watch again.
+func (f *LobbyFeed) Watch(ctx context.Context) <-chan LobbyEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	watcher := make(chan LobbyEvent, lobbyFeedBufferSize)
+	f.watchers[watcher] = true
+
+	go func() {
+		<-ctx.Done()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.removeWatcher(watcher)
+	}()
+
+	return watcher
+}
+
+// Publish sends the event to all watchers without blocking.
+func (f *LobbyFeed) Publish(event LobbyEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if event.Type == LobbyDeletedEvent {
+		delete(f.pending, event.Lobby.Id)
+	}
+	f.broadcast(event)
+}
+
+// SubscribersChanged schedules a subscriber count event for the lobby.
+// Calls arriving within the coalesce interval are merged.
+func (f *LobbyFeed) SubscribersChanged(id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.pending[id] = true
+	if f.flushTimer == nil {
+		f.flushTimer = time.AfterFunc(lobbyFeedCoalesceInterval, f.flush)
+	}
+}
+
+func (f *LobbyFeed) flush() {
+	f.mu.Lock()
+	ids := make([]string, 0, len(f.pending))
+	for id := range f.pending {
+		ids = append(ids, id)
+	}
+	f.pending = make(map[string]any)
+	f.flushTimer = nil
+	f.mu.Unlock()
+
+	for _, id := range ids {
+		lobby, err := f.resolve(id)
+		if err != nil {
+			// The lobby was deleted in the meantime, which has its own event.
+			continue
+		}
+		f.Publish(LobbyEvent{
+			Type:  LobbySubscribersEvent,
+			Lobby: lobby,
+		})
+	}
+}
+
+func (f *LobbyFeed) broadcast(event LobbyEvent) {
+	for watcher := range f.watchers {
+		select {
+		case watcher <- event:
+		default:
+			f.removeWatcher(watcher)
+		}
+	}
+}
+
+func (f *LobbyFeed) removeWatcher(watcher chan LobbyEvent) {
+	if _, ok := f.watchers[watcher]; !ok {
+		return
+	}
+	delete(f.watchers, watcher)
+	close(watcher)
+}
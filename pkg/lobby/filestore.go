@@ -0,0 +1,328 @@
+package lobby
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileMessageStore persists the history of each lobby as a file of JSON
+// lines in Dir, and the lobbies themselves in lobbies.json, so both survive
+// restarts. Histories are loaded lazily and the most recently used are
+// cached in memory; files are compacted once retention has discarded enough
+// of their lines.
+type FileMessageStore struct {
+	Dir       string
+	Retention RetentionPolicy
+
+	// MaxCachedLobbies is the number of lobby histories kept in memory, the
+	// least recently used are dropped and read from their file when needed
+	// again.
+	//
+	// Defaults to 256, zero for no limit.
+	MaxCachedLobbies int
+
+	histories map[string]*list.Element
+	// recent orders the cached histories from most to least recently used.
+	recent *list.List
+	mu     sync.Mutex
+}
+
+type fileHistory struct {
+	lobbyHistory
+	lobbyId string
+	// lines is the number of messages in the file, including the ones
+	// discarded by retention since the last compaction.
+	lines int
+}
+
+const (
+	historyExt      = ".jsonl"
+	lobbiesFileName = "lobbies.json"
+)
+
+func NewFileMessageStore(dir string, retention RetentionPolicy) (*FileMessageStore, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileMessageStore{
+		Dir:              dir,
+		Retention:        retention,
+		MaxCachedLobbies: 256,
+		histories:        make(map[string]*list.Element),
+		recent:           list.New(),
+	}, nil
+}
+
+func (f *FileMessageStore) path(lobbyId string) string {
+	return filepath.Join(f.Dir, url.PathEscape(lobbyId)+historyExt)
+}
+
+func (f *FileMessageStore) history(lobbyId string) (*fileHistory, error) {
+	var h *fileHistory
+	if e, ok := f.histories[lobbyId]; ok {
+		f.recent.MoveToFront(e)
+		h = e.Value.(*fileHistory)
+	} else {
+		var err error
+		h, err = f.load(lobbyId)
+		if err != nil {
+			return nil, err
+		}
+		f.histories[lobbyId] = f.recent.PushFront(h)
+		f.evict()
+	}
+	h.messages = f.Retention.retain(h.messages, time.Now())
+	return h, nil
+}
+
+// evict drops the least recently used histories beyond MaxCachedLobbies.
+// Everything cached is already in the files, so nothing is lost.
+func (f *FileMessageStore) evict() {
+	for f.MaxCachedLobbies > 0 && f.recent.Len() > f.MaxCachedLobbies {
+		h := f.recent.Remove(f.recent.Back()).(*fileHistory)
+		delete(f.histories, h.lobbyId)
+	}
+}
+
+func (f *FileMessageStore) forget(lobbyId string) {
+	if e, ok := f.histories[lobbyId]; ok {
+		f.recent.Remove(e)
+		delete(f.histories, lobbyId)
+	}
+}
+
+func (f *FileMessageStore) load(lobbyId string) (*fileHistory, error) {
+	h := &fileHistory{lobbyId: lobbyId}
+
+	file, err := os.Open(f.path(lobbyId))
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var stored storedMessage
+		err = json.Unmarshal(scanner.Bytes(), &stored)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history of lobby %s: %w", lobbyId, err)
+		}
+		h.messages = append(h.messages, stored)
+		h.lastSeq = stored.Message.Seq
+		h.lines++
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+func (f *FileMessageStore) Append(lobbyId string, msg Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	h, err := f.history(lobbyId)
+	if err != nil {
+		return err
+	}
+
+	stored := storedMessage{Stored: time.Now(), Message: msg}
+	line, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(f.path(lobbyId), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	h.messages = f.Retention.retain(append(h.messages, stored), time.Now())
+	h.lastSeq = msg.Seq
+	h.lines++
+
+	if h.lines > 2*len(h.messages)+16 {
+		return f.compact(lobbyId, h)
+	}
+	return nil
+}
+
+// compact rewrites the file with only the retained messages. It is only
+// called right after an append, so the last message is always kept and the
+// sequence continues where it left off after a restart.
+func (f *FileMessageStore) compact(lobbyId string, h *fileHistory) error {
+	keep := h.messages
+
+	tmpPath := f.path(lobbyId) + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, stored := range keep {
+		err = encoder.Encode(stored)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	err = os.Rename(tmpPath, f.path(lobbyId))
+	if err != nil {
+		return err
+	}
+	h.lines = len(keep)
+	return nil
+}
+
+func (f *FileMessageStore) Before(lobbyId string, before uint64, limit int) ([]Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	h, err := f.history(lobbyId)
+	if err != nil {
+		return nil, err
+	}
+	return h.before(before, limit), nil
+}
+
+func (f *FileMessageStore) After(lobbyId string, after uint64, limit int) ([]Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	h, err := f.history(lobbyId)
+	if err != nil {
+		return nil, err
+	}
+	return h.after(after, limit), nil
+}
+
+func (f *FileMessageStore) LastSeq(lobbyId string) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	h, err := f.history(lobbyId)
+	if err != nil {
+		return 0, err
+	}
+	return h.lastSeq, nil
+}
+
+func (f *FileMessageStore) Delete(lobbyId string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.forget(lobbyId)
+	err := os.Remove(f.path(lobbyId))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// LoadLobbies returns the lobbies last saved, and removes the history of
+// lobbies that are not among them, which could no longer be reached.
+func (f *FileMessageStore) LoadLobbies() ([]RepoLobby, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var lobbies []RepoLobby
+	data, err := os.ReadFile(filepath.Join(f.Dir, lobbiesFileName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &lobbies)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read lobbies: %w", err)
+		}
+	}
+
+	known := make(map[string]bool, len(lobbies))
+	for _, l := range lobbies {
+		known[l.Id] = true
+	}
+	entries, err := os.ReadDir(f.Dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), historyExt)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		lobbyId, err := url.PathUnescape(name)
+		if err != nil || known[lobbyId] {
+			continue
+		}
+		f.forget(lobbyId)
+		err = os.Remove(filepath.Join(f.Dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return lobbies, nil
+}
+
+// SaveLobbies replaces lobbies.json, writing the new file aside first so
+// that a crash leaves either the old or the new lobbies.
+func (f *FileMessageStore) SaveLobbies(lobbies []RepoLobby) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := json.Marshal(lobbies)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(f.Dir, lobbiesFileName)
+	tmpPath := path + ".tmp"
+	err = os.WriteFile(tmpPath, data, 0o644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+var _ MessageStore = &FileMessageStore{}
+var _ LobbyStore = &FileMessageStore{}
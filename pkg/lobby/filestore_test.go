@@ -0,0 +1,102 @@
+package lobby
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileMessageStoreRestoresLobbiesAndHistory(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewFileMessageStore(dir, DefaultRetentionPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := NewInMemoryRepo(store, nil)
+	l, err := repo.Add(RepoLobby{Name: "kept"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Append(l.Id, Message{Seq: 1, Type: TextMessageType, Text: TextMessage{Content: "hello"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = NewFileMessageStore(dir, DefaultRetentionPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo = NewInMemoryRepo(store, nil)
+	err = repo.Restore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := repo.Get(l.Id)
+	if err != nil {
+		t.Fatalf("lobby not restored: %v", err)
+	}
+	if restored.Name != "kept" || !restored.Created.Equal(l.Created) {
+		t.Errorf("restored %+v, want %+v", restored, l)
+	}
+	history, err := store.Before(l.Id, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Text.Content != "hello" {
+		t.Errorf("history = %+v, want the message appended before the restart", history)
+	}
+}
+
+func TestFileMessageStoreRemovesHistoryOfUnknownLobbies(t *testing.T) {
+	dir := t.TempDir()
+	orphan := filepath.Join(dir, "gone"+historyExt)
+	err := os.WriteFile(orphan, nil, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewFileMessageStore(dir, DefaultRetentionPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.LoadLobbies()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat(orphan); !os.IsNotExist(err) {
+		t.Errorf("history of unknown lobby kept, stat error %v", err)
+	}
+}
+
+func TestFileMessageStoreBoundsCache(t *testing.T) {
+	store, err := NewFileMessageStore(t.TempDir(), RetentionPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.MaxCachedLobbies = 2
+
+	for i, id := range []string{"a", "b", "c"} {
+		err = store.Append(id, Message{Seq: uint64(i + 1), Text: TextMessage{Created: time.Now()}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(store.histories) != 2 || store.recent.Len() != 2 {
+		t.Fatalf("cached %d histories, want 2", len(store.histories))
+	}
+	if _, ok := store.histories["a"]; ok {
+		t.Error("least recently used history still cached")
+	}
+
+	lastSeq, err := store.LastSeq("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastSeq != 1 {
+		t.Errorf("LastSeq of evicted history = %d, want 1", lastSeq)
+	}
+}
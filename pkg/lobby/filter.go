@@ -0,0 +1,84 @@
+package lobby
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrRejected is wrapped by the errors of filters that refuse a message.
+var ErrRejected = errors.New("message rejected")
+
+// Submission is a message a player asks to publish to a lobby.
+type Submission struct {
+	LobbyId  string
+	PlayerId string
+	// Type is either TextMessageType or DataMessageType.
+	Type MessageType
+	// Subtype is the application defined subtype of data messages.
+	Subtype string
+	// Content is the text of text messages and the payload of data
+	// messages.
+	Content string
+	// Recipients are the players the message is whispered to, empty for
+	// messages to everyone.
+	Recipients []string
+}
+
+// Filter inspects messages before they are published. It may rewrite the
+// content of the submission, or refuse it by returning a *RejectedError.
+type Filter interface {
+	Filter(ctx context.Context, submission *Submission) error
+}
+
+// FilterFunc adapts a function to a Filter.
+type FilterFunc func(ctx context.Context, submission *Submission) error
+
+func (f FilterFunc) Filter(ctx context.Context, submission *Submission) error {
+	return f(ctx, submission)
+}
+
+// Filters decides which filters apply to the messages of each lobby.
+type Filters interface {
+	// For returns the filters to run, in order, on messages to the lobby.
+	For(lobbyId string) []Filter
+}
+
+// RejectedError tells the sender why their message was not published.
+type RejectedError struct {
+	// Filter names the filter that refused the message, such as "length".
+	Filter string
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return e.Reason
+}
+
+func (e *RejectedError) Is(target error) bool {
+	return target == ErrRejected
+}
+
+// Reject constructs the error a filter returns to refuse a message.
+func Reject(filter string, reason string) error {
+	return &RejectedError{Filter: filter, Reason: reason}
+}
+
+// filter runs the filters configured for the lobby on the submission.
+// Whispers from anonymous players are refused before any of them, as
+// recipients could not tell who they are from.
+func (ls *Service) filter(ctx context.Context, submission *Submission) error {
+	if len(submission.Recipients) > 0 && submission.PlayerId == "" {
+		return Reject("whisper", "only identified players can whisper")
+	}
+	if ls.Filters == nil {
+		return nil
+	}
+
+	for _, f := range ls.Filters.For(submission.LobbyId) {
+		err := f.Filter(ctx, submission)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,10 +2,14 @@ package lobby
 
 import (
 	"context"
-	"log"
+	"errors"
+	"github.com/lukaspj/go-masterserver/pkg/metrics"
+	"github.com/lukaspj/go-masterserver/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
 	"time"
-
-	"golang.org/x/time/rate"
 )
 
 type Lobby struct {
@@ -17,31 +21,69 @@ type Lobby struct {
 
 // Service enables broadcasting to a set of subscribers.
 type Service struct {
-	// publishLimiter controls the rate limit applied to the Publish endpoint.
-	//
-	// Defaults to one Publish every 100ms with a burst of 8.
-	publishLimiter *rate.Limiter
+	// Logger controls where logs are sent.
+	// Defaults to slog.Default().
+	Logger *slog.Logger
+
+	// Metrics records lobby, subscriber and message throughput metrics.
+	// Defaults to nil, which records nothing.
+	Metrics *metrics.Metrics
 
-	// Logf controls where logs are sent.
-	// Defaults to log.Printf.
-	Logf func(f string, v ...interface{})
+	// Filters decides which filters messages pass before they are
+	// published.
+	// Defaults to nil, which publishes messages unfiltered.
+	Filters Filters
 
-	repo Repo
+	// Tracer records spans for publishes, subscriptions, deliveries and
+	// repo calls.
+	// Defaults to the tracer of the global provider.
+	Tracer trace.Tracer
+
+	repo        Repo
+	feed        *LobbyFeed
+	connections *connectionRegistry
+	ready       *readiness
 }
 
 // NewService constructs a chatServer with the defaults.
 func NewService() *Service {
+	return NewServiceWithRepo(NewInMemoryRepo(NewInMemoryMessageStore(DefaultRetentionPolicy), nil))
+}
+
+// NewServiceWithRepo constructs a chatServer with the defaults on top of
+// the given repo.
+func NewServiceWithRepo(repo Repo) *Service {
 	cs := &Service{
-		Logf:           log.Printf,
-		publishLimiter: rate.NewLimiter(rate.Every(time.Millisecond*100), 8),
-		repo:           NewInMemoryRepo(),
+		Logger:      slog.Default(),
+		Tracer:      otel.Tracer("github.com/lukaspj/go-masterserver/pkg/lobby"),
+		repo:        repo,
+		connections: newConnectionRegistry(),
+		ready:       newReadiness(),
 	}
+	cs.feed = NewLobbyFeed(func(id string) (Lobby, error) {
+		return cs.get(context.Background(), id)
+	})
 
 	return cs
 }
 
+// ErrTimedOut is the cause of subscriptions whose connection went silent.
+// Transports wrap it in the cause they cancel the subscription with, so
+// that the lobby is told the player timed out rather than left.
+var ErrTimedOut = errors.New("connection timed out")
+
+// ErrTooSlow is returned by Subscribe when the connection could not keep
+// up with the messages published to the lobby.
+var ErrTooSlow = errors.New("connection too slow to keep up with messages")
+
 type Connection interface {
 	WriteMessage(ctx context.Context, msg Message) error
+	// Transport names the protocol the connection uses, such as "tcp".
+	Transport() string
+	// PlayerId identifies the player on the other end, if known.
+	PlayerId() string
+	// RemoteAddr is the network address of the other end.
+	RemoteAddr() string
 }
 
 // Subscribe subscribes the given WebSocket to all broadcast messages.
@@ -50,17 +92,56 @@ type Connection interface {
 // and writes them to the WebSocket. If the context is cancelled or
 // an error occurs, it returns and deletes the subscription.
 //
-// It uses CloseRead to keep reading from the connection to process control
-// messages and cancel the context if the connection drops.
-func (ls *Service) Subscribe(ctx context.Context, id string, conn Connection) error {
-	messageStream, err := ls.repo.GetMessageStream(id)
+// The transport keeps reading from the connection to process commands and
+// control messages, and cancels the context if the connection drops.
+//
+// A non-zero since resumes the subscription after the message with that
+// sequence number, replaying what the connection missed or sending a gap
+// message for what is no longer available.
+func (ls *Service) Subscribe(ctx context.Context, id string, since uint64, conn Connection) (err error) {
+	ctx, span := ls.Tracer.Start(ctx, "lobby.Subscribe", trace.WithAttributes(
+		attribute.String("lobby.id", id),
+		attribute.String("lobby.transport", conn.Transport()),
+		attribute.Int64("lobby.since", int64(since)),
+	))
+	defer func() {
+		if !errors.Is(err, context.Canceled) {
+			tracing.RecordError(span, err)
+		}
+		span.End()
+	}()
+
+	messageStream, err := ls.getMessageStream(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	lobby, err := ls.repo.Get(id)
+	lobby, err := ls.getRepoLobby(ctx, id)
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	defer func() {
+		ls.unready(context.WithoutCancel(ctx), id, conn.PlayerId())
+	}()
+	defer ls.join(conn, id, cancel)()
 
-	messageChan := messageStream.Subscribe(ctx)
+	messageChan := messageStream.Subscribe(ctx, since, conn.PlayerId())
+	ls.feed.SubscribersChanged(id)
+	defer ls.feed.SubscribersChanged(id)
+	ls.publishMembership(ctx, messageStream, conn, MemberJoined)
+	defer func() {
+		event := MemberLeft
+		if errors.Is(err, ErrTimedOut) || errors.Is(context.Cause(ctx), ErrTimedOut) {
+			event = MemberTimedOut
+		}
+		ls.publishMembership(context.WithoutCancel(ctx), messageStream, conn, event)
+	}()
+	ls.Metrics.SubscriberAdded(conn.Transport())
+	defer ls.Metrics.SubscriberRemoved(conn.Transport())
+
+	logger := ls.Logger.With(slog.String("lobby_id", id), slog.String("transport", conn.Transport()))
+	logger.Debug("subscribed", slog.Uint64("since", since))
+	defer logger.Debug("unsubscribed")
 
 	msg := Message{
 		Type: MetaMessageType,
@@ -68,83 +149,364 @@ func (ls *Service) Subscribe(ctx context.Context, id string, conn Connection) er
 			Name:        lobby.Name,
 			Id:          lobby.Id,
 			Subscribers: messageStream.SubscriberCount(),
+			LastSeq:     messageStream.LastSeq(),
 		},
 	}
 
-	writeTimeout(ctx, time.Second*5, conn, msg)
+	ls.writeTimeout(ctx, time.Second*5, conn, msg)
 
 	for msg = range messageChan {
 		if err != nil {
 			return err
 		}
-		err = writeTimeout(ctx, time.Second*5, conn, msg)
+		err = ls.deliver(ctx, id, conn, msg)
 		if err != nil {
+			ls.Metrics.MessageDropped(id)
 			return err
 		}
+		ls.Metrics.MessageDelivered(id)
+	}
+
+	var operatorErr *operatorError
+	if errors.As(context.Cause(ctx), &operatorErr) {
+		notifyCtx := context.WithoutCancel(ctx)
+		ls.writeTimeout(notifyCtx, time.Second*5, conn, noticeMessage(notifyCtx, operatorErr.kind, operatorErr.reason))
+		return operatorErr
 	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if _, err := ls.getRepoLobby(ctx, id); err != nil {
+		return ErrClosed
+	}
+	ls.Metrics.MessageDropped(id)
+	return ErrTooSlow
+}
+
+// publishMembership tells the subscribers of the lobby that the player on
+// the other end of conn joined or left it.
+func (ls *Service) publishMembership(ctx context.Context, stream MessageStream, conn Connection, event MembershipEvent) {
+	err := stream.Publish(ctx, Message{
+		Type: MembershipMessageType,
+		Membership: MembershipMessage{
+			Event:    event,
+			PlayerId: conn.PlayerId(),
+			Created:  time.Now(),
+		},
+		TraceContext: tracing.Inject(ctx),
+	})
+	if err != nil {
+		ls.Logger.Debug("failed to publish membership", slog.String("event", string(event)), slog.Any("error", err))
+	}
+}
 
-	// Handle: conn.Close(websocket.StatusPolicyViolation, "connection too slow to keep up with messages")
+// deliver writes msg to a single subscriber in a span that is a child of
+// the span the message was published in, linking publish and delivery.
+func (ls *Service) deliver(ctx context.Context, id string, conn Connection, msg Message) error {
+	publishCtx := tracing.Extract(context.Background(), msg.TraceContext)
+	_, span := ls.Tracer.Start(publishCtx, "lobby.Deliver",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(trace.LinkFromContext(ctx)),
+		trace.WithAttributes(
+			attribute.String("lobby.id", id),
+			attribute.String("lobby.transport", conn.Transport()),
+			attribute.Int64("lobby.seq", int64(msg.Seq)),
+		),
+	)
+	defer span.End()
 
-	return ctx.Err()
+	err := ls.writeTimeout(ctx, time.Second*5, conn, msg)
+	tracing.RecordError(span, err)
+	return err
 }
 
-// Publish publishes the msg to all subscribers.
+// Publish publishes the msg of the player to all subscribers, once it has
+// passed the filters of the lobby. A message refused by a filter results in
+// an error wrapping ErrRejected that explains why. Given recipients, the
+// message is whispered to only those players.
 // It never blocks and so messages to slow subscribers
 // are dropped.
-func (ls *Service) Publish(ctx context.Context, id string, msg []byte) {
-	ls.publishLimiter.Wait(ctx)
+func (ls *Service) Publish(ctx context.Context, id string, playerId string, msg []byte, recipients []string) error {
+	return ls.publish(ctx, Submission{
+		LobbyId:    id,
+		PlayerId:   playerId,
+		Type:       TextMessageType,
+		Content:    string(msg),
+		Recipients: recipients,
+	})
+}
+
+// PublishData publishes an application defined payload of the given subtype
+// to all subscribers, or the recipients, the same way Publish does for text.
+func (ls *Service) PublishData(ctx context.Context, id string, playerId string, subtype string, payload []byte, recipients []string) error {
+	if subtype == "" {
+		return Reject("data", "data messages need a subtype")
+	}
+
+	return ls.publish(ctx, Submission{
+		LobbyId:    id,
+		PlayerId:   playerId,
+		Type:       DataMessageType,
+		Subtype:    subtype,
+		Content:    string(payload),
+		Recipients: recipients,
+	})
+}
 
-	stream, err := ls.repo.GetMessageStream(id)
+func (ls *Service) publish(ctx context.Context, submission Submission) (err error) {
+	id := submission.LobbyId
+	ctx, span := ls.Tracer.Start(ctx, "lobby.Publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("lobby.id", id),
+			attribute.String("lobby.message_type", string(submission.Type)),
+		),
+	)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	stream, err := ls.getMessageStream(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = ls.filter(ctx, &submission)
+	var rejected *RejectedError
+	if errors.As(err, &rejected) {
+		ls.Metrics.MessageRejected(rejected.Filter)
+		ls.Logger.Debug("message rejected",
+			slog.String("lobby_id", id),
+			slog.String("player_id", submission.PlayerId),
+			slog.String("filter", rejected.Filter),
+			slog.String("reason", rejected.Reason),
+		)
+		return err
+	}
 	if err != nil {
-		return
+		return err
 	}
 
-	stream.Publish(ctx, Message{
-		Type: TextMessageType,
-		Text: TextMessage{
-			Content: string(msg),
+	msg := Message{
+		Type:         submission.Type,
+		Sender:       submission.PlayerId,
+		Recipients:   submission.Recipients,
+		TraceContext: tracing.Inject(ctx),
+	}
+	switch submission.Type {
+	case TextMessageType:
+		msg.Text = TextMessage{
+			Content: submission.Content,
+			Created: time.Now(),
+		}
+	case DataMessageType:
+		msg.Data = DataMessage{
+			Subtype: submission.Subtype,
+			Payload: []byte(submission.Content),
 			Created: time.Now(),
+		}
+	}
+
+	err = stream.Publish(ctx, msg)
+	if err != nil {
+		ls.Logger.Warn("failed to publish message", slog.String("lobby_id", id), slog.Any("error", err))
+		ls.Metrics.MessageDropped(id)
+		return err
+	}
+	ls.Metrics.MessagePublished(id)
+	return nil
+}
+
+// History returns up to limit messages of the lobby published before the
+// message with sequence number before, oldest first. A before of zero
+// returns the latest messages. Whispers the player cannot see are left out,
+// so fewer than limit messages may be returned.
+func (ls *Service) History(ctx context.Context, id string, playerId string, before uint64, limit int) ([]Message, error) {
+	stream, err := ls.getMessageStream(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := stream.History(before, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := history[:0]
+	for _, msg := range history {
+		if msg.VisibleTo(playerId) {
+			visible = append(visible, msg)
+		}
+	}
+	return visible, nil
+}
+
+func (ls *Service) Delete(ctx context.Context, id string) error {
+	lobby, err := ls.get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = traceRepo(ctx, ls, "Delete", id, func() (struct{}, error) {
+		return struct{}{}, ls.repo.Delete(id)
+	})
+	if err != nil {
+		return err
+	}
+
+	ls.ready.forget(id)
+	ls.feed.Publish(LobbyEvent{Type: LobbyDeletedEvent, Lobby: lobby})
+	ls.Metrics.LobbyDeleted(id)
+	return nil
+}
+
+func (ls *Service) Create(ctx context.Context, name string) (string, error) {
+	repoLobby, err := traceRepo(ctx, ls, "Add", "", func() (RepoLobby, error) {
+		return ls.repo.Add(RepoLobby{Name: name})
+	})
+	if err != nil {
+		return repoLobby.Id, err
+	}
+
+	ls.feed.Publish(LobbyEvent{
+		Type: LobbyCreatedEvent,
+		Lobby: Lobby{
+			Id:      repoLobby.Id,
+			Name:    repoLobby.Name,
+			Created: repoLobby.Created,
 		},
 	})
+	return repoLobby.Id, nil
 }
 
-func (ls *Service) Delete(_ context.Context, id string) error {
-	return ls.repo.Delete(id)
+// Rename changes the name of an existing lobby.
+func (ls *Service) Rename(ctx context.Context, id string, name string) error {
+	repoLobby, err := ls.getRepoLobby(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	repoLobby.Name = name
+	_, err = traceRepo(ctx, ls, "Update", id, func() (RepoLobby, error) {
+		return ls.repo.Update(repoLobby)
+	})
+	if err != nil {
+		return err
+	}
+
+	lobby, err := ls.get(ctx, id)
+	if err != nil {
+		return err
+	}
+	ls.feed.Publish(LobbyEvent{Type: LobbyUpdatedEvent, Lobby: lobby})
+	return nil
 }
 
-func (ls *Service) Create(ctx context.Context, name string) (string, error) {
-	lobby, err := ls.repo.Add(RepoLobby{Name: name})
-	return lobby.Id, err
+// Watch returns a channel of lobby lifecycle events which is closed once
+// ctx is done or the watcher falls too far behind.
+func (ls *Service) Watch(ctx context.Context) <-chan LobbyEvent {
+	return ls.feed.Watch(ctx)
 }
 
-func (ls *Service) List(context.Context) ([]Lobby, error) {
-	repoLobbies, err := ls.repo.List()
+func (ls *Service) List(ctx context.Context) ([]Lobby, error) {
+	if lister, ok := ls.repo.(LobbyLister); ok {
+		return traceRepo(ctx, ls, "ListLobbies", "", lister.ListLobbies)
+	}
+
+	repoLobbies, err := traceRepo(ctx, ls, "List", "", ls.repo.List)
 	if err != nil {
 		return nil, err
 	}
 
 	lobbies := make([]Lobby, len(repoLobbies), len(repoLobbies))
 	for idx, repoLobby := range repoLobbies {
-		stream, err := ls.repo.GetMessageStream(repoLobby.Id)
+		lobby, err := ls.toLobby(ctx, repoLobby)
 		if err != nil {
 			return nil, err
 		}
-
-		lobby := Lobby{
-			Id:          repoLobby.Id,
-			Name:        repoLobby.Name,
-			Created:     repoLobby.Created,
-			Subscribers: stream.SubscriberCount(),
-		}
 		lobbies[idx] = lobby
 	}
 
 	return lobbies, nil
 }
 
-func writeTimeout(ctx context.Context, timeout time.Duration, c Connection, msg Message) error {
-	ctx, cancel := context.WithTimeout(ctx, timeout)
+// Get returns the lobby with the given id.
+func (ls *Service) Get(ctx context.Context, id string) (Lobby, error) {
+	return ls.get(ctx, id)
+}
+
+func (ls *Service) get(ctx context.Context, id string) (Lobby, error) {
+	repoLobby, err := ls.getRepoLobby(ctx, id)
+	if err != nil {
+		return Lobby{}, err
+	}
+	return ls.toLobby(ctx, repoLobby)
+}
+
+func (ls *Service) toLobby(ctx context.Context, repoLobby RepoLobby) (Lobby, error) {
+	stream, err := ls.getMessageStream(ctx, repoLobby.Id)
+	if err != nil {
+		return Lobby{}, err
+	}
+
+	return Lobby{
+		Id:          repoLobby.Id,
+		Name:        repoLobby.Name,
+		Created:     repoLobby.Created,
+		Subscribers: stream.SubscriberCount(),
+	}, nil
+}
+
+func (ls *Service) getRepoLobby(ctx context.Context, id string) (RepoLobby, error) {
+	return traceRepo(ctx, ls, "Get", id, func() (RepoLobby, error) {
+		return ls.repo.Get(id)
+	})
+}
+
+func (ls *Service) getMessageStream(ctx context.Context, id string) (MessageStream, error) {
+	return traceRepo(ctx, ls, "GetMessageStream", id, func() (MessageStream, error) {
+		return ls.repo.GetMessageStream(id)
+	})
+}
+
+// traceRepo runs a repo call in a span named after the operation. The Repo
+// interface does not take a context, so the span is started here instead.
+func traceRepo[T any](ctx context.Context, ls *Service, op string, id string, call func() (T, error)) (T, error) {
+	_, span := ls.Tracer.Start(ctx, "repo."+op, trace.WithAttributes(attribute.String("lobby.id", id)))
+	defer span.End()
+
+	result, err := call()
+	tracing.RecordError(span, err)
+	return result, err
+}
+
+// LobbiesByState counts the lobbies that have subscribers as "active" and
+// the ones that do not as "empty".
+func (ls *Service) LobbiesByState(ctx context.Context) (map[string]int, error) {
+	lobbies, err := ls.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	states := map[string]int{"active": 0, "empty": 0}
+	for _, l := range lobbies {
+		if l.Subscribers > 0 {
+			states["active"]++
+		} else {
+			states["empty"]++
+		}
+	}
+	return states, nil
+}
+
+func (ls *Service) writeTimeout(ctx context.Context, timeout time.Duration, c Connection, msg Message) error {
+	writeCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	return c.WriteMessage(ctx, msg)
+	err := c.WriteMessage(writeCtx, msg)
+	if err != nil && ctx.Err() == nil && errors.Is(writeCtx.Err(), context.DeadlineExceeded) {
+		ls.Metrics.WriteTimedOut(c.Transport())
+	}
+	return err
 }
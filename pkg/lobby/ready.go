@@ -0,0 +1,123 @@
+package lobby
+
+import (
+	"context"
+	"errors"
+	"github.com/lukaspj/go-masterserver/pkg/tracing"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrUnidentified is returned by SetReady for connections that did not tell
+// which player they are.
+var ErrUnidentified = errors.New("only identified players can be ready")
+
+// readiness tracks which players have marked themselves ready in each lobby.
+type readiness struct {
+	lobbies map[string]map[string]struct{}
+	mu      sync.Mutex
+}
+
+func newReadiness() *readiness {
+	return &readiness{
+		lobbies: make(map[string]map[string]struct{}),
+	}
+}
+
+// set records the readiness of the player and reports whether it changed.
+func (r *readiness) set(lobbyId string, playerId string, ready bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	players, ok := r.lobbies[lobbyId]
+	if !ok {
+		if !ready {
+			return false
+		}
+		players = make(map[string]struct{})
+		r.lobbies[lobbyId] = players
+	}
+
+	_, wasReady := players[playerId]
+	if ready {
+		players[playerId] = struct{}{}
+	} else {
+		delete(players, playerId)
+		if len(players) == 0 {
+			delete(r.lobbies, lobbyId)
+		}
+	}
+	return wasReady != ready
+}
+
+func (r *readiness) players(lobbyId string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	players := make([]string, 0, len(r.lobbies[lobbyId]))
+	for playerId := range r.lobbies[lobbyId] {
+		players = append(players, playerId)
+	}
+	sort.Strings(players)
+	return players
+}
+
+func (r *readiness) forget(lobbyId string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.lobbies, lobbyId)
+}
+
+// SetReady marks the player as ready or not ready in the lobby and tells
+// the subscribers of the lobby when that changes.
+// Players are no longer ready once none of their connections are
+// subscribed to the lobby.
+func (ls *Service) SetReady(ctx context.Context, id string, playerId string, ready bool) error {
+	if playerId == "" {
+		return ErrUnidentified
+	}
+
+	stream, err := ls.getMessageStream(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if !ls.ready.set(id, playerId, ready) {
+		return nil
+	}
+
+	err = stream.Publish(ctx, Message{
+		Type:   ReadyMessageType,
+		Sender: playerId,
+		Ready: ReadyMessage{
+			Ready:   ready,
+			Created: time.Now(),
+		},
+		TraceContext: tracing.Inject(ctx),
+	})
+	if err != nil {
+		return err
+	}
+	ls.Metrics.MessagePublished(id)
+	return nil
+}
+
+// unready clears the readiness of a player whose subscription to the lobby
+// ended, unless another of their connections is still subscribed to it.
+func (ls *Service) unready(ctx context.Context, id string, playerId string) {
+	if playerId == "" || ls.connections.subscribed(id, playerId) {
+		return
+	}
+	err := ls.SetReady(ctx, id, playerId, false)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		ls.Logger.Warn("failed to unready player", slog.String("lobby_id", id), slog.Any("error", err))
+	}
+}
+
+// ReadyPlayers lists the players that are ready in the lobby, sorted by id.
+func (ls *Service) ReadyPlayers(id string) []string {
+	return ls.ready.players(id)
+}
@@ -0,0 +1,76 @@
+package lobby
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestLeavingALobbyClearsReadiness(t *testing.T) {
+	service := NewService()
+	id, err := service.Create(context.Background(), "ready")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subscribe := func(conn *recordingConnection) (leave func()) {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			service.Subscribe(ctx, id, 0, conn)
+		}()
+		conn.next(t, MetaMessageType)
+		return func() {
+			cancel()
+			<-done
+		}
+	}
+	ready := func(playerId string) {
+		t.Helper()
+		err := service.SetReady(context.Background(), id, playerId, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	watcher := newRecordingConnection("watcher")
+	defer subscribe(watcher)()
+	// unreadied waits for the watcher to be told the player is not ready.
+	unreadied := func(playerId string) {
+		t.Helper()
+		for {
+			msg := watcher.next(t, ReadyMessageType)
+			if msg.Sender == playerId && !msg.Ready.Ready {
+				return
+			}
+		}
+	}
+	alice, aliceAgain, bob := newRecordingConnection("alice"), newRecordingConnection("alice"), newRecordingConnection("bob")
+	aliceLeaves := subscribe(alice)
+	subscribe(aliceAgain)
+	bobLeaves := subscribe(bob)
+	ready("alice")
+	ready("bob")
+
+	bobLeaves()
+	if players := service.ReadyPlayers(id); !slices.Equal(players, []string{"alice"}) {
+		t.Errorf("ready players %v after bob left, want alice", players)
+	}
+	unreadied("bob")
+
+	// Alice is still in the lobby through her other connection.
+	aliceLeaves()
+	if players := service.ReadyPlayers(id); !slices.Equal(players, []string{"alice"}) {
+		t.Errorf("ready players %v after a connection of alice left, want alice", players)
+	}
+
+	if kicked := service.Kick(id, "alice", "afk"); kicked != 1 {
+		t.Fatalf("kicked %d connections of alice, want 1", kicked)
+	}
+	unreadied("alice")
+	if players := service.ReadyPlayers(id); len(players) != 0 {
+		t.Errorf("ready players %v after alice was kicked, want none", players)
+	}
+}
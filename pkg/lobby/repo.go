@@ -1,10 +1,12 @@
 package lobby
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"golang.org/x/exp/maps"
+	"sync"
 	"time"
 )
 
@@ -21,27 +23,108 @@ type Repo interface {
 	List() ([]RepoLobby, error)
 	Get(id string) (RepoLobby, error)
 	Add(lobby RepoLobby) (RepoLobby, error)
+	Update(lobby RepoLobby) (RepoLobby, error)
 	Delete(id string) error
 	GetMessageStream(id string) (MessageStream, error)
 }
 
+// LobbyLister is implemented by repos that can list their lobbies together
+// with the number of subscribers to each at once, which saves asking the
+// stream of every lobby when the streams are spread over several nodes.
+type LobbyLister interface {
+	ListLobbies() ([]Lobby, error)
+}
+
+type closableMessageStream interface {
+	MessageStream
+	Close() error
+}
+
 type InMemoryRepo struct {
 	Lobbies map[string]RepoLobby
-	streams map[string]*InMemoryMessageStream
+	streams map[string]closableMessageStream
+	store   MessageStore
+	backend MessageBackend
+	mu      sync.RWMutex
 }
 
-func NewInMemoryRepo() *InMemoryRepo {
+// NewInMemoryRepo constructs a repo keeping message history in store. If
+// backend is nil, messages are only delivered to subscribers of this repo.
+func NewInMemoryRepo(store MessageStore, backend MessageBackend) *InMemoryRepo {
 	return &InMemoryRepo{
 		Lobbies: make(map[string]RepoLobby),
-		streams: make(map[string]*InMemoryMessageStream),
+		streams: make(map[string]closableMessageStream),
+		store:   store,
+		backend: backend,
+	}
+}
+
+// Restore adds the lobbies saved by the message store, when it persists
+// lobbies, so that they and their history are back after a restart.
+func (m *InMemoryRepo) Restore() error {
+	lobbyStore, ok := m.store.(LobbyStore)
+	if !ok {
+		return nil
+	}
+
+	lobbies, err := lobbyStore.LoadLobbies()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, l := range lobbies {
+		m.Lobbies[l.Id] = l
+	}
+	return nil
+}
+
+// save persists the lobbies when the message store can.
+func (m *InMemoryRepo) save() error {
+	lobbyStore, ok := m.store.(LobbyStore)
+	if !ok {
+		return nil
 	}
+	return lobbyStore.SaveLobbies(maps.Values(m.Lobbies))
 }
 
 func (m *InMemoryRepo) List() ([]RepoLobby, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	return maps.Values(m.Lobbies), nil
 }
 
+func (m *InMemoryRepo) ListLobbies() ([]Lobby, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lobbies := make([]Lobby, 0, len(m.Lobbies))
+	for _, l := range m.Lobbies {
+		stream, err := m.stream(l.Id)
+		if err != nil {
+			return nil, err
+		}
+		lobbies = append(lobbies, Lobby{
+			Id:          l.Id,
+			Name:        l.Name,
+			Created:     l.Created,
+			Subscribers: stream.SubscriberCount(),
+		})
+	}
+	return lobbies, nil
+}
+
 func (m *InMemoryRepo) Get(id string) (RepoLobby, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.get(id)
+}
+
+func (m *InMemoryRepo) get(id string) (RepoLobby, error) {
 	if l, ok := m.Lobbies[id]; ok {
 		return l, nil
 	}
@@ -49,6 +132,9 @@ func (m *InMemoryRepo) Get(id string) (RepoLobby, error) {
 }
 
 func (m *InMemoryRepo) Add(lobby RepoLobby) (RepoLobby, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if lobby.Id == "" {
 		lobby.Id = uuid.NewString()
 	}
@@ -58,32 +144,240 @@ func (m *InMemoryRepo) Add(lobby RepoLobby) (RepoLobby, error) {
 	if _, ok := m.Lobbies[lobby.Id]; ok {
 		return lobby, fmt.Errorf("failed to add error with id %s: %w", lobby.Id, ErrExists)
 	}
+	if directory, ok := m.backend.(LobbyDirectory); ok {
+		err := directory.AddLobby(context.Background(), lobby)
+		if err != nil {
+			return lobby, fmt.Errorf("failed to add lobby with id %s: %w", lobby.Id, err)
+		}
+	}
 	m.Lobbies[lobby.Id] = lobby
+	err := m.save()
+	if err != nil {
+		delete(m.Lobbies, lobby.Id)
+		return lobby, err
+	}
+	// Subscribe right away rather than on first use, so that messages
+	// published on other nodes are received as they are. A failure is
+	// retried when the lobby is first used.
+	_, _ = m.stream(lobby.Id)
+	return lobby, nil
+}
+
+func (m *InMemoryRepo) Update(lobby RepoLobby) (RepoLobby, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, err := m.get(lobby.Id)
+	if err != nil {
+		return lobby, err
+	}
+	// Creation time is owned by the repo and cannot be changed.
+	lobby.Created = existing.Created
+	if directory, ok := m.backend.(LobbyDirectory); ok {
+		err = directory.UpdateLobby(context.Background(), lobby)
+		if err != nil {
+			return existing, fmt.Errorf("failed to update lobby with id %s: %w", lobby.Id, err)
+		}
+	}
+	m.Lobbies[lobby.Id] = lobby
+	err = m.save()
+	if err != nil {
+		m.Lobbies[lobby.Id] = existing
+		return existing, err
+	}
 	return lobby, nil
 }
 
 func (m *InMemoryRepo) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if _, ok := m.Lobbies[id]; !ok {
 		return ErrNotFound
 	}
+	if directory, ok := m.backend.(LobbyDirectory); ok {
+		err := directory.DeleteLobby(context.Background(), id)
+		if err != nil {
+			return fmt.Errorf("failed to delete lobby with id %s: %w", id, err)
+		}
+	}
+	return m.remove(id)
+}
+
+// Shared tells whether the lobbies are shared with other nodes through a
+// LobbyDirectory, in which case every node holds every lobby.
+func (m *InMemoryRepo) Shared() bool {
+	_, ok := m.backend.(LobbyDirectory)
+	return ok
+}
+
+// Forget removes the lobby from this node only, such as one handed over to
+// another node, leaving it to the other nodes sharing it.
+func (m *InMemoryRepo) Forget(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.remove(id)
+}
+
+// remove deletes the lobby from this node only, closing its stream.
+func (m *InMemoryRepo) remove(id string) error {
+	existing, ok := m.Lobbies[id]
+	if !ok {
+		return nil
+	}
 	delete(m.Lobbies, id)
+	err := m.save()
+	if err != nil {
+		m.Lobbies[id] = existing
+		return err
+	}
 	if stream, ok := m.streams[id]; ok {
-		return stream.Close()
+		delete(m.streams, id)
+		err := stream.Close()
+		if err != nil {
+			return err
+		}
 	}
-	return nil
+	return m.store.Delete(id)
 }
 
 func (m *InMemoryRepo) GetMessageStream(id string) (MessageStream, error) {
-	_, err := m.Get(id)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := m.get(id)
 	if err != nil {
 		return nil, err
 	}
 
-	if _, ok := m.streams[id]; !ok {
-		m.streams[id] = NewInMemoryMessageStream()
+	return m.stream(id)
+}
+
+// stream returns the stream of the lobby, opening it on first use.
+func (m *InMemoryRepo) stream(id string) (closableMessageStream, error) {
+	if stream, ok := m.streams[id]; ok {
+		return stream, nil
+	}
+	stream, err := m.newMessageStream(id)
+	if err != nil {
+		return nil, err
+	}
+	m.streams[id] = stream
+	return stream, nil
+}
+
+// Follow keeps the lobbies of the repo in step with those of the other
+// nodes until ctx is done, when the backend is a LobbyDirectory. It returns
+// once the lobbies that exist have been added and those that no longer do
+// have been removed, and follows the changes from then on in the
+// background.
+func (m *InMemoryRepo) Follow(ctx context.Context) error {
+	directory, ok := m.backend.(LobbyDirectory)
+	if !ok {
+		return nil
+	}
+
+	changes, err := directory.WatchLobbies(ctx)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]bool)
+	for change := range changes {
+		if change.Lobby.Id == "" {
+			err = m.removeAllBut(existing)
+			if err != nil {
+				return err
+			}
+			go func() {
+				for change := range changes {
+					// Failures are retried when the lobby is next used, or
+					// by the next change to it.
+					_ = m.apply(change)
+				}
+			}()
+			return nil
+		}
+
+		existing[change.Lobby.Id] = !change.Deleted
+		err = m.apply(change)
+		if err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return errors.New("lobby directory ended the watch before sending the lobbies")
+}
+
+// apply makes a change from another node to the lobbies on this one.
+func (m *InMemoryRepo) apply(change LobbyChange) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if change.Deleted {
+		return m.remove(change.Lobby.Id)
+	}
+
+	m.Lobbies[change.Lobby.Id] = change.Lobby
+	err := m.save()
+	if err != nil {
+		return err
+	}
+	_, err = m.stream(change.Lobby.Id)
+	return err
+}
+
+// removeAllBut removes the lobbies on this node that are not kept, such as
+// ones restored from disk that were deleted while the node was down.
+func (m *InMemoryRepo) removeAllBut(kept map[string]bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id := range m.Lobbies {
+		if kept[id] {
+			continue
+		}
+		err := m.remove(id)
+		if err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	return m.streams[id], nil
+// Import adds a lobby together with its message history, such as one handed
+// over by another node. The history continues the lobby's sequence.
+func (m *InMemoryRepo) Import(lobby RepoLobby, history []Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.Lobbies[lobby.Id]; ok {
+		return fmt.Errorf("failed to import lobby with id %s: %w", lobby.Id, ErrExists)
+	}
+	for _, msg := range history {
+		err := m.store.Append(lobby.Id, msg)
+		if err != nil {
+			return err
+		}
+	}
+	m.Lobbies[lobby.Id] = lobby
+	err := m.save()
+	if err != nil {
+		delete(m.Lobbies, lobby.Id)
+		return err
+	}
+	return nil
+}
+
+func (m *InMemoryRepo) newMessageStream(id string) (closableMessageStream, error) {
+	if m.backend == nil {
+		return NewInMemoryMessageStream(id, m.store)
+	}
+	return NewBackendMessageStream(id, m.store, m.backend)
 }
 
 var _ Repo = &InMemoryRepo{}
+var _ LobbyLister = &InMemoryRepo{}
@@ -0,0 +1,165 @@
+package lobby
+
+import (
+	"sync"
+	"time"
+)
+
+// MessageStore keeps the message history of every lobby.
+//
+// Messages are appended in sequence order and read back oldest first.
+type MessageStore interface {
+	Append(lobbyId string, msg Message) error
+	// Before returns up to limit of the newest messages with a sequence
+	// number lower than before. A before of zero reads from the end.
+	Before(lobbyId string, before uint64, limit int) ([]Message, error)
+	// After returns up to limit of the oldest messages with a sequence
+	// number greater than after.
+	After(lobbyId string, after uint64, limit int) ([]Message, error)
+	// LastSeq returns the sequence number of the last appended message,
+	// which survives retention so that numbering continues where it left off.
+	LastSeq(lobbyId string) (uint64, error)
+	Delete(lobbyId string) error
+}
+
+// LobbyStore is implemented by message stores that also persist the lobbies
+// themselves, so that lobbies and their history survive restarts together.
+type LobbyStore interface {
+	// LoadLobbies returns the lobbies last saved.
+	LoadLobbies() ([]RepoLobby, error)
+	// SaveLobbies replaces the saved lobbies.
+	SaveLobbies(lobbies []RepoLobby) error
+}
+
+// RetentionPolicy limits how much history a MessageStore keeps per lobby.
+// Zero values disable the respective limit.
+type RetentionPolicy struct {
+	MaxCount int
+	MaxAge   time.Duration
+}
+
+var DefaultRetentionPolicy = RetentionPolicy{
+	MaxCount: 1000,
+}
+
+type storedMessage struct {
+	Stored  time.Time `json:"stored"`
+	Message Message   `json:"message"`
+}
+
+// retain returns the suffix of history that the policy keeps at now.
+func (p RetentionPolicy) retain(history []storedMessage, now time.Time) []storedMessage {
+	if p.MaxCount > 0 && len(history) > p.MaxCount {
+		history = history[len(history)-p.MaxCount:]
+	}
+	if p.MaxAge > 0 {
+		cutoff := now.Add(-p.MaxAge)
+		for len(history) > 0 && history[0].Stored.Before(cutoff) {
+			history = history[1:]
+		}
+	}
+	return history
+}
+
+type lobbyHistory struct {
+	messages []storedMessage
+	lastSeq  uint64
+}
+
+func (h *lobbyHistory) before(before uint64, limit int) []Message {
+	end := len(h.messages)
+	for end > 0 && before != 0 && h.messages[end-1].Message.Seq >= before {
+		end--
+	}
+	start := end - limit
+	if start < 0 {
+		start = 0
+	}
+	return unwrapMessages(h.messages[start:end])
+}
+
+func (h *lobbyHistory) after(after uint64, limit int) []Message {
+	start := 0
+	for start < len(h.messages) && h.messages[start].Message.Seq <= after {
+		start++
+	}
+	end := start + limit
+	if end > len(h.messages) {
+		end = len(h.messages)
+	}
+	return unwrapMessages(h.messages[start:end])
+}
+
+func unwrapMessages(stored []storedMessage) []Message {
+	messages := make([]Message, len(stored))
+	for i, s := range stored {
+		messages[i] = s.Message
+	}
+	return messages
+}
+
+type InMemoryMessageStore struct {
+	Retention RetentionPolicy
+
+	histories map[string]*lobbyHistory
+	mu        sync.Mutex
+}
+
+func NewInMemoryMessageStore(retention RetentionPolicy) *InMemoryMessageStore {
+	return &InMemoryMessageStore{
+		Retention: retention,
+		histories: make(map[string]*lobbyHistory),
+	}
+}
+
+func (m *InMemoryMessageStore) history(lobbyId string) *lobbyHistory {
+	h, ok := m.histories[lobbyId]
+	if !ok {
+		h = &lobbyHistory{}
+		m.histories[lobbyId] = h
+	}
+	h.messages = m.Retention.retain(h.messages, time.Now())
+	return h
+}
+
+func (m *InMemoryMessageStore) Append(lobbyId string, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h := m.history(lobbyId)
+	h.messages = append(h.messages, storedMessage{Stored: time.Now(), Message: msg})
+	h.messages = m.Retention.retain(h.messages, time.Now())
+	h.lastSeq = msg.Seq
+	return nil
+}
+
+func (m *InMemoryMessageStore) Before(lobbyId string, before uint64, limit int) ([]Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.history(lobbyId).before(before, limit), nil
+}
+
+func (m *InMemoryMessageStore) After(lobbyId string, after uint64, limit int) ([]Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.history(lobbyId).after(after, limit), nil
+}
+
+func (m *InMemoryMessageStore) LastSeq(lobbyId string) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.history(lobbyId).lastSeq, nil
+}
+
+func (m *InMemoryMessageStore) Delete(lobbyId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.histories, lobbyId)
+	return nil
+}
+
+var _ MessageStore = &InMemoryMessageStore{}
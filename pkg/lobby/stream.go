@@ -2,16 +2,32 @@ package lobby
 
 import (
 	"context"
-	"golang.org/x/exp/maps"
+	"encoding/json"
+	"errors"
 	"sync"
 	"time"
 )
 
+var ErrClosed = errors.New("stream closed")
+
 type MessageType string
 
 const (
 	TextMessageType MessageType = "text"
 	MetaMessageType MessageType = "meta"
+	GapMessageType  MessageType = "gap"
+	// DataMessageType messages carry application defined payloads, such as
+	// game settings, rather than chat.
+	DataMessageType MessageType = "data"
+	// NoticeMessageType messages come from the server or its operators
+	// rather than from players.
+	NoticeMessageType MessageType = "notice"
+	// ReadyMessageType messages tell that their sender became ready or
+	// stopped being ready.
+	ReadyMessageType MessageType = "ready"
+	// MembershipMessageType messages tell that a player joined or left the
+	// lobby.
+	MembershipMessageType MessageType = "membership"
 )
 
 type TextMessage struct {
@@ -23,114 +39,347 @@ type MetaMessage struct {
 	Name        string `json:"name"`
 	Id          string `json:"id"`
 	Subscribers int    `json:"subscribers"`
+	LastSeq     uint64 `json:"lastSeq"`
+}
+
+// GapMessage tells a resuming subscriber that the messages with sequence
+// numbers From through To (inclusive) are no longer available.
+type GapMessage struct {
+	From uint64 `json:"from"`
+	To   uint64 `json:"to"`
+}
+
+// DataMessage is opaque to the server. In JSON, payloads that are valid
+// JSON are embedded as is and other payloads are base64 encoded as binary.
+//
+// The JSON tags name the fields in the binary encodings of websockets,
+// which hold payloads as they are.
+type DataMessage struct {
+	Subtype string    `json:"subtype"`
+	Payload []byte    `json:"payload"`
+	Created time.Time `json:"created"`
+}
+
+type dataMessageJSON struct {
+	Subtype string          `json:"subtype"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Binary  []byte          `json:"binary,omitempty"`
+	Created time.Time       `json:"created"`
+}
+
+func (d DataMessage) MarshalJSON() ([]byte, error) {
+	data := dataMessageJSON{Subtype: d.Subtype, Created: d.Created}
+	if json.Valid(d.Payload) {
+		data.Payload = d.Payload
+	} else {
+		data.Binary = d.Payload
+	}
+	return json.Marshal(data)
+}
+
+func (d *DataMessage) UnmarshalJSON(b []byte) error {
+	var data dataMessageJSON
+	err := json.Unmarshal(b, &data)
+	if err != nil {
+		return err
+	}
+
+	*d = DataMessage{Subtype: data.Subtype, Payload: data.Binary, Created: data.Created}
+	if len(data.Payload) > 0 {
+		d.Payload = data.Payload
+	}
+	return nil
+}
+
+type NoticeKind string
+
+const (
+	AnnouncementNotice NoticeKind = "announcement"
+	// DirectNotice is sent by the server to specific players.
+	DirectNotice       NoticeKind = "direct"
+	LobbyClosedNotice  NoticeKind = "lobby_closed"
+	KickedNotice       NoticeKind = "kicked"
+	DisconnectedNotice NoticeKind = "disconnected"
+)
+
+type NoticeMessage struct {
+	Kind    NoticeKind `json:"kind"`
+	Content string     `json:"content"`
+	Created time.Time  `json:"created"`
+}
+
+type ReadyMessage struct {
+	Ready   bool      `json:"ready"`
+	Created time.Time `json:"created"`
+}
+
+type MembershipEvent string
+
+const (
+	MemberJoined MembershipEvent = "joined"
+	MemberLeft   MembershipEvent = "left"
+	// MemberTimedOut players disappeared without leaving, such as when
+	// their connection went silent.
+	MemberTimedOut MembershipEvent = "timed_out"
+)
+
+type MembershipMessage struct {
+	Event    MembershipEvent `json:"event"`
+	PlayerId string          `json:"playerId"`
+	Created  time.Time       `json:"created"`
 }
 
 type Message struct {
-	Type MessageType `json:"type"`
-	Text TextMessage `json:"text"`
-	Meta MetaMessage `json:"meta"`
+	// Seq is assigned by the stream on publish and increases by one for
+	// every message in a lobby. Messages that are not part of the stream,
+	// such as meta and gap messages, have a zero Seq.
+	Seq    uint64        `json:"seq"`
+	Type   MessageType   `json:"type"`
+	Text   TextMessage   `json:"text"`
+	Meta   MetaMessage   `json:"meta"`
+	Gap    GapMessage    `json:"gap"`
+	Data   DataMessage   `json:"data"`
+	Notice NoticeMessage `json:"notice"`
+	Ready  ReadyMessage  `json:"ready"`
+
+	Membership MembershipMessage `json:"membership"`
+
+	// Sender is the id of the player who published the message, empty for
+	// messages from the server.
+	Sender string `json:"sender,omitempty"`
+	// Recipients limits delivery to the subscriptions of these players and
+	// the sender. Messages without recipients go to every subscription.
+	Recipients []string `json:"recipients,omitempty"`
+
+	// TraceContext carries the trace of the publish that produced the
+	// message, so that its deliveries are recorded as part of that trace.
+	// It is left out of the JSON sent to clients and stored in histories,
+	// and carried between nodes in an Envelope instead.
+	TraceContext map[string]string `json:"-"`
+}
+
+// VisibleTo reports whether the message is delivered to the player.
+func (m Message) VisibleTo(playerId string) bool {
+	if len(m.Recipients) == 0 {
+		return true
+	}
+	if playerId == "" {
+		return false
+	}
+	if m.Sender == playerId {
+		return true
+	}
+	for _, recipient := range m.Recipients {
+		if recipient == playerId {
+			return true
+		}
+	}
+	return false
 }
 
 type MessageStream interface {
 	Publish(ctx context.Context, msg Message) error
-	Subscribe(ctx context.Context) <-chan Message
+	// Subscribe streams every message with a sequence number greater than
+	// since, replaying what is still in the history first. A since of zero
+	// replays the recent history. Only messages visible to the player are
+	// streamed. The channel is closed when ctx is done, the stream is closed
+	// or the subscriber cannot keep up.
+	Subscribe(ctx context.Context, since uint64, playerId string) <-chan Message
+	// History returns up to limit messages published before the message with
+	// sequence number before, oldest first. A before of zero returns the
+	// latest messages.
+	History(before uint64, limit int) ([]Message, error)
 	SubscriberCount() int
+	LastSeq() uint64
 }
 
-var inMemoryMessageHistorySize = 10
+// inMemoryRecentHistorySize is the number of messages replayed to fresh
+// subscribers, while inMemoryMaxReplaySize bounds how far back a resuming
+// subscriber is caught up before it is sent a gap message instead.
+var inMemoryRecentHistorySize = 10
+var inMemoryMaxReplaySize = 100
 var inMemorySubscriberBufferSize = 20
 
 type InMemoryMessageStream struct {
-	messageHistory []Message
-	input          chan Message
-	subscribers    map[chan Message]any
-	subscribersMu  sync.Mutex
-}
-
-type InMemoryMessageStreamSubscription struct {
-	cb func(str string) error
+	lobbyId string
+	store   MessageStore
+	lastSeq uint64
+	closed  bool
+	// subscribers maps each subscription to the id of its player.
+	subscribers   map[chan Message]string
+	subscribersMu sync.Mutex
 }
 
 func (s *InMemoryMessageStream) SubscriberCount() int {
+	s.subscribersMu.Lock()
+	defer s.subscribersMu.Unlock()
+
 	return len(s.subscribers)
 }
 
+func (s *InMemoryMessageStream) LastSeq() uint64 {
+	s.subscribersMu.Lock()
+	defer s.subscribersMu.Unlock()
+
+	return s.lastSeq
+}
+
+// Publish assigns the next sequence number to msg, appends it to the
+// history and delivers it to every subscriber. It never blocks, subscribers
+// that are too slow to keep up are dropped.
 func (s *InMemoryMessageStream) Publish(ctx context.Context, msg Message) error {
 	s.subscribersMu.Lock()
 	defer s.subscribersMu.Unlock()
 
-	s.input <- msg
+	if s.closed {
+		return ErrClosed
+	}
+
+	msg.Seq = s.lastSeq + 1
+	return s.append(msg)
+}
+
+// deliver appends a message that was already sequenced, such as by a
+// MessageBackend, to the history and delivers it to every subscriber.
+// Messages the stream has already seen are ignored.
+func (s *InMemoryMessageStream) deliver(msg Message) error {
+	s.subscribersMu.Lock()
+	defer s.subscribersMu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	if msg.Seq <= s.lastSeq {
+		return nil
+	}
+	return s.append(msg)
+}
+
+func (s *InMemoryMessageStream) append(msg Message) error {
+	err := s.store.Append(s.lobbyId, msg)
+	if err != nil {
+		return err
+	}
+	s.lastSeq = msg.Seq
+
+	for subscription, playerId := range s.subscribers {
+		if !msg.VisibleTo(playerId) {
+			continue
+		}
+		select {
+		case subscription <- msg:
+		default:
+			s.unsubscribe(subscription)
+		}
+	}
+
 	return nil
 }
 
-func (s *InMemoryMessageStream) Subscribe(ctx context.Context) <-chan Message {
+func (s *InMemoryMessageStream) Subscribe(ctx context.Context, since uint64, playerId string) <-chan Message {
 	s.subscribersMu.Lock()
 	defer s.subscribersMu.Unlock()
 
-	stream := make(chan Message, inMemorySubscriberBufferSize)
-	s.subscribers[stream] = true
-	for _, msg := range s.messageHistory {
-		stream <- msg
+	replay, err := s.replay(since)
+	if err != nil {
+		// Without history the subscriber can still follow along live.
+		replay = nil
 	}
+	stream := make(chan Message, len(replay)+inMemorySubscriberBufferSize)
+	for _, msg := range replay {
+		if msg.VisibleTo(playerId) {
+			stream <- msg
+		}
+	}
+
+	if s.closed {
+		close(stream)
+		return stream
+	}
+	s.subscribers[stream] = playerId
 
 	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				s.subscribersMu.Lock()
-				delete(s.subscribers, stream)
-				close(stream)
-				s.subscribersMu.Unlock()
-				return
-			}
-		}
+		<-ctx.Done()
+		s.subscribersMu.Lock()
+		defer s.subscribersMu.Unlock()
+		s.unsubscribe(stream)
 	}()
 
 	return stream
 }
 
+func (s *InMemoryMessageStream) History(before uint64, limit int) ([]Message, error) {
+	return s.store.Before(s.lobbyId, before, limit)
+}
+
+// replay returns the history a subscriber resuming after since should
+// receive, preceded by a gap message if part of it is not available.
+func (s *InMemoryMessageStream) replay(since uint64) ([]Message, error) {
+	if since == 0 || since > s.lastSeq {
+		// Either a fresh subscriber or one from before the sequence was
+		// reset, both get the recent history.
+		return s.store.Before(s.lobbyId, 0, inMemoryRecentHistorySize)
+	}
+
+	var gap *Message
+	if s.lastSeq-since > uint64(inMemoryMaxReplaySize) {
+		skipTo := s.lastSeq - uint64(inMemoryMaxReplaySize)
+		gap = &Message{Type: GapMessageType, Gap: GapMessage{From: since + 1, To: skipTo}}
+		since = skipTo
+	}
+
+	history, err := s.store.After(s.lobbyId, since, inMemoryMaxReplaySize)
+	if err != nil {
+		return nil, err
+	}
+	firstAvailable := s.lastSeq + 1
+	if len(history) > 0 {
+		firstAvailable = history[0].Seq
+	}
+	if firstAvailable > since+1 {
+		if gap == nil {
+			gap = &Message{Type: GapMessageType, Gap: GapMessage{From: since + 1}}
+		}
+		gap.Gap.To = firstAvailable - 1
+	}
+	if gap == nil {
+		return history, nil
+	}
+	return append([]Message{*gap}, history...), nil
+}
+
+func (s *InMemoryMessageStream) unsubscribe(stream chan Message) {
+	if _, ok := s.subscribers[stream]; !ok {
+		return
+	}
+	delete(s.subscribers, stream)
+	close(stream)
+}
+
 var _ MessageStream = &InMemoryMessageStream{}
 
+// Close ends every subscription and rejects further publishes.
 func (s *InMemoryMessageStream) Close() error {
-	close(s.input)
+	s.subscribersMu.Lock()
+	defer s.subscribersMu.Unlock()
+
+	s.closed = true
+	for subscription := range s.subscribers {
+		s.unsubscribe(subscription)
+	}
 	return nil
 }
 
-func NewInMemoryMessageStream() *InMemoryMessageStream {
-
-	messageStream := &InMemoryMessageStream{
-		messageHistory: make([]Message, 0, inMemoryMessageHistorySize),
-		input:          make(chan Message),
-		subscribers:    make(map[chan Message]any),
+func NewInMemoryMessageStream(lobbyId string, store MessageStore) (*InMemoryMessageStream, error) {
+	lastSeq, err := store.LastSeq(lobbyId)
+	if err != nil {
+		return nil, err
 	}
 
-	go func() {
-		for {
-			select {
-			case msg, ok := <-messageStream.input:
-				if !ok {
-					return
-				}
-
-				messageStream.subscribersMu.Lock()
-
-				// only the last n entries are kept
-				n := inMemoryMessageHistorySize // n > 0 and small
-				if len(messageStream.messageHistory) >= n {
-					copy(messageStream.messageHistory, messageStream.messageHistory[len(messageStream.messageHistory)-n+1:])
-					messageStream.messageHistory = messageStream.messageHistory[:n-1]
-				}
-				messageStream.messageHistory = append(messageStream.messageHistory, msg)
-
-				for _, subscription := range maps.Keys(messageStream.subscribers) {
-					subscription <- msg
-				}
-
-				messageStream.subscribersMu.Unlock()
-				break
-			}
-		}
-	}()
-
-	return messageStream
+	return &InMemoryMessageStream{
+		lobbyId:     lobbyId,
+		store:       store,
+		lastSeq:     lastSeq,
+		subscribers: make(map[chan Message]string),
+	}, nil
 }
@@ -0,0 +1,185 @@
+package lobby
+
+import (
+	"context"
+	"encoding/json"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingConnection hands the messages written to it to a channel.
+type recordingConnection struct {
+	playerId string
+	messages chan Message
+}
+
+func newRecordingConnection(playerId string) *recordingConnection {
+	return &recordingConnection{playerId: playerId, messages: make(chan Message, 64)}
+}
+
+func (c *recordingConnection) WriteMessage(_ context.Context, msg Message) error {
+	c.messages <- msg
+	return nil
+}
+
+func (c *recordingConnection) Transport() string  { return "test" }
+func (c *recordingConnection) PlayerId() string   { return c.playerId }
+func (c *recordingConnection) RemoteAddr() string { return "127.0.0.1:1" }
+
+// next returns the next message of the given type written to the
+// connection.
+func (c *recordingConnection) next(t *testing.T, typ MessageType) Message {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-c.messages:
+			if msg.Type == typ {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("no %s message received", typ)
+		}
+	}
+}
+
+// jsonBackend is a MessageBackend that sequences and passes messages
+// between the streams of a process as JSON, as the backends between nodes
+// do.
+type jsonBackend struct {
+	history     map[string][][]byte
+	subscribers map[string][]chan Message
+	mu          sync.Mutex
+}
+
+func (b *jsonBackend) Publish(_ context.Context, lobbyId string, msg Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.history == nil {
+		b.history = make(map[string][][]byte)
+	}
+	msg.Seq = uint64(len(b.history[lobbyId]) + 1)
+	data, err := json.Marshal(Seal(msg))
+	if err != nil {
+		return err
+	}
+	b.history[lobbyId] = append(b.history[lobbyId], data)
+
+	for _, subscriber := range b.subscribers[lobbyId] {
+		var envelope Envelope
+		err = json.Unmarshal(data, &envelope)
+		if err != nil {
+			return err
+		}
+		subscriber <- envelope.Open()
+	}
+	return nil
+}
+
+func (b *jsonBackend) Subscribe(_ context.Context, lobbyId string, after uint64) (<-chan Message, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subscribers == nil {
+		b.subscribers = make(map[string][]chan Message)
+	}
+	messages := make(chan Message, 64)
+	for _, data := range b.history[lobbyId][min(after, uint64(len(b.history[lobbyId]))):] {
+		var envelope Envelope
+		err := json.Unmarshal(data, &envelope)
+		if err != nil {
+			return nil, err
+		}
+		messages <- envelope.Open()
+	}
+	b.subscribers[lobbyId] = append(b.subscribers[lobbyId], messages)
+	return messages, nil
+}
+
+func TestMessageJSONLeavesOutTraceContext(t *testing.T) {
+	msg := Message{Seq: 1, Type: TextMessageType, TraceContext: map[string]string{"traceparent": "00-abc"}}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "traceparent") {
+		t.Errorf("message JSON %s holds the trace context", data)
+	}
+
+	data, err = json.Marshal(Seal(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var envelope Envelope
+	err = json.Unmarshal(data, &envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened := envelope.Open()
+	if opened.Seq != 1 || opened.TraceContext["traceparent"] != "00-abc" {
+		t.Errorf("opened %+v, want the sealed message with its trace context", opened)
+	}
+}
+
+func TestDeliveriesJoinTheTraceOfTheirPublish(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer provider.Shutdown(context.Background())
+
+	store := NewInMemoryMessageStore(DefaultRetentionPolicy)
+	ls := NewServiceWithRepo(NewInMemoryRepo(store, &jsonBackend{}))
+	ls.Tracer = provider.Tracer("test")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	id, err := ls.Create(ctx, "traced")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := newRecordingConnection("")
+	go ls.Subscribe(ctx, id, 0, conn)
+	conn.next(t, MetaMessageType)
+
+	err = ls.Publish(ctx, id, "", []byte("hello"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := conn.next(t, TextMessageType)
+
+	// The delivery span ends after the message is written.
+	var publish, deliver sdktrace.ReadOnlySpan
+	deadline := time.Now().Add(5 * time.Second)
+	for deliver == nil && time.Now().Before(deadline) {
+		for _, span := range exporter.GetSpans().Snapshots() {
+			switch {
+			case span.Name() == "lobby.Publish":
+				publish = span
+			case span.Name() == "lobby.Deliver" && hasSeq(span, msg.Seq):
+				deliver = span
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if publish == nil || deliver == nil {
+		t.Fatal("publish or delivery span not recorded")
+	}
+	if deliver.Parent().SpanID() != publish.SpanContext().SpanID() {
+		t.Errorf("delivery span is a child of %s, want the publish span %s", deliver.Parent().SpanID(), publish.SpanContext().SpanID())
+	}
+}
+
+func hasSeq(span sdktrace.ReadOnlySpan, seq uint64) bool {
+	for _, attr := range span.Attributes() {
+		if attr.Key == "lobby.seq" && attr.Value.AsInt64() == int64(seq) {
+			return true
+		}
+	}
+	return false
+}
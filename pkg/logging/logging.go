@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"fmt"
+	"github.com/go-chi/chi/v5/middleware"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// New constructs a logger writing records at or above level to w, in
+// either the "text" or "json" format.
+func New(w io.Writer, level string, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	err := lvl.UnmarshalText([]byte(level))
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+}
+
+// RequestLogger returns a middleware logging every request once it has been
+// served, including the request id set by middleware.RequestID.
+func RequestLogger(logger *slog.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			start := time.Now()
+
+			next.ServeHTTP(ww, r)
+
+			ForRequest(logger, r).Info("request served",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", ww.Status()),
+				slog.Int("bytes", ww.BytesWritten()),
+				slog.Duration("duration", time.Since(start)),
+			)
+		})
+	}
+}
+
+// ForRequest annotates logger with the request id and remote address of r.
+func ForRequest(logger *slog.Logger, r *http.Request) *slog.Logger {
+	return logger.With(
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+		slog.String("remote_addr", r.RemoteAddr),
+	)
+}
@@ -0,0 +1,280 @@
+package metrics
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "masterserver"
+
+// Metrics holds the Prometheus collectors of the master server.
+//
+// All methods are safe to call on a nil *Metrics, which records nothing, so
+// components can be used without instrumentation.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	// LobbyLabels labels the message counters with the id of their lobby.
+	// Lobby ids are not bounded, and neither is the number of series then,
+	// so this suits only servers with few, long-lived lobbies.
+	// Defaults to false, which counts the messages of all lobbies together
+	// under an empty lobby label.
+	LobbyLabels bool
+
+	subscribers         *prometheus.GaugeVec
+	tcpConnections      prometheus.Gauge
+	tcpRejected         *prometheus.CounterVec
+	tcpBytesWritten     *prometheus.CounterVec
+	messagesPublished   *prometheus.CounterVec
+	messagesDelivered   *prometheus.CounterVec
+	messagesDropped     *prometheus.CounterVec
+	messagesRejected    *prometheus.CounterVec
+	writeTimeouts       *prometheus.CounterVec
+	httpRequestDuration *prometheus.HistogramVec
+}
+
+// New constructs the collectors and registers them, together with the Go
+// runtime and process collectors, on a new registry.
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		subscribers: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "subscribers",
+			Help:      "Number of connections subscribed to a lobby, by transport.",
+		}, []string{"transport"}),
+		tcpConnections: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tcp_connections_open",
+			Help:      "Number of open TCP protocol connections.",
+		}),
+		tcpRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tcp_connections_rejected_total",
+			Help:      "Number of TCP protocol connections refused or dropped before their first command, by reason.",
+		}, []string{"reason"}),
+		tcpBytesWritten: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tcp_written_bytes_total",
+			Help:      "Number of bytes of TCP protocol frames, by stage: the uncompressed body, or the whole frame as written.",
+		}, []string{"stage"}),
+		messagesPublished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_published_total",
+			Help:      "Number of messages published, by lobby if lobby labels are enabled.",
+		}, []string{"lobby"}),
+		messagesDelivered: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_delivered_total",
+			Help:      "Number of messages written to subscribers, by lobby if lobby labels are enabled.",
+		}, []string{"lobby"}),
+		messagesDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_dropped_total",
+			Help:      "Number of messages that could not be published or delivered, by lobby if lobby labels are enabled.",
+		}, []string{"lobby"}),
+		messagesRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_rejected_total",
+			Help:      "Number of messages refused by moderation filters, by filter.",
+		}, []string{"filter"}),
+		writeTimeouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "write_timeouts_total",
+			Help:      "Number of writes to subscribers that timed out, by transport.",
+		}, []string{"transport"}),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests, by method, route and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "code"}),
+	}
+
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.subscribers,
+		m.tcpConnections,
+		m.tcpRejected,
+		m.tcpBytesWritten,
+		m.messagesPublished,
+		m.messagesDelivered,
+		m.messagesDropped,
+		m.messagesRejected,
+		m.writeTimeouts,
+		m.httpRequestDuration,
+	)
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format. It should
+// be served on an internal address rather than next to the public API.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// CollectLobbyStates registers a gauge of the number of lobbies by state,
+// computed by states at scrape time.
+func (m *Metrics) CollectLobbyStates(states func() map[string]int) {
+	if m == nil {
+		return
+	}
+	m.Registry.MustRegister(&lobbyStateCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "lobbies"),
+			"Number of lobbies, by state.",
+			[]string{"state"}, nil,
+		),
+		states: states,
+	})
+}
+
+type lobbyStateCollector struct {
+	desc   *prometheus.Desc
+	states func() map[string]int
+}
+
+func (c *lobbyStateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *lobbyStateCollector) Collect(ch chan<- prometheus.Metric) {
+	for state, count := range c.states() {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(count), state)
+	}
+}
+
+func (m *Metrics) SubscriberAdded(transport string) {
+	if m == nil {
+		return
+	}
+	m.subscribers.WithLabelValues(transport).Inc()
+}
+
+func (m *Metrics) SubscriberRemoved(transport string) {
+	if m == nil {
+		return
+	}
+	m.subscribers.WithLabelValues(transport).Dec()
+}
+
+func (m *Metrics) TCPConnectionOpened() {
+	if m == nil {
+		return
+	}
+	m.tcpConnections.Inc()
+}
+
+func (m *Metrics) TCPConnectionClosed() {
+	if m == nil {
+		return
+	}
+	m.tcpConnections.Dec()
+}
+
+// TCPConnectionRejected counts a connection refused for the reason, such as
+// "max_connections".
+func (m *Metrics) TCPConnectionRejected(reason string) {
+	if m == nil {
+		return
+	}
+	m.tcpRejected.WithLabelValues(reason).Inc()
+}
+
+// TCPFrameWritten counts the bytes of a frame before compression and as
+// written, whose ratio is the bandwidth saved by compression.
+func (m *Metrics) TCPFrameWritten(uncompressed int, written int) {
+	if m == nil {
+		return
+	}
+	m.tcpBytesWritten.WithLabelValues("uncompressed").Add(float64(uncompressed))
+	m.tcpBytesWritten.WithLabelValues("written").Add(float64(written))
+}
+
+// lobbyLabel is the value of the lobby label of the counters of a message
+// in the lobby.
+func (m *Metrics) lobbyLabel(lobbyId string) string {
+	if !m.LobbyLabels {
+		return ""
+	}
+	return lobbyId
+}
+
+func (m *Metrics) MessagePublished(lobbyId string) {
+	if m == nil {
+		return
+	}
+	m.messagesPublished.WithLabelValues(m.lobbyLabel(lobbyId)).Inc()
+}
+
+func (m *Metrics) MessageDelivered(lobbyId string) {
+	if m == nil {
+		return
+	}
+	m.messagesDelivered.WithLabelValues(m.lobbyLabel(lobbyId)).Inc()
+}
+
+func (m *Metrics) MessageDropped(lobbyId string) {
+	if m == nil {
+		return
+	}
+	m.messagesDropped.WithLabelValues(m.lobbyLabel(lobbyId)).Inc()
+}
+
+func (m *Metrics) MessageRejected(filter string) {
+	if m == nil {
+		return
+	}
+	m.messagesRejected.WithLabelValues(filter).Inc()
+}
+
+// LobbyDeleted removes the per lobby series of a deleted lobby.
+func (m *Metrics) LobbyDeleted(lobbyId string) {
+	if m == nil || !m.LobbyLabels {
+		return
+	}
+	m.messagesPublished.DeleteLabelValues(lobbyId)
+	m.messagesDelivered.DeleteLabelValues(lobbyId)
+	m.messagesDropped.DeleteLabelValues(lobbyId)
+}
+
+func (m *Metrics) WriteTimedOut(transport string) {
+	if m == nil {
+		return
+	}
+	m.writeTimeouts.WithLabelValues(transport).Inc()
+}
+
+// Middleware records the latency of every request, labelled by the chi
+// route pattern rather than the path to keep the number of series bounded.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		m.httpRequestDuration.
+			WithLabelValues(r.Method, route, strconv.Itoa(status)).
+			Observe(time.Since(start).Seconds())
+	})
+}
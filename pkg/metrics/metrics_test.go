@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"testing"
+)
+
+// series returns the number of series of the named metric.
+func series(t *testing.T, m *Metrics, name string) int {
+	t.Helper()
+
+	families, err := m.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == name {
+			return len(family.GetMetric())
+		}
+	}
+	return 0
+}
+
+func TestLobbiesShareSeriesUnlessLabelled(t *testing.T) {
+	for _, labelled := range []bool{false, true} {
+		m := New()
+		m.LobbyLabels = labelled
+		for _, id := range []string{"a", "b", "c"} {
+			m.MessagePublished(id)
+			m.MessageDelivered(id)
+		}
+
+		// A deleted lobby takes its series along only when it has its own.
+		want, wantAfterDelete := 1, 1
+		if labelled {
+			want, wantAfterDelete = 3, 2
+		}
+		for _, name := range []string{"masterserver_messages_published_total", "masterserver_messages_delivered_total"} {
+			if got := series(t, m, name); got != want {
+				t.Errorf("lobby labels %t: %d series of %s, want %d", labelled, got, name, want)
+			}
+		}
+
+		m.LobbyDeleted("a")
+		if got := series(t, m, "masterserver_messages_published_total"); got != wantAfterDelete {
+			t.Errorf("lobby labels %t: %d series after deleting a lobby, want %d", labelled, got, wantAfterDelete)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxLength rejects messages longer than max characters.
+func MaxLength(max int) lobby.Filter {
+	return lobby.FilterFunc(func(_ context.Context, submission *lobby.Submission) error {
+		if utf8.RuneCountInString(submission.Content) > max {
+			return lobby.Reject("length", fmt.Sprintf("message is longer than %d characters", max))
+		}
+		return nil
+	})
+}
+
+// ValidUTF8 rejects messages that are not valid UTF-8.
+func ValidUTF8() lobby.Filter {
+	return lobby.FilterFunc(func(_ context.Context, submission *lobby.Submission) error {
+		if !utf8.ValidString(submission.Content) {
+			return lobby.Reject("utf8", "message is not valid UTF-8")
+		}
+		return nil
+	})
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:[a-z][a-z0-9+.-]*://|www\.)\S+|\b[a-z0-9-]+(?:\.[a-z0-9-]+)*\.(?:com|net|org|io|gg|co|me|tv|xyz|info|ru|de|uk)\b`)
+
+// BlockLinks rejects messages containing URLs or domain names.
+func BlockLinks() lobby.Filter {
+	return lobby.FilterFunc(func(_ context.Context, submission *lobby.Submission) error {
+		if linkPattern.MatchString(submission.Content) {
+			return lobby.Reject("links", "links are not allowed")
+		}
+		return nil
+	})
+}
+
+// Profanity masks the words on a list with asterisks.
+type Profanity struct {
+	pattern *regexp.Regexp
+}
+
+// NewProfanity constructs a filter masking whole, case-insensitive matches
+// of words.
+func NewProfanity(words []string) *Profanity {
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		word = strings.TrimSpace(word)
+		if word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	if len(quoted) == 0 {
+		return &Profanity{}
+	}
+	return &Profanity{
+		pattern: regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`),
+	}
+}
+
+func (p *Profanity) Filter(_ context.Context, submission *lobby.Submission) error {
+	if p.pattern == nil {
+		return nil
+	}
+	submission.Content = p.pattern.ReplaceAllStringFunc(submission.Content, func(word string) string {
+		return strings.Repeat("*", utf8.RuneCountInString(word))
+	})
+	return nil
+}
+
+var _ lobby.Filter = &Profanity{}
+
+// Spam rejects messages a player keeps repeating in a lobby.
+type Spam struct {
+	recent    map[spamKey][]spamEntry
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+type spamKey struct {
+	lobbyId  string
+	playerId string
+}
+
+type spamEntry struct {
+	content string
+	sent    time.Time
+}
+
+func NewSpam() *Spam {
+	return &Spam{
+		recent:    make(map[spamKey][]spamEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// Filter returns a filter rejecting a message once the player has sent it
+// repeats times within window.
+func (s *Spam) Filter(repeats int, window time.Duration) lobby.Filter {
+	return lobby.FilterFunc(func(_ context.Context, submission *lobby.Submission) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		now := time.Now()
+		if now.Sub(s.lastSweep) > window {
+			s.sweep(now, window)
+		}
+
+		key := spamKey{submission.LobbyId, submission.PlayerId}
+		content := strings.ToLower(strings.TrimSpace(submission.Content))
+		entries := prune(s.recent[key], now, window)
+
+		count := 0
+		for _, entry := range entries {
+			if entry.content == content {
+				count++
+			}
+		}
+		if count >= repeats {
+			s.recent[key] = entries
+			return lobby.Reject("spam", "stop repeating the same message")
+		}
+
+		s.recent[key] = append(entries, spamEntry{content: content, sent: now})
+		return nil
+	})
+}
+
+// sweep forgets the players that have not sent anything within window.
+func (s *Spam) sweep(now time.Time, window time.Duration) {
+	for key, entries := range s.recent {
+		entries = prune(entries, now, window)
+		if len(entries) == 0 {
+			delete(s.recent, key)
+		} else {
+			s.recent[key] = entries
+		}
+	}
+	s.lastSweep = now
+}
+
+func prune(entries []spamEntry, now time.Time, window time.Duration) []spamEntry {
+	cutoff := now.Add(-window)
+	for len(entries) > 0 && entries[0].sent.Before(cutoff) {
+		entries = entries[1:]
+	}
+	return entries
+}
+
+// Mute keeps a player from publishing, either to one lobby or, with an
+// empty LobbyId, to all of them.
+type Mute struct {
+	PlayerId string
+	LobbyId  string
+	Reason   string
+	Created  time.Time
+	// Expires is when the mute is lifted, zero for permanent mutes.
+	Expires time.Time
+}
+
+func (m Mute) expired(now time.Time) bool {
+	return !m.Expires.IsZero() && !now.Before(m.Expires)
+}
+
+type muteKey struct {
+	playerId string
+	lobbyId  string
+}
+
+// Mutes rejects messages from muted players.
+type Mutes struct {
+	mutes map[muteKey]Mute
+	mu    sync.RWMutex
+}
+
+func NewMutes() *Mutes {
+	return &Mutes{
+		mutes: make(map[muteKey]Mute),
+	}
+}
+
+// Add mutes the player, replacing an existing mute of them in the lobby.
+func (m *Mutes) Add(mute Mute) Mute {
+	if mute.Created.IsZero() {
+		mute.Created = time.Now()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.mutes[muteKey{mute.PlayerId, mute.LobbyId}] = mute
+	return mute
+}
+
+// Remove lifts the mute of the player in the lobby, reporting whether there
+// was one.
+func (m *Mutes) Remove(playerId string, lobbyId string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := muteKey{playerId, lobbyId}
+	_, ok := m.mutes[key]
+	delete(m.mutes, key)
+	return ok
+}
+
+// List returns every mute in effect, dropping the expired ones.
+func (m *Mutes) List() []Mute {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	mutes := make([]Mute, 0, len(m.mutes))
+	for key, mute := range m.mutes {
+		if mute.expired(now) {
+			delete(m.mutes, key)
+			continue
+		}
+		mutes = append(mutes, mute)
+	}
+	return mutes
+}
+
+func (m *Mutes) Filter(_ context.Context, submission *lobby.Submission) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	for _, lobbyId := range []string{submission.LobbyId, ""} {
+		mute, ok := m.mutes[muteKey{submission.PlayerId, lobbyId}]
+		if !ok || mute.expired(now) {
+			continue
+		}
+		reason := "you are muted"
+		if !mute.Expires.IsZero() {
+			reason += " until " + mute.Expires.UTC().Format(time.RFC3339)
+		}
+		if mute.Reason != "" {
+			reason += ": " + mute.Reason
+		}
+		return lobby.Reject("mute", reason)
+	}
+	return nil
+}
+
+var _ lobby.Filter = &Mutes{}
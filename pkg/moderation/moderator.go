@@ -0,0 +1,161 @@
+package moderation
+
+import (
+	"bufio"
+	"context"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Moderator applies a Policy to every lobby, unless the lobby has a policy
+// of its own, and keeps the mutes of players.
+type Moderator struct {
+	Mutes *Mutes
+
+	defaultPolicy Policy
+	policies      map[string]Policy
+	profanity     *Profanity
+	spam          *Spam
+	mu            sync.RWMutex
+}
+
+func NewModerator(defaultPolicy Policy) *Moderator {
+	return &Moderator{
+		Mutes:         NewMutes(),
+		defaultPolicy: defaultPolicy,
+		policies:      make(map[string]Policy),
+		profanity:     NewProfanity(nil),
+		spam:          NewSpam(),
+	}
+}
+
+// SetWords replaces the profanity list.
+func (m *Moderator) SetWords(words []string) {
+	profanity := NewProfanity(words)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.profanity = profanity
+}
+
+// LoadWords reads the profanity list from a file with a word per line.
+// Empty lines and lines starting with # are skipped.
+func (m *Moderator) LoadWords(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+
+	m.SetWords(words)
+	return nil
+}
+
+func (m *Moderator) DefaultPolicy() Policy {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.defaultPolicy
+}
+
+func (m *Moderator) SetDefaultPolicy(policy Policy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.defaultPolicy = policy
+}
+
+// Policy returns the policy applied to the lobby and whether it is one of
+// its own rather than the default.
+func (m *Moderator) Policy(lobbyId string) (Policy, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	policy, ok := m.policies[lobbyId]
+	if !ok {
+		return m.defaultPolicy, false
+	}
+	return policy, true
+}
+
+// SetPolicy gives the lobby a policy of its own.
+func (m *Moderator) SetPolicy(lobbyId string, policy Policy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.policies[lobbyId] = policy
+}
+
+// ResetPolicy returns the lobby to the default policy, reporting whether it
+// had one of its own.
+func (m *Moderator) ResetPolicy(lobbyId string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.policies[lobbyId]
+	delete(m.policies, lobbyId)
+	return ok
+}
+
+// For returns the filters of the policy of the lobby. Mutes apply to every
+// message while the other filters only inspect text, and profanity is
+// masked last so the other filters see what was sent.
+func (m *Moderator) For(lobbyId string) []lobby.Filter {
+	policy, _ := m.Policy(lobbyId)
+
+	m.mu.RLock()
+	profanity := m.profanity
+	m.mu.RUnlock()
+
+	var text []lobby.Filter
+	if policy.RequireUTF8 {
+		text = append(text, ValidUTF8())
+	}
+	if policy.MaxLength > 0 {
+		text = append(text, MaxLength(policy.MaxLength))
+	}
+	if policy.BlockLinks {
+		text = append(text, BlockLinks())
+	}
+	if policy.SpamRepeats > 0 && policy.SpamWindow > 0 {
+		text = append(text, m.spam.Filter(policy.SpamRepeats, time.Duration(policy.SpamWindow)))
+	}
+	if policy.MaskProfanity {
+		text = append(text, profanity)
+	}
+
+	filters := []lobby.Filter{m.Mutes}
+	for _, f := range text {
+		filters = append(filters, textOnly(f))
+	}
+	return filters
+}
+
+// textOnly applies f to text messages and lets other messages pass.
+func textOnly(f lobby.Filter) lobby.Filter {
+	return lobby.FilterFunc(func(ctx context.Context, submission *lobby.Submission) error {
+		if submission.Type != lobby.TextMessageType {
+			return nil
+		}
+		return f.Filter(ctx, submission)
+	})
+}
+
+var _ lobby.Filters = &Moderator{}
@@ -0,0 +1,62 @@
+package moderation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Policy configures the filters messages to a lobby pass before they are
+// published. Zero values disable the respective filter.
+type Policy struct {
+	// MaxLength is the maximum number of characters in a message.
+	MaxLength int `json:"maxLength"`
+	// RequireUTF8 rejects messages that are not valid UTF-8.
+	RequireUTF8 bool `json:"requireUtf8"`
+	// MaskProfanity replaces the words on the profanity list with asterisks.
+	MaskProfanity bool `json:"maskProfanity"`
+	// BlockLinks rejects messages containing URLs or domain names.
+	BlockLinks bool `json:"blockLinks"`
+	// SpamRepeats rejects a message once the player has sent the same
+	// message this many times within SpamWindow.
+	SpamRepeats int      `json:"spamRepeats"`
+	SpamWindow  Duration `json:"spamWindow"`
+}
+
+var DefaultPolicy = Policy{
+	MaxLength:   1000,
+	RequireUTF8: true,
+}
+
+// LoadPolicy reads a policy from a JSON file. Fields missing from the file
+// keep their value in DefaultPolicy.
+func LoadPolicy(path string) (Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Policy{}, err
+	}
+
+	policy := DefaultPolicy
+	err = json.Unmarshal(data, &policy)
+	if err != nil {
+		return Policy{}, fmt.Errorf("failed to read moderation policy %s: %w", path, err)
+	}
+	return policy, nil
+}
+
+// Duration is a time.Duration written as a string such as "30s" in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
@@ -0,0 +1,82 @@
+package session
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Limits limits the rate of publishes that are not made through a session,
+// such as those made over HTTP, with a limiter per player. Anonymous
+// players share a limiter per address.
+//
+// A nil Limits allows every publish.
+type Limits struct {
+	// Limit is the rate at which each player may publish.
+	//
+	// Defaults to one publish every 100ms.
+	Limit rate.Limit
+
+	// Burst is the number of publishes each player may make at once.
+	//
+	// Defaults to 8, the same as the limiter of a session.
+	Burst int
+
+	limiters map[string]*rate.Limiter
+	swept    time.Time
+	mu       sync.Mutex
+}
+
+// NewLimits constructs limits with the defaults.
+func NewLimits() *Limits {
+	return &Limits{
+		Limit:    rate.Every(time.Millisecond * 100),
+		Burst:    8,
+		limiters: make(map[string]*rate.Limiter),
+	}
+}
+
+// Allow tells whether the player may publish now, using up one of their
+// publishes if so. An empty playerId is limited by the host of remoteAddr.
+func (l *Limits) Allow(playerId string, remoteAddr string) bool {
+	if l == nil {
+		return true
+	}
+
+	key := "player:" + playerId
+	if playerId == "" {
+		host, _, err := net.SplitHostPort(remoteAddr)
+		if err != nil {
+			host = remoteAddr
+		}
+		key = "addr:" + host
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	limiter, ok := l.limiters[key]
+	if !ok {
+		limiter = rate.NewLimiter(l.Limit, l.Burst)
+		l.limiters[key] = limiter
+	}
+	return limiter.AllowN(now, 1)
+}
+
+// sweep forgets, at most once a minute, the limiters that have filled up
+// again, as a new limiter would be the same.
+func (l *Limits) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+	for key, limiter := range l.limiters {
+		if limiter.TokensAt(now) >= float64(limiter.Burst()) {
+			delete(l.limiters, key)
+		}
+	}
+}
@@ -0,0 +1,431 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrNotJoined is returned when a session acts on a lobby it has not joined.
+var ErrNotJoined = errors.New("join the lobby first")
+
+// ErrClosed is returned when writing to a session that has ended.
+var ErrClosed = errors.New("session closed")
+
+// ErrKeepaliveFailed ends sessions whose client stopped answering. The
+// lobbies of the session are told the player timed out.
+var ErrKeepaliveFailed = fmt.Errorf("keepalive failed: %w", lobby.ErrTimedOut)
+
+// Transport delivers to a client over a specific protocol. The session
+// serialises its writes, so transports need not be safe for concurrent use.
+type Transport interface {
+	// Name names the protocol, such as "tcp".
+	Name() string
+	// RemoteAddr is the network address of the client.
+	RemoteAddr() string
+	// WriteMessage writes a lobby message to the client.
+	WriteMessage(ctx context.Context, msg lobby.Message) error
+}
+
+// Pinger is implemented by transports that can check that the client is
+// still there. Pings are serialised with the writes of the session.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Session is a client connected to the server, whatever the transport. It
+// owns the identity of the client, the lobbies it has joined and the queue
+// of writes to it, so that the features built on top of it work the same
+// for every transport.
+type Session struct {
+	// Id identifies the session.
+	Id string
+
+	// QueueSize is the number of writes that can be waiting to be written
+	// to the client before writers block.
+	//
+	// Defaults to 64.
+	QueueSize int
+
+	// WriteTimeout bounds how long a single write to the client may take
+	// before the session is ended.
+	//
+	// Defaults to 5 seconds.
+	WriteTimeout time.Duration
+
+	// KeepaliveInterval is how often transports that implement Pinger are
+	// pinged. The session ends if a ping fails.
+	//
+	// Defaults to 30 seconds, zero disables keepalives.
+	KeepaliveInterval time.Duration
+
+	// Limiter controls the rate at which the client may publish.
+	//
+	// Defaults to one publish every 100ms with a burst of 8.
+	Limiter *rate.Limiter
+
+	// Logger controls where logs are sent.
+	// Defaults to slog.Default().
+	Logger *slog.Logger
+
+	service   *lobby.Service
+	transport Transport
+	playerId  string
+
+	cancel context.CancelCauseFunc
+	queue  chan write
+	// stopped is closed once the writer no longer takes writes.
+	stopped chan struct{}
+
+	// subscriptions counts the lobby subscriptions still running.
+	subscriptions sync.WaitGroup
+	// lobbies holds the ids of the joined lobbies in the order they were
+	// joined, with the function that leaves each.
+	lobbies []*joinedLobby
+	mu      sync.Mutex
+}
+
+type joinedLobby struct {
+	id    string
+	leave context.CancelFunc
+}
+
+type write func(ctx context.Context) error
+
+// New constructs a session with the defaults for the client on the other
+// end of transport, playing as playerId. Clients that do not tell which
+// player they are, with an empty playerId, stay anonymous: they cannot
+// whisper or get ready, and only the Id of their session tells them apart.
+func New(service *lobby.Service, transport Transport, playerId string) *Session {
+	return &Session{
+		Id:                uuid.NewString(),
+		QueueSize:         64,
+		WriteTimeout:      time.Second * 5,
+		KeepaliveInterval: time.Second * 30,
+		Limiter:           rate.NewLimiter(rate.Every(time.Millisecond*100), 8),
+		Logger:            slog.Default(),
+		service:           service,
+		transport:         transport,
+		playerId:          playerId,
+	}
+}
+
+var _ lobby.Connection = &Session{}
+
+// Serve runs the session until serve returns, the client stops answering or
+// an operator disconnects it. serve reads from the client and is expected
+// to return once its context is cancelled. Serve returns why the session
+// ended, which is context.Canceled if serve returned without an error.
+//
+// Before returning, Serve waits for the subscriptions of the session to end
+// and for the writes queued by them to be written.
+func (s *Session) Serve(ctx context.Context, serve func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	s.mu.Lock()
+	s.cancel = cancel
+	s.queue = make(chan write, s.QueueSize)
+	s.stopped = make(chan struct{})
+	s.mu.Unlock()
+
+	defer s.service.Register(s, cancel)()
+
+	stop := make(chan struct{})
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		s.writeLoop(stop)
+	}()
+
+	if pinger, ok := s.transport.(Pinger); ok && s.KeepaliveInterval > 0 {
+		go s.keepalive(ctx, pinger)
+	}
+
+	err := serve(ctx)
+	if err == nil {
+		err = context.Canceled
+	}
+	cancel(err)
+
+	// Let subscriptions tell the client why they ended before the
+	// transport is closed.
+	s.subscriptions.Wait()
+	close(stop)
+	<-written
+
+	return context.Cause(ctx)
+}
+
+// Close ends the session with the given cause.
+func (s *Session) Close(cause error) {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel(cause)
+	}
+}
+
+// Enqueue queues w to be written to the client after the writes queued
+// before it. It blocks while the queue is full.
+func (s *Session) Enqueue(ctx context.Context, w func(ctx context.Context) error) error {
+	s.mu.Lock()
+	queue, stopped := s.queue, s.stopped
+	s.mu.Unlock()
+	if queue == nil {
+		return ErrClosed
+	}
+
+	select {
+	case queue <- w:
+		return nil
+	case <-stopped:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// writeLoop writes queued writes to the client until stop is closed, then
+// writes what is left in the queue.
+func (s *Session) writeLoop(stop <-chan struct{}) {
+	defer close(s.stopped)
+
+	for {
+		select {
+		case w := <-s.queue:
+			s.write(w)
+		case <-stop:
+			for {
+				select {
+				case w := <-s.queue:
+					s.write(w)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *Session) write(w write) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.WriteTimeout)
+	defer cancel()
+
+	err := w(ctx)
+	if err != nil {
+		s.Logger.Debug("write failed", slog.Any("error", err))
+		s.Close(err)
+	}
+}
+
+func (s *Session) keepalive(ctx context.Context, pinger Pinger) {
+	ticker := time.NewTicker(s.KeepaliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := s.Enqueue(ctx, func(ctx context.Context) error {
+			err := pinger.Ping(ctx)
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrKeepaliveFailed, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+}
+
+// WriteMessage queues a lobby message to be written to the client.
+func (s *Session) WriteMessage(ctx context.Context, msg lobby.Message) error {
+	return s.Enqueue(ctx, func(ctx context.Context) error {
+		return s.transport.WriteMessage(ctx, msg)
+	})
+}
+
+func (s *Session) Transport() string {
+	return s.transport.Name()
+}
+
+// PlayerId is the player the client identified as, empty for anonymous
+// clients.
+func (s *Session) PlayerId() string {
+	return s.playerId
+}
+
+func (s *Session) RemoteAddr() string {
+	return s.transport.RemoteAddr()
+}
+
+// Subscribe joins the lobby and delivers its messages to the client until
+// ctx is cancelled, the session leaves the lobby or the subscription fails.
+// A non-zero since resumes after the message with that sequence number.
+// Joining a lobby the session is already in replaces that subscription.
+func (s *Session) Subscribe(ctx context.Context, lobbyId string, since uint64) error {
+	ctx, done := s.join(ctx, lobbyId)
+	defer done()
+
+	return s.service.Subscribe(ctx, lobbyId, since, s)
+}
+
+// Join subscribes to the lobby like Subscribe, but in the background.
+// Subscriptions that fail are logged.
+func (s *Session) Join(ctx context.Context, lobbyId string, since uint64) {
+	ctx, done := s.join(ctx, lobbyId)
+	go func() {
+		defer done()
+
+		err := s.service.Subscribe(ctx, lobbyId, since, s)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			s.Logger.Warn("subscription failed", slog.String("lobby_id", lobbyId), slog.Any("error", err))
+		}
+	}()
+}
+
+// join records that the session joined the lobby until done is called. The
+// returned context is cancelled when the session leaves the lobby.
+func (s *Session) join(ctx context.Context, lobbyId string) (_ context.Context, done func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	s.subscriptions.Add(1)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.leave(lobbyId)
+	joined := &joinedLobby{id: lobbyId, leave: cancel}
+	s.lobbies = append(s.lobbies, joined)
+
+	return ctx, func() {
+		cancel()
+
+		s.mu.Lock()
+		// A later join may have replaced this subscription already.
+		s.lobbies = slices.DeleteFunc(s.lobbies, func(l *joinedLobby) bool {
+			return l == joined
+		})
+		s.mu.Unlock()
+
+		s.subscriptions.Done()
+	}
+}
+
+// Leave ends the subscription of the session to the lobby, reporting
+// whether it had joined it.
+func (s *Session) Leave(lobbyId string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.leave(lobbyId)
+}
+
+func (s *Session) leave(lobbyId string) bool {
+	i := slices.IndexFunc(s.lobbies, func(l *joinedLobby) bool {
+		return l.id == lobbyId
+	})
+	if i < 0 {
+		return false
+	}
+	s.lobbies[i].leave()
+	s.lobbies = slices.Delete(s.lobbies, i, i+1)
+	return true
+}
+
+// Lobbies lists the ids of the lobbies the session has joined, in the order
+// they were joined.
+func (s *Session) Lobbies() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, len(s.lobbies))
+	for i, l := range s.lobbies {
+		ids[i] = l.id
+	}
+	return ids
+}
+
+// Lobby returns the id of the lobby the session joined last, empty if it
+// has not joined any.
+func (s *Session) Lobby() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.lobbies) == 0 {
+		return ""
+	}
+	return s.lobbies[len(s.lobbies)-1].id
+}
+
+func (s *Session) joined(lobbyId string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.ContainsFunc(s.lobbies, func(l *joinedLobby) bool {
+		return l.id == lobbyId
+	})
+}
+
+// Publish publishes a text message from the player to a lobby the session
+// has joined, whispered to the recipients if there are any.
+func (s *Session) Publish(ctx context.Context, lobbyId string, content []byte, recipients []string) error {
+	if !s.joined(lobbyId) {
+		return ErrNotJoined
+	}
+	err := s.Limiter.Wait(ctx)
+	if err != nil {
+		return err
+	}
+	return s.service.Publish(ctx, lobbyId, s.playerId, content, recipients)
+}
+
+// PublishData publishes a data message from the player to a lobby the
+// session has joined, whispered to the recipients if there are any.
+func (s *Session) PublishData(ctx context.Context, lobbyId string, subtype string, payload []byte, recipients []string) error {
+	if !s.joined(lobbyId) {
+		return ErrNotJoined
+	}
+	err := s.Limiter.Wait(ctx)
+	if err != nil {
+		return err
+	}
+	return s.service.PublishData(ctx, lobbyId, s.playerId, subtype, payload, recipients)
+}
+
+// SetReady marks the player as ready or not ready in a lobby the session
+// has joined, toggling it if ready is nil, and returns whether the player
+// is now ready. The player is no longer ready once they leave the lobby.
+func (s *Session) SetReady(ctx context.Context, lobbyId string, ready *bool) (bool, error) {
+	if !s.joined(lobbyId) {
+		return false, ErrNotJoined
+	}
+	err := s.Limiter.Wait(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	now := !slices.Contains(s.service.ReadyPlayers(lobbyId), s.playerId)
+	if ready != nil {
+		now = *ready
+	}
+	err = s.service.SetReady(ctx, lobbyId, s.playerId, now)
+	if err != nil {
+		return false, err
+	}
+	return now, nil
+}
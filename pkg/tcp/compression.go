@@ -0,0 +1,104 @@
+package tcp
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"math"
+	"sync"
+)
+
+// Flags of the compressions a client can offer in its HELLO. Compression
+// needs length prefixed frames, so it is only agreed from version 2 of the
+// protocol.
+const (
+	COMPRESSION_NONE    byte = 0
+	COMPRESSION_DEFLATE byte = 1
+	COMPRESSION_ZSTD    byte = 2
+)
+
+// compressedFrame is set in the length prefix of frames whose body is
+// compressed. Each frame is compressed on its own, and frames below the
+// threshold, or that do not get any smaller, are sent as they are.
+const compressedFrame uint32 = 1 << 31
+
+var errCompression = fmt.Errorf("%w, malformed compressed frame", errInvalidInput)
+
+// zstdEncoder is safe for concurrent use through EncodeAll.
+var zstdEncoder, _ = zstd.NewWriter(nil,
+	zstd.WithEncoderConcurrency(1),
+	zstd.WithEncoderLevel(zstd.SpeedDefault),
+)
+
+var flateWriters = sync.Pool{
+	New: func() any {
+		w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	},
+}
+
+// compress returns the body compressed with the agreed compression, or nil
+// when it should be sent as it is.
+func (s *Subscriber) compress(body []byte) []byte {
+	if s.compression == COMPRESSION_NONE || len(body) < s.compressionThreshold {
+		return nil
+	}
+
+	var compressed []byte
+	switch s.compression {
+	case COMPRESSION_ZSTD:
+		compressed = zstdEncoder.EncodeAll(body, nil)
+	case COMPRESSION_DEFLATE:
+		buf := new(bytes.Buffer)
+		w := flateWriters.Get().(*flate.Writer)
+		defer flateWriters.Put(w)
+		w.Reset(buf)
+		_, err := w.Write(body)
+		if err == nil {
+			err = w.Close()
+		}
+		if err != nil {
+			return nil
+		}
+		compressed = buf.Bytes()
+	}
+
+	if len(compressed) >= len(body) {
+		return nil
+	}
+	return compressed
+}
+
+// decompress returns the body of a compressed frame, refusing bodies that
+// decompress to more than the largest frame accepted.
+func (s *Subscriber) decompress(body []byte) ([]byte, error) {
+	var r io.ReadCloser
+	switch s.compression {
+	case COMPRESSION_ZSTD:
+		d, err := zstd.NewReader(bytes.NewReader(body), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errCompression, err)
+		}
+		r = d.IOReadCloser()
+	case COMPRESSION_DEFLATE:
+		r = flate.NewReader(bytes.NewReader(body))
+	default:
+		return nil, fmt.Errorf("%w, no compression was agreed", errCompression)
+	}
+	defer r.Close()
+
+	limit := int64(math.MaxInt32)
+	if s.maxFrameSize > 0 {
+		limit = int64(s.maxFrameSize)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCompression, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("frame decompresses to more than the %d bytes allowed", limit)
+	}
+	return data, nil
+}
@@ -0,0 +1,164 @@
+package tcp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Version 1 of the protocol ends frames with a tab, so strings, numbers
+// and payloads containing the byte 9 cut them short. Request ids must not
+// contain it either, and commands whose request id does are refused with a
+// SERVER_ERROR answering request 0. From version 2 frames
+// are instead prefixed with their length as a uint32, without a delimiter,
+// and may be compressed, see compression.go.
+const lengthPrefixedFramesVersion byte = 2
+
+// The longest strings of each field in bytes, agreed by both ends whatever
+// their length prefix could hold. Strings that are too long are refused
+// rather than cut short.
+const (
+	// MaxIdLength bounds lobby and player ids, and the names of message
+	// types, events, notice kinds and data subtypes.
+	MaxIdLength = 255
+	// MaxNameLength bounds the names of lobbies.
+	MaxNameLength = 255
+	// MaxContentLength bounds the content of text messages and notices.
+	MaxContentLength = 64 * 1024
+	// MaxErrorLength bounds the descriptions of SERVER_ERROR, which are cut
+	// short to fit instead.
+	MaxErrorLength = 1024
+)
+
+// errInvalidInput is wrapped by the errors of frames the client got wrong,
+// which are described to the client as they are.
+var errInvalidInput = errors.New("invalid input")
+
+var errStringTooLong = errors.New("string too long")
+
+// frame wraps the body of a frame for the agreed version of the protocol.
+func (s *Subscriber) frame(body []byte) []byte {
+	if s.version < lengthPrefixedFramesVersion {
+		return append(body, '\t')
+	}
+
+	length := uint32(len(body))
+	if compressed := s.compress(body); compressed != nil {
+		body = compressed
+		length = uint32(len(body)) | compressedFrame
+	}
+
+	frame := make([]byte, 4, 4+len(body))
+	s.byteOrder.PutUint32(frame, length)
+	return append(frame, body...)
+}
+
+// nextFrame reads the body of the next frame from the client.
+func (s *Subscriber) nextFrame() ([]byte, error) {
+	if s.version < lengthPrefixedFramesVersion {
+		frame, err := s.reader.ReadBytes('\t')
+		if err != nil {
+			return nil, err
+		}
+		return frame[:len(frame)-1], nil
+	}
+
+	var prefix [4]byte
+	_, err := io.ReadFull(s.reader, prefix[:])
+	if err != nil {
+		return nil, err
+	}
+	length := s.byteOrder.Uint32(prefix[:])
+	compressed := length&compressedFrame != 0
+	length &^= compressedFrame
+	if s.maxFrameSize > 0 && int64(length) > int64(s.maxFrameSize) {
+		return nil, fmt.Errorf("frame of %d bytes is larger than the %d allowed", length, s.maxFrameSize)
+	}
+
+	body := make([]byte, length)
+	_, err = io.ReadFull(s.reader, body)
+	if err != nil {
+		return nil, err
+	}
+	if compressed {
+		return s.decompress(body)
+	}
+	return body, nil
+}
+
+// maxStringLength is the longest string of a field with the given maximum
+// that the agreed length prefix can hold.
+func (s *Subscriber) maxStringLength(max int) int {
+	switch s.stringLength {
+	case STRING_LENGTH_VARINT, STRING_LENGTH_32:
+		return min(max, math.MaxUint32)
+	case STRING_LENGTH_16:
+		return min(max, math.MaxUint16)
+	default:
+		return min(max, math.MaxUint8)
+	}
+}
+
+// writeString writes str prefixed with its length, refusing strings longer
+// than max.
+func (s *Subscriber) writeString(buf *bytes.Buffer, str string, max int) error {
+	if len(str) > s.maxStringLength(max) {
+		return fmt.Errorf("%w: %d bytes, at most %d can be written", errStringTooLong, len(str), s.maxStringLength(max))
+	}
+
+	var err error
+	switch s.stringLength {
+	case STRING_LENGTH_VARINT:
+		_, err = buf.Write(binary.AppendUvarint(nil, uint64(len(str))))
+	case STRING_LENGTH_32:
+		err = binary.Write(buf, s.byteOrder, uint32(len(str)))
+	case STRING_LENGTH_16:
+		err = binary.Write(buf, s.byteOrder, uint16(len(str)))
+	default:
+		err = binary.Write(buf, s.byteOrder, byte(len(str)))
+	}
+	if err != nil {
+		return err
+	}
+
+	return binary.Write(buf, s.byteOrder, []byte(str))
+}
+
+// readString reads a length prefixed string from the start of data,
+// returning it and the rest of data. Strings longer than max are refused.
+func (s *Subscriber) readString(data []byte, max int) (string, []byte, error) {
+	var length uint64
+	var width int
+	switch s.stringLength {
+	case STRING_LENGTH_VARINT:
+		length, width = binary.Uvarint(data)
+	case STRING_LENGTH_32:
+		if len(data) >= 4 {
+			length, width = uint64(s.byteOrder.Uint32(data)), 4
+		}
+	case STRING_LENGTH_16:
+		if len(data) >= 2 {
+			length, width = uint64(s.byteOrder.Uint16(data)), 2
+		}
+	default:
+		if len(data) >= 1 {
+			length, width = uint64(data[0]), 1
+		}
+	}
+	if width <= 0 {
+		return "", nil, errors.New("missing or malformed string length")
+	}
+	data = data[width:]
+
+	if length > uint64(s.maxStringLength(max)) {
+		return "", nil, fmt.Errorf("%w: %d bytes, at most %d allowed", errStringTooLong, length, s.maxStringLength(max))
+	}
+	if uint64(len(data)) < length {
+		return "", nil, fmt.Errorf("string of %d bytes cut short", length)
+	}
+
+	return string(data[:length]), data[length:], nil
+}
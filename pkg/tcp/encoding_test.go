@@ -0,0 +1,116 @@
+package tcp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+var stringLengths = []struct {
+	name   string
+	flag   byte
+	holds  int
+	prefix int
+}{
+	{"8 bit", STRING_LENGTH_8, math.MaxUint8, 1},
+	{"16 bit", STRING_LENGTH_16, math.MaxUint16, 2},
+	{"32 bit", STRING_LENGTH_32, math.MaxUint32, 4},
+	{"varint", STRING_LENGTH_VARINT, math.MaxUint32, 0},
+}
+
+func TestStringRoundTripsAtBoundaries(t *testing.T) {
+	for _, sl := range stringLengths {
+		for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			s := &Subscriber{byteOrder: order, stringLength: sl.flag}
+			for _, length := range []int{0, 1, 255, 256, math.MaxUint16, math.MaxUint16 + 1, MaxContentLength} {
+				if length > min(sl.holds, MaxContentLength) {
+					continue
+				}
+				str := strings.Repeat("x", length)
+
+				buf := new(bytes.Buffer)
+				err := s.writeString(buf, str, MaxContentLength)
+				if err != nil {
+					t.Fatalf("%s %s: writing %d bytes: %v", sl.name, order, length, err)
+				}
+				if sl.prefix > 0 && buf.Len() != sl.prefix+length {
+					t.Errorf("%s %s: wrote %d bytes for %d, want a %d byte prefix", sl.name, order, buf.Len(), length, sl.prefix)
+				}
+
+				buf.WriteString("rest")
+				got, rest, err := s.readString(buf.Bytes(), MaxContentLength)
+				if err != nil {
+					t.Fatalf("%s %s: reading %d bytes: %v", sl.name, order, length, err)
+				}
+				if got != str || string(rest) != "rest" {
+					t.Errorf("%s %s: read %d bytes and left %q, want %d bytes and \"rest\"", sl.name, order, len(got), rest, length)
+				}
+			}
+		}
+	}
+}
+
+func TestStringsLongerThanTheirFieldAreRefused(t *testing.T) {
+	for _, sl := range stringLengths {
+		s := &Subscriber{byteOrder: binary.LittleEndian, stringLength: sl.flag}
+		max := min(sl.holds, MaxContentLength)
+
+		buf := new(bytes.Buffer)
+		err := s.writeString(buf, strings.Repeat("x", max), MaxContentLength)
+		if err != nil {
+			t.Errorf("%s: writing the longest string: %v", sl.name, err)
+		}
+		err = s.writeString(new(bytes.Buffer), strings.Repeat("x", max+1), MaxContentLength)
+		if !errors.Is(err, errStringTooLong) {
+			t.Errorf("%s: writing a string one byte too long: got %v, want %v", sl.name, err, errStringTooLong)
+		}
+		err = s.writeString(new(bytes.Buffer), strings.Repeat("x", MaxIdLength+1), MaxIdLength)
+		if !errors.Is(err, errStringTooLong) {
+			t.Errorf("%s: writing an id one byte too long: got %v, want %v", sl.name, err, errStringTooLong)
+		}
+
+		// A length announcing more than the field allows is refused before
+		// the string is read. A single byte cannot announce that much.
+		var data []byte
+		switch sl.flag {
+		case STRING_LENGTH_16:
+			data = binary.LittleEndian.AppendUint16(nil, MaxIdLength+1)
+		case STRING_LENGTH_32:
+			data = binary.LittleEndian.AppendUint32(nil, MaxIdLength+1)
+		case STRING_LENGTH_VARINT:
+			data = binary.AppendUvarint(nil, MaxIdLength+1)
+		default:
+			continue
+		}
+		data = append(data, strings.Repeat("x", MaxIdLength+1)...)
+		_, _, err = s.readString(data, MaxIdLength)
+		if !errors.Is(err, errStringTooLong) {
+			t.Errorf("%s: reading an id one byte too long: got %v, want %v", sl.name, err, errStringTooLong)
+		}
+	}
+}
+
+func TestReadStringRefusesTruncatedInput(t *testing.T) {
+	for _, sl := range stringLengths {
+		s := &Subscriber{byteOrder: binary.LittleEndian, stringLength: sl.flag}
+
+		buf := new(bytes.Buffer)
+		err := s.writeString(buf, "lobby", MaxIdLength)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+
+		_, _, err = s.readString(nil, MaxIdLength)
+		if err == nil {
+			t.Errorf("%s: read a string without a length", sl.name)
+		}
+		_, _, err = s.readString(data[:len(data)-1], MaxIdLength)
+		if err == nil {
+			t.Errorf("%s: read a string cut short", sl.name)
+		}
+	}
+}
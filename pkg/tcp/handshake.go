@@ -0,0 +1,245 @@
+package tcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// ProtocolVersion is the newest version of the protocol the server speaks,
+// and MinProtocolVersion the oldest, which clients that skip the handshake
+// speak.
+const (
+	ProtocolVersion    byte = 2
+	MinProtocolVersion byte = 1
+)
+
+// Flags of the byte orders a client can offer in its HELLO.
+const (
+	BYTE_ORDER_LITTLE_ENDIAN byte = 1 << iota
+	BYTE_ORDER_BIG_ENDIAN
+)
+
+// Flags of the string length prefixes a client can offer in its HELLO,
+// unsigned integers of 8, 16 or 32 bits or unsigned varints.
+const (
+	STRING_LENGTH_8 byte = 1 << iota
+	STRING_LENGTH_16
+	STRING_LENGTH_32
+	// 8 is skipped as the flags could add up to the frame delimiter.
+	_
+	STRING_LENGTH_VARINT
+)
+
+// errHandshake is wrapped by the errors of HELLOs the server cannot agree to.
+var errHandshake = fmt.Errorf("%w, handshake failed", errInvalidInput)
+
+// hello holds what a client offers in its HELLO. The frame holds, after the
+// request id, a byte with the protocol version, the game id with a one byte
+// length and a byte with the flags of each of the supported byte orders,
+// string length widths and compressions.
+type hello struct {
+	version       byte
+	gameId        string
+	byteOrders    byte
+	stringLengths byte
+	compressions  byte
+}
+
+func parseHello(data []byte) (hello, error) {
+	if len(data) < 2 || len(data) != 2+int(data[1])+3 {
+		return hello{}, fmt.Errorf("%w, expected version, game id and features", errHandshake)
+	}
+	features := data[2+data[1]:]
+	return hello{
+		version:       data[0],
+		gameId:        string(data[2 : 2+data[1]]),
+		byteOrders:    features[0],
+		stringLengths: features[1],
+		compressions:  features[2],
+	}, nil
+}
+
+// welcome holds the parameters the server chose from a hello, as flags
+// like those offered.
+type welcome struct {
+	version      byte
+	byteOrder    byte
+	stringLength byte
+	compression  byte
+}
+
+// negotiate chooses the newest version both ends speak, little endian
+// over big endian, the widest string lengths offered, varints first, and
+// zstd over deflate unless compress is false.
+func negotiate(h hello, compress bool) (welcome, error) {
+	if h.version < MinProtocolVersion {
+		return welcome{}, fmt.Errorf("%w, protocol version %d is not supported, the server speaks %d to %d",
+			errHandshake, h.version, MinProtocolVersion, ProtocolVersion)
+	}
+	w := welcome{
+		version:     min(h.version, ProtocolVersion),
+		compression: COMPRESSION_NONE,
+	}
+
+	if h.byteOrders&BYTE_ORDER_LITTLE_ENDIAN != 0 {
+		w.byteOrder = BYTE_ORDER_LITTLE_ENDIAN
+	} else if h.byteOrders&BYTE_ORDER_BIG_ENDIAN != 0 {
+		w.byteOrder = BYTE_ORDER_BIG_ENDIAN
+	} else {
+		return welcome{}, fmt.Errorf("%w, no supported byte order offered", errHandshake)
+	}
+
+	if h.stringLengths&STRING_LENGTH_VARINT != 0 {
+		w.stringLength = STRING_LENGTH_VARINT
+	} else if h.stringLengths&STRING_LENGTH_32 != 0 {
+		w.stringLength = STRING_LENGTH_32
+	} else if h.stringLengths&STRING_LENGTH_16 != 0 {
+		w.stringLength = STRING_LENGTH_16
+	} else if h.stringLengths&STRING_LENGTH_8 != 0 {
+		w.stringLength = STRING_LENGTH_8
+	} else {
+		return welcome{}, fmt.Errorf("%w, no supported string length offered", errHandshake)
+	}
+
+	if compress && w.version >= lengthPrefixedFramesVersion {
+		if h.compressions&COMPRESSION_ZSTD != 0 {
+			w.compression = COMPRESSION_ZSTD
+		} else if h.compressions&COMPRESSION_DEFLATE != 0 {
+			w.compression = COMPRESSION_DEFLATE
+		}
+	}
+
+	return w, nil
+}
+
+// handshake waits for the first frame of the client. Clients that start
+// with a HELLO are answered with a WELCOME and spoken to with the chosen
+// parameters from then on. Older clients that start with any other
+// command keep the defaults, and their command is returned to be handled
+// once the session is served.
+//
+// The HELLO and the WELCOME are always little endian and end with a tab,
+// as frames do in version 1, so that both ends can read them before
+// anything is agreed. Their request ids, and the game id of the HELLO and
+// its length, may hold tabs of their own, so neither is read up to the
+// first tab: the HELLO is read up to the tab after its features, and the
+// WELCOME is always 9 bytes long before its tab.
+func (s *Subscriber) handshake(ctx context.Context) ([]byte, error) {
+	stop := context.AfterFunc(ctx, func() {
+		s.Conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	if s.handshakeTimeout > 0 {
+		s.Conn.SetReadDeadline(time.Now().Add(s.handshakeTimeout))
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	frame, err := s.readFirstFrame()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		s.metrics.TCPConnectionRejected("handshake_timeout")
+		return nil, fmt.Errorf("%w: no command received within %s", lobby.ErrTimedOut, s.handshakeTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	frame = frame[:len(frame)-1]
+	if len(frame) < 5 || TCP_COMMAND(frame[0]) != HELLO {
+		return frame, nil
+	}
+
+	requestId := binary.LittleEndian.Uint32(frame[1:5])
+	writeCtx, cancel := context.WithTimeout(ctx, s.session.WriteTimeout)
+	defer cancel()
+
+	h, err := parseHello(frame[5:])
+	var w welcome
+	if err == nil {
+		w, err = negotiate(h, s.compressionThreshold >= 0)
+	}
+	if err != nil {
+		s.metrics.TCPConnectionRejected("handshake")
+		resp, frameErr := s.errorFrame(HELLO, requestId, err)
+		if frameErr == nil {
+			frameErr = s.write(writeCtx, resp.Bytes())
+		}
+		if frameErr != nil {
+			s.logger.Debug("failed to write error", slog.Any("error", frameErr))
+		}
+		return nil, err
+	}
+
+	resp := new(bytes.Buffer)
+	err = s.writeHeader(resp, WELCOME, requestId)
+	if err != nil {
+		return nil, err
+	}
+	_, err = resp.Write([]byte{w.version, w.byteOrder, w.stringLength, w.compression})
+	if err != nil {
+		return nil, err
+	}
+	err = s.write(writeCtx, resp.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	s.apply(h.gameId, w)
+	s.logger.Debug("handshake completed",
+		slog.Int("version", int(w.version)),
+		slog.Int("string_length", int(s.stringLength)),
+		slog.String("byte_order", s.byteOrder.String()),
+		slog.Int("compression", int(s.compression)),
+	)
+	return nil, nil
+}
+
+// readFirstFrame reads the first frame of the client up to its tab. A
+// HELLO is read on past the tabs within it, up to the tab after its
+// features.
+func (s *Subscriber) readFirstFrame() ([]byte, error) {
+	frame, err := s.reader.ReadBytes('\t')
+	for err == nil && TCP_COMMAND(frame[0]) == HELLO && len(frame)-1 < helloLength(frame) {
+		var more []byte
+		more, err = s.reader.ReadBytes('\t')
+		frame = append(frame, more...)
+	}
+	return frame, err
+}
+
+// helloLength is the length of a HELLO without its tab, or the length of
+// the part before its game id while that is not yet read.
+func helloLength(frame []byte) int {
+	// The command, request id, version and length of the game id.
+	const head = 1 + 4 + 1 + 1
+	if len(frame) < head {
+		return head
+	}
+	return head + int(frame[head-1]) + 3
+}
+
+// apply switches to the parameters of a welcome.
+func (s *Subscriber) apply(gameId string, w welcome) {
+	s.version = w.version
+	s.gameId = gameId
+	s.logger = s.logger.With(slog.String("game_id", gameId))
+	s.session.Logger = s.logger
+
+	s.byteOrder = binary.LittleEndian
+	if w.byteOrder == BYTE_ORDER_BIG_ENDIAN {
+		s.byteOrder = binary.BigEndian
+	}
+	s.stringLength = w.stringLength
+	s.compression = w.compression
+}
@@ -0,0 +1,98 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// startServer serves the protocol on a free local port until the test ends
+// and returns the address to dial.
+func startServer(t *testing.T, server *Server) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.Serve(ctx, listener)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return listener.Addr().String()
+}
+
+func dial(t *testing.T, addr string) net.Conn {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+// helloFrame builds a HELLO offering version 2, little endian, varint
+// string lengths and no compression.
+func helloFrame(requestId uint32, gameId string) []byte {
+	frame := []byte{byte(HELLO)}
+	frame = binary.LittleEndian.AppendUint32(frame, requestId)
+	frame = append(frame, 2, byte(len(gameId)))
+	frame = append(frame, gameId...)
+	frame = append(frame, BYTE_ORDER_LITTLE_ENDIAN, STRING_LENGTH_VARINT, 0)
+	return append(frame, '\t')
+}
+
+func TestHandshakeReadsHelloPastTabs(t *testing.T) {
+	addr := startServer(t, NewServer(lobby.NewService()))
+
+	tests := []struct {
+		name      string
+		requestId uint32
+		gameId    string
+	}{
+		{"tabs in request id", 0x09090909, "game"},
+		{"tab in game id", 1, "my\tgame"},
+		{"game id of 9 bytes", 2, "ninebytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := dial(t, addr)
+			_, err := conn.Write(helloFrame(tt.requestId, tt.gameId))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The WELCOME is 9 bytes long before its tab.
+			welcome := make([]byte, 10)
+			_, err = io.ReadFull(bufio.NewReader(conn), welcome)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if TCP_RESPONSE(welcome[0]) != WELCOME {
+				t.Fatalf("got response %d, want WELCOME", welcome[0])
+			}
+			if id := binary.LittleEndian.Uint32(welcome[1:5]); id != tt.requestId {
+				t.Errorf("request id = %#x, want %#x", id, tt.requestId)
+			}
+			want := []byte{2, BYTE_ORDER_LITTLE_ENDIAN, STRING_LENGTH_VARINT, 0, '\t'}
+			if !bytes.Equal(welcome[5:], want) {
+				t.Errorf("parameters = %v, want %v", welcome[5:], want)
+			}
+		})
+	}
+}
@@ -4,51 +4,287 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"github.com/lukaspj/go-masterserver/pkg/admin"
 	"github.com/lukaspj/go-masterserver/pkg/lobby"
-	"log"
+	"github.com/lukaspj/go-masterserver/pkg/metrics"
+	"github.com/lukaspj/go-masterserver/pkg/session"
+	"github.com/lukaspj/go-masterserver/pkg/tlsconfig"
+	"github.com/lukaspj/go-masterserver/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log/slog"
 	"math"
 	"net"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Server struct {
+	// Addr is the address the server listens on.
+	//
+	// Defaults to ":3001".
+	Addr string
+
 	LobbyService *lobby.Service
+
+	// Metrics records the number of open connections.
+	// Defaults to nil, which records nothing.
+	Metrics *metrics.Metrics
+
+	// Logger controls where logs are sent.
+	// Defaults to slog.Default().
+	Logger *slog.Logger
+
+	// Tracer records a span for every command.
+	// Defaults to the tracer of the global provider.
+	Tracer trace.Tracer
+
+	// Bans rejects connections from banned addresses and players.
+	// Defaults to nil, which bans nobody.
+	Bans *admin.BanList
+
+	// TLSConfig serves the protocol over TLS when set. Clients presenting a
+	// verified certificate are identified by its common name.
+	// Defaults to nil, which serves plain TCP.
+	TLSConfig *tls.Config
+
+	// HeartbeatInterval is how often clients are sent a HEARTBEAT, which
+	// they answer with HEARTBEAT_ACK to show they are still there.
+	//
+	// Defaults to 15 seconds, zero disables heartbeats.
+	HeartbeatInterval time.Duration
+
+	// IdleTimeout closes connections that send nothing for this long. It
+	// should be a few times the HeartbeatInterval.
+	//
+	// Defaults to 60 seconds, zero disables the timeout.
+	IdleTimeout time.Duration
+
+	// WriteTimeout closes connections that take longer than this to accept
+	// a single frame.
+	//
+	// Defaults to 10 seconds.
+	WriteTimeout time.Duration
+
+	// HandshakeTimeout closes connections that do not complete the TLS
+	// handshake or send their first command within this long.
+	//
+	// Defaults to 10 seconds.
+	HandshakeTimeout time.Duration
+
+	// MaxConnections is the number of connections served at once. Further
+	// connections are closed right away.
+	//
+	// Defaults to 10000, zero for no limit.
+	MaxConnections int
+
+	// MaxConnectionsPerIP is the number of connections served at once from
+	// a single IP address.
+	//
+	// Defaults to 32, zero for no limit.
+	MaxConnectionsPerIP int
+
+	// MaxFrameSize is the largest frame accepted from clients that length
+	// prefix their frames. Clients sending larger frames are closed.
+	//
+	// Defaults to 1 MiB, zero for no limit.
+	MaxFrameSize int
+
+	// CompressionThreshold is the size from which frames are compressed
+	// for clients that agree to a compression in their HELLO. Smaller
+	// frames rarely get any smaller.
+	//
+	// Defaults to 512 bytes, negative disables compression.
+	CompressionThreshold int
+
+	listening atomic.Bool
+
+	// connections counts the open connections, in total and by IP.
+	connections      int
+	connectionsPerIP map[string]int
+	connectionsMu    sync.Mutex
 }
 
 func NewServer(service *lobby.Service) *Server {
 	return &Server{
+		Addr:         ":3001",
 		LobbyService: service,
+		Logger:       slog.Default(),
+		Tracer:       otel.Tracer("github.com/lukaspj/go-masterserver/pkg/tcp"),
+
+		HeartbeatInterval: time.Second * 15,
+		IdleTimeout:       time.Second * 60,
+		WriteTimeout:      time.Second * 10,
+		HandshakeTimeout:  time.Second * 10,
+
+		MaxConnections:      10000,
+		MaxConnectionsPerIP: 32,
+		connectionsPerIP:    make(map[string]int),
+
+		MaxFrameSize:         1 << 20,
+		CompressionThreshold: 512,
+	}
+}
+
+// Listening is a health.Check reporting whether the server has bound its
+// address.
+func (s *Server) Listening(_ context.Context) error {
+	if !s.listening.Load() {
+		return errors.New("tcp server is not listening")
 	}
+	return nil
 }
 
 func (s *Server) ListenAndServe(ctx context.Context) error {
-	tcpListener, err := net.Listen("tcp", ":3001")
+	tcpListener, err := net.Listen("tcp", s.Addr)
 	if err != nil {
 		return err
 	}
+	return s.Serve(ctx, tcpListener)
+}
+
+// Serve accepts connections on tcpListener, over TLS when TLSConfig is
+// set, until ctx is done or the listener is closed. The listener is closed
+// when Serve returns.
+func (s *Server) Serve(ctx context.Context, tcpListener net.Listener) error {
+	if s.TLSConfig != nil {
+		tcpListener = tls.NewListener(tcpListener, s.TLSConfig)
+	}
+	s.listening.Store(true)
+	defer s.listening.Store(false)
 
 	defer tcpListener.Close()
+	stop := context.AfterFunc(ctx, func() {
+		tcpListener.Close()
+	})
+	defer stop()
 
+	var backoff time.Duration
 	for {
 		conn, err := tcpListener.Accept()
 		if err != nil {
-			return err
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			// Likely out of file descriptors, so wait for some to be
+			// released rather than giving up on serving, as net/http does.
+			if backoff == 0 {
+				backoff = time.Millisecond * 5
+			} else {
+				backoff = min(backoff*2, time.Second)
+			}
+			s.Logger.Warn("failed to accept connection", slog.Duration("retry_in", backoff), slog.Any("error", err))
+			select {
+			case <-time.After(backoff):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		backoff = 0
+
+		remoteAddr := conn.RemoteAddr().String()
+		if ban, ok := s.Bans.AddrBanned(remoteAddr); ok {
+			s.Logger.Info("rejected banned connection",
+				slog.String("remote_addr", remoteAddr),
+				slog.String("ban", ban.Value),
+			)
+			s.Metrics.TCPConnectionRejected("banned")
+			conn.Close()
+			continue
 		}
 
-		s.subscribe(ctx, conn, s.LobbyService)
+		release, reason := s.admit(remoteAddr)
+		if reason != "" {
+			s.Logger.Debug("rejected connection", slog.String("remote_addr", remoteAddr), slog.String("reason", reason))
+			s.Metrics.TCPConnectionRejected(reason)
+			conn.Close()
+			continue
+		}
+
+		s.subscribe(ctx, conn, s.LobbyService, release)
 	}
 }
 
+// admit counts a new connection from addr against the connection limits.
+// It returns the function that stops counting it once it closes, or why it
+// is refused.
+func (s *Server) admit(addr string) (release func(), reason string) {
+	ip, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		ip = addr
+	}
+
+	s.connectionsMu.Lock()
+	defer s.connectionsMu.Unlock()
+
+	if s.MaxConnections > 0 && s.connections >= s.MaxConnections {
+		return nil, "max_connections"
+	}
+	if s.MaxConnectionsPerIP > 0 && s.connectionsPerIP[ip] >= s.MaxConnectionsPerIP {
+		return nil, "max_connections_per_ip"
+	}
+
+	s.connections++
+	s.connectionsPerIP[ip]++
+	return func() {
+		s.connectionsMu.Lock()
+		defer s.connectionsMu.Unlock()
+
+		s.connections--
+		s.connectionsPerIP[ip]--
+		if s.connectionsPerIP[ip] == 0 {
+			delete(s.connectionsPerIP, ip)
+		}
+	}, ""
+}
+
+// Subscriber adapts a TCP connection to a session, translating between the
+// frames of the protocol and the session.
 type Subscriber struct {
 	Conn         net.Conn
 	LobbyService *lobby.Service
+	reader       *bufio.Reader
+
+	// The parameters agreed in the handshake, see handshake.go.
+	version      byte
+	gameId       string
 	byteOrder    binary.ByteOrder
-	maxStrLength int
-	lobbyId      string
+	stringLength byte
+	compression  byte
+	maxFrameSize int
+	// compressionThreshold is the smallest frame compressed, negative
+	// when compression is not offered.
+	compressionThreshold int
+
+	session     *session.Session
+	idleTimeout time.Duration
+	// watching tells whether lobby events are already written to the
+	// client. Only the goroutine reading commands touches it.
+	watching bool
+	// handshakeTimeout bounds the wait for the first command.
+	handshakeTimeout time.Duration
+	metrics          *metrics.Metrics
+	logger           *slog.Logger
+	tracer           trace.Tracer
 }
 
+var _ session.Transport = &Subscriber{}
+var _ session.Pinger = &Subscriber{}
+
 type TCP_COMMAND byte
 type TCP_RESPONSE byte
 
@@ -58,48 +294,305 @@ const (
 	CREATE_LOBBY
 	JOIN_LOBBY
 	SEND_MESSAGE
+	WATCH_LOBBIES
+	FETCH_HISTORY
+	PING
+	// 9 is skipped as it is the frame delimiter of version 1, '\t'.
+	_
+	SEND_DATA
+	HEARTBEAT_ACK
+	HELLO
 )
 
+var commandNames = map[TCP_COMMAND]string{
+	CLIENT_ERROR:  "CLIENT_ERROR",
+	LIST_LOBBIES:  "LIST_LOBBIES",
+	CREATE_LOBBY:  "CREATE_LOBBY",
+	JOIN_LOBBY:    "JOIN_LOBBY",
+	SEND_MESSAGE:  "SEND_MESSAGE",
+	WATCH_LOBBIES: "WATCH_LOBBIES",
+	FETCH_HISTORY: "FETCH_HISTORY",
+	PING:          "PING",
+	SEND_DATA:     "SEND_DATA",
+	HEARTBEAT_ACK: "HEARTBEAT_ACK",
+	HELLO:         "HELLO",
+}
+
+func (c TCP_COMMAND) String() string {
+	if name, ok := commandNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("UNKNOWN(%d)", byte(c))
+}
+
 const (
 	SERVER_ERROR TCP_RESPONSE = iota + 1
 	LOBBY_LIST
 	LOBBY_CREATED
 	LOBBY_MESSAGE
+	LOBBY_EVENT
+	HISTORY
+	PONG
+	HEARTBEAT
+	// 9 is skipped as it is the frame delimiter of version 1, '\t'.
+	_
+	ACK
+	WELCOME
 )
 
 func (s *Subscriber) Listen(ctx context.Context) {
-	ctx, cancel := context.WithCancel(ctx)
+	// The handshake settles how frames are written before the session starts
+	// writing them.
+	pending, err := s.handshake(ctx)
+	if err != nil {
+		s.logger.Debug("connection closed", slog.Any("error", err))
+		return
+	}
+
+	err = s.session.Serve(ctx, func(ctx context.Context) error {
+		return s.read(ctx, pending)
+	})
+	s.logger.Debug("connection closed", slog.Any("error", err))
+}
+
+// read handles the commands of the client, starting with the pending
+// frame left by the handshake if any, until the connection is closed, goes
+// idle or the session ends.
+func (s *Subscriber) read(ctx context.Context, pending []byte) error {
+	// Unblock the read below when the session ends.
+	stop := context.AfterFunc(ctx, func() {
+		s.Conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
 	for {
-		netData, err := bufio.NewReader(s.Conn).ReadBytes('\t')
+		var err error
+		netData := pending
+		pending = nil
+		if netData == nil {
+			netData, err = s.readFrame(ctx)
+			if netData == nil {
+				return err
+			}
+		}
+
+		// Every frame starts with the command byte and the request id.
+		if len(netData) > 0 && len(netData) < 5 && s.version < lengthPrefixedFramesVersion {
+			command := TCP_COMMAND(netData[0])
+			ok, err := s.skipSplitRequestId(ctx, netData)
+			if !ok {
+				return err
+			}
+			// Echoing the request id would cut the answer short in turn.
+			err = s.writeError(ctx, command, 0, fmt.Errorf("%w, request ids cannot contain a tab (byte 9) before version %d of the protocol", errInvalidInput, lengthPrefixedFramesVersion))
+			if err != nil {
+				s.logger.Debug("failed to write error", slog.Any("error", err))
+			}
+			continue
+		}
+		if len(netData) < 5 {
+			var command TCP_COMMAND
+			if len(netData) > 0 {
+				command = TCP_COMMAND(netData[0])
+			}
+			err = s.writeError(ctx, command, 0, fmt.Errorf("%w, frame too short for a request id", errInvalidInput))
+			if err != nil {
+				s.logger.Debug("failed to write error", slog.Any("error", err))
+			}
+			continue
+		}
+		command := TCP_COMMAND(netData[0])
+		requestId := s.byteOrder.Uint32(netData[1:5])
+		if command == HEARTBEAT_ACK {
+			continue
+		}
+		s.logger.Debug("command received", slog.String("command", command.String()), slog.Uint64("request_id", uint64(requestId)))
+
+		err = s.handle(ctx, command, requestId, netData[5:])
+		if errors.Is(err, lobby.ErrRejected) {
+			s.logger.Debug("command rejected", slog.String("command", command.String()), slog.Any("error", err))
+		} else if err != nil {
+			s.logger.Warn("failed to handle command", slog.String("command", command.String()), slog.Any("error", err))
+		}
 		if err != nil {
-			log.Printf("failed to read bytes for subscriber due to: %+v", err)
-			break
+			err = s.writeError(ctx, command, requestId, err)
+			if err != nil {
+				s.logger.Debug("failed to write error", slog.Any("error", err))
+			}
+		} else if acknowledgedCommands[command] {
+			err = s.writeAck(ctx, command, requestId)
+			if err != nil {
+				s.logger.Debug("failed to write ack", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// skipSplitRequestId reads past the rest of a version 1 frame that a tab in
+// its request id cut short, so the rest is not taken for another command.
+// The frame starts with piece, and its data is dropped with it. It returns
+// false once reading should stop.
+func (s *Subscriber) skipSplitRequestId(ctx context.Context, piece []byte) (bool, error) {
+	// The pieces of the request id were joined by the tabs that split them.
+	idLength := len(piece)
+	for idLength < 5 {
+		next, err := s.readFrame(ctx)
+		if next == nil {
+			return false, err
 		}
+		idLength += 1 + len(next)
+	}
+	return true, nil
+}
 
-		if TCP_COMMAND(netData[0]) == LIST_LOBBIES {
-			log.Printf("list lobbies received")
-			err = s.listLobbies(ctx)
-		} else if TCP_COMMAND(netData[0]) == CREATE_LOBBY {
-			log.Printf("create lobby received")
-			err = s.createLobby(ctx, netData[1:])
-		} else if TCP_COMMAND(netData[0]) == JOIN_LOBBY {
-			log.Printf("join lobby received")
-			err = s.joinLobby(ctx, netData[1:])
-		} else if TCP_COMMAND(netData[0]) == SEND_MESSAGE {
-			log.Printf("send message received")
-			err = s.sendMessage(ctx, netData[1:])
-		} else {
-			log.Printf("unknown command")
+// readFrame reads the next frame, giving up once the client has been idle
+// for too long. It returns no frame once reading should stop.
+func (s *Subscriber) readFrame(ctx context.Context) ([]byte, error) {
+	if s.idleTimeout > 0 {
+		s.Conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+		// The session may have ended before the deadline was moved.
+		if ctx.Err() != nil {
+			return nil, nil
 		}
+	}
+
+	netData, err := s.nextFrame()
+	if ctx.Err() != nil || errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return nil, fmt.Errorf("%w: nothing received for %s", lobby.ErrTimedOut, s.idleTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return netData, nil
+}
+
+// acknowledgedCommands answer with an ACK when they succeed, as they have
+// no response of their own.
+var acknowledgedCommands = map[TCP_COMMAND]bool{
+	JOIN_LOBBY:    true,
+	SEND_MESSAGE:  true,
+	WATCH_LOBBIES: true,
+	SEND_DATA:     true,
+}
+
+// writeHeader starts a frame with the response type and the id of the
+// request it answers, zero for frames no request asked for.
+func (s *Subscriber) writeHeader(resp *bytes.Buffer, response TCP_RESPONSE, requestId uint32) error {
+	err := binary.Write(resp, s.byteOrder, byte(response))
+	if err != nil {
+		return err
+	}
+	return binary.Write(resp, s.byteOrder, requestId)
+}
+
+// writeAck tells the client that a command without a response of its own
+// succeeded.
+func (s *Subscriber) writeAck(ctx context.Context, command TCP_COMMAND, requestId uint32) error {
+	resp := new(bytes.Buffer)
+
+	err := s.writeHeader(resp, ACK, requestId)
+	if err != nil {
+		return err
+	}
+	err = binary.Write(resp, s.byteOrder, byte(command))
+	if err != nil {
+		return err
+	}
+
+	return s.send(ctx, resp)
+}
+
+// send queues a frame to be written to the client.
+func (s *Subscriber) send(ctx context.Context, resp *bytes.Buffer) error {
+	body := resp.Bytes()
+	return s.session.Enqueue(ctx, func(ctx context.Context) error {
+		return s.write(ctx, body)
+	})
+}
 
+// write writes a frame with the given body to the connection, giving up at
+// the deadline of ctx.
+func (s *Subscriber) write(ctx context.Context, body []byte) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		err := s.Conn.SetWriteDeadline(deadline)
 		if err != nil {
-			log.Printf("error occured while parsing received data from client: %+v", err)
+			return err
 		}
 	}
-	cancel()
+	frame := s.frame(body)
+	_, err := s.Conn.Write(frame)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return fmt.Errorf("%w: %w", lobby.ErrTimedOut, err)
+	}
+	if err == nil {
+		s.metrics.TCPFrameWritten(len(body), len(frame))
+	}
+	return err
 }
 
-func (s *Subscriber) listLobbies(ctx context.Context) error {
+// Ping sends a HEARTBEAT carrying the current server time. Clients that
+// do not answer are closed once they have been idle for too long.
+func (s *Subscriber) Ping(ctx context.Context) error {
+	resp := new(bytes.Buffer)
+
+	err := s.writeHeader(resp, HEARTBEAT, 0)
+	if err != nil {
+		return err
+	}
+
+	now, err := time.Now().MarshalBinary()
+	if err != nil {
+		return err
+	}
+	err = binary.Write(resp, s.byteOrder, now)
+	if err != nil {
+		return err
+	}
+
+	return s.write(ctx, resp.Bytes())
+}
+
+// handle runs a single command in its own span.
+func (s *Subscriber) handle(ctx context.Context, command TCP_COMMAND, requestId uint32, data []byte) (err error) {
+	ctx, span := s.tracer.Start(ctx, "tcp "+command.String(),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("tcp.conn_id", s.session.Id),
+			attribute.String("tcp.command", command.String()),
+		),
+	)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	if command == LIST_LOBBIES {
+		return s.listLobbies(ctx, requestId)
+	} else if command == CREATE_LOBBY {
+		return s.createLobby(ctx, requestId, data)
+	} else if command == JOIN_LOBBY {
+		return s.joinLobby(ctx, data)
+	} else if command == SEND_MESSAGE {
+		return s.sendMessage(ctx, data)
+	} else if command == WATCH_LOBBIES {
+		return s.watchLobbies(ctx)
+	} else if command == FETCH_HISTORY {
+		return s.fetchHistory(ctx, requestId, data)
+	} else if command == PING {
+		return s.ping(ctx, requestId, data)
+	} else if command == SEND_DATA {
+		return s.sendData(ctx, data)
+	} else if command == HELLO {
+		return fmt.Errorf("%w, HELLO must be the first command", errInvalidInput)
+	}
+
+	return fmt.Errorf("%w, unknown command %s", errInvalidInput, command)
+}
+
+func (s *Subscriber) listLobbies(ctx context.Context, requestId uint32) error {
 	list, err := s.LobbyService.List(context.Background())
 	if err != nil {
 		return err
@@ -107,19 +600,17 @@ func (s *Subscriber) listLobbies(ctx context.Context) error {
 
 	resp := new(bytes.Buffer)
 
-	err = binary.Write(resp, s.byteOrder, []byte{
-		byte(LOBBY_LIST),
-	})
+	err = s.writeHeader(resp, LOBBY_LIST, requestId)
 	if err != nil {
 		return err
 	}
 
 	for _, l := range list {
-		err = s.writeString(resp, l.Id)
+		err = s.writeString(resp, l.Id, MaxIdLength)
 		if err != nil {
 			return err
 		}
-		err = s.writeString(resp, l.Name)
+		err = s.writeString(resp, l.Name, MaxNameLength)
 		if err != nil {
 			return err
 		}
@@ -137,19 +628,16 @@ func (s *Subscriber) listLobbies(ctx context.Context) error {
 		}
 	}
 
-	err = binary.Write(resp, s.byteOrder, byte('\t'))
-
-	_, err = s.Conn.Write(resp.Bytes())
-	if err != nil {
-		return err
-	}
-	return nil
+	return s.send(ctx, resp)
 }
 
-func (s *Subscriber) createLobby(ctx context.Context, data []byte) error {
+func (s *Subscriber) createLobby(ctx context.Context, requestId uint32, data []byte) error {
 	name := strings.TrimSpace(string(data))
 	if name == "" {
-		return fmt.Errorf("invalid input, cannot be empty name")
+		return fmt.Errorf("%w, cannot be empty name", errInvalidInput)
+	}
+	if len(name) > MaxNameLength {
+		return fmt.Errorf("%w, name cannot be longer than %d bytes", errInvalidInput, MaxNameLength)
 	}
 	lobbyId, err := s.LobbyService.Create(ctx, name)
 	if err != nil {
@@ -158,54 +646,130 @@ func (s *Subscriber) createLobby(ctx context.Context, data []byte) error {
 
 	resp := new(bytes.Buffer)
 
-	err = binary.Write(resp, s.byteOrder, []byte{
-		byte(LOBBY_CREATED),
-	})
+	err = s.writeHeader(resp, LOBBY_CREATED, requestId)
 	if err != nil {
 		return err
 	}
 
-	err = s.writeString(resp, lobbyId)
+	err = s.writeString(resp, lobbyId, MaxIdLength)
 	if err != nil {
 		return err
 	}
 
-	err = binary.Write(resp, s.byteOrder, byte('\t'))
-	if err != nil {
-		return err
+	return s.send(ctx, resp)
+}
+
+// joinLobby subscribes to the lobby given as the first field of data. An
+// optional second field holds the sequence number to resume after.
+func (s *Subscriber) joinLobby(ctx context.Context, data []byte) error {
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return fmt.Errorf("%w, cannot be empty lobby id", errInvalidInput)
 	}
+	lobbyId := fields[0]
 
-	_, err = s.Conn.Write(resp.Bytes())
+	var since uint64
+	if len(fields) > 1 {
+		var err error
+		since, err = strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w, malformed sequence number: %w", errInvalidInput, err)
+		}
+	}
+
+	// Make sure the lobby exists before acknowledging the join.
+	_, err := s.LobbyService.Get(ctx, lobbyId)
 	if err != nil {
 		return err
 	}
 
+	s.session.Join(ctx, lobbyId, since)
 	return nil
 }
 
-func (s *Subscriber) joinLobby(ctx context.Context, data []byte) error {
-	lobbyId := strings.TrimSpace(string(data))
-	s.lobbyId = lobbyId
+// watchLobbies writes lobby events to the client until the session ends.
+// Watching again only acknowledges the command, as the events are written
+// once.
+func (s *Subscriber) watchLobbies(ctx context.Context) error {
+	if s.watching {
+		return nil
+	}
+	s.watching = true
+
+	events := s.LobbyService.Watch(ctx)
 	go func() {
-		err := s.LobbyService.Subscribe(ctx, lobbyId, s)
-		if err != nil {
-			log.Printf("failed to subscribe due to %+v", err)
+		for event := range events {
+			err := s.writeLobbyEvent(ctx, event)
+			if err != nil {
+				s.logger.Warn("failed to write lobby event", slog.Any("error", err))
+				return
+			}
 		}
 	}()
 	return nil
 }
 
+func (s *Subscriber) writeLobbyEvent(ctx context.Context, event lobby.LobbyEvent) error {
+	resp := new(bytes.Buffer)
+
+	err := s.writeHeader(resp, LOBBY_EVENT, 0)
+	if err != nil {
+		return err
+	}
+
+	err = s.writeString(resp, string(event.Type), MaxIdLength)
+	if err != nil {
+		return err
+	}
+	err = s.writeString(resp, event.Lobby.Id, MaxIdLength)
+	if err != nil {
+		return err
+	}
+	err = s.writeString(resp, event.Lobby.Name, MaxNameLength)
+	if err != nil {
+		return err
+	}
+	timeBytes, err := event.Lobby.Created.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	err = binary.Write(resp, s.byteOrder, timeBytes)
+	if err != nil {
+		return err
+	}
+	err = binary.Write(resp, s.byteOrder, uint32(event.Lobby.Subscribers))
+	if err != nil {
+		return err
+	}
+
+	return s.send(ctx, resp)
+}
+
+// WriteMessage writes a LOBBY_MESSAGE frame. It is called by the session,
+// which serialises it with the other writes to the connection.
 func (s *Subscriber) WriteMessage(ctx context.Context, msg lobby.Message) error {
 	resp := new(bytes.Buffer)
 
-	err := binary.Write(resp, s.byteOrder, []byte{
-		byte(LOBBY_MESSAGE),
-	})
+	err := s.writeHeader(resp, LOBBY_MESSAGE, 0)
 	if err != nil {
 		return err
 	}
 
-	err = s.writeString(resp, string(msg.Type))
+	err = s.writeMessage(resp, msg)
+	if err != nil {
+		return err
+	}
+
+	return s.write(ctx, resp.Bytes())
+}
+
+func (s *Subscriber) writeMessage(resp *bytes.Buffer, msg lobby.Message) error {
+	err := s.writeString(resp, string(msg.Type), MaxIdLength)
+	if err != nil {
+		return err
+	}
+
+	err = binary.Write(resp, s.byteOrder, msg.Seq)
 	if err != nil {
 		return err
 	}
@@ -220,17 +784,21 @@ func (s *Subscriber) WriteMessage(ctx context.Context, msg lobby.Message) error
 		if err != nil {
 			return err
 		}
-		err = s.writeString(resp, msg.Text.Content)
+		err = s.writeString(resp, msg.Text.Content, MaxContentLength)
+		if err != nil {
+			return err
+		}
+		err = s.writeAddressing(resp, msg)
 		if err != nil {
 			return err
 		}
 		break
 	case lobby.MetaMessageType:
-		err = s.writeString(resp, msg.Meta.Id)
+		err = s.writeString(resp, msg.Meta.Id, MaxIdLength)
 		if err != nil {
 			return err
 		}
-		err = s.writeString(resp, msg.Meta.Name)
+		err = s.writeString(resp, msg.Meta.Name, MaxNameLength)
 		if err != nil {
 			return err
 		}
@@ -238,43 +806,407 @@ func (s *Subscriber) WriteMessage(ctx context.Context, msg lobby.Message) error
 		if err != nil {
 			return err
 		}
+		err = binary.Write(resp, s.byteOrder, msg.Meta.LastSeq)
+		if err != nil {
+			return err
+		}
+		break
+	case lobby.GapMessageType:
+		err = binary.Write(resp, s.byteOrder, msg.Gap.From)
+		if err != nil {
+			return err
+		}
+		err = binary.Write(resp, s.byteOrder, msg.Gap.To)
+		if err != nil {
+			return err
+		}
+		break
+	case lobby.DataMessageType:
+		err = s.writeString(resp, msg.Data.Subtype, MaxIdLength)
+		if err != nil {
+			return err
+		}
+		created, err := msg.Data.Created.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		err = binary.Write(resp, s.byteOrder, created)
+		if err != nil {
+			return err
+		}
+		err = binary.Write(resp, s.byteOrder, uint32(len(msg.Data.Payload)))
+		if err != nil {
+			return err
+		}
+		err = binary.Write(resp, s.byteOrder, msg.Data.Payload)
+		if err != nil {
+			return err
+		}
+		err = s.writeAddressing(resp, msg)
+		if err != nil {
+			return err
+		}
+		break
+	case lobby.NoticeMessageType:
+		err = s.writeString(resp, string(msg.Notice.Kind), MaxIdLength)
+		if err != nil {
+			return err
+		}
+		created, err := msg.Notice.Created.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		err = binary.Write(resp, s.byteOrder, created)
+		if err != nil {
+			return err
+		}
+		err = s.writeString(resp, msg.Notice.Content, MaxContentLength)
+		if err != nil {
+			return err
+		}
+		break
+	case lobby.MembershipMessageType:
+		err = s.writeString(resp, string(msg.Membership.Event), MaxIdLength)
+		if err != nil {
+			return err
+		}
+		err = s.writeString(resp, msg.Membership.PlayerId, MaxIdLength)
+		if err != nil {
+			return err
+		}
+		created, err := msg.Membership.Created.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		err = binary.Write(resp, s.byteOrder, created)
+		if err != nil {
+			return err
+		}
+		break
+	case lobby.ReadyMessageType:
+		err = s.writeString(resp, msg.Sender, MaxIdLength)
+		if err != nil {
+			return err
+		}
+		err = binary.Write(resp, s.byteOrder, msg.Ready.Ready)
+		if err != nil {
+			return err
+		}
+		created, err := msg.Ready.Created.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		err = binary.Write(resp, s.byteOrder, created)
+		if err != nil {
+			return err
+		}
 		break
 	}
 
-	err = binary.Write(resp, s.byteOrder, byte('\t'))
+	return nil
+}
+
+// writeAddressing writes the sender of a message followed by a byte holding
+// the number of recipients and the id of each recipient.
+func (s *Subscriber) writeAddressing(resp *bytes.Buffer, msg lobby.Message) error {
+	err := s.writeString(resp, msg.Sender, MaxIdLength)
+	if err != nil {
+		return err
+	}
+	if len(msg.Recipients) > math.MaxUint8 {
+		return fmt.Errorf("too many recipients to write")
+	}
+	err = binary.Write(resp, s.byteOrder, uint8(len(msg.Recipients)))
 	if err != nil {
 		return err
 	}
+	for _, recipient := range msg.Recipients {
+		err = s.writeString(resp, recipient, MaxIdLength)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxHistoryLimit bounds the number of messages a single FETCH_HISTORY
+// returns, which is also the default.
+const maxHistoryLimit = 50
+
+// fetchHistory answers with the messages of the lobby given as the first
+// field of data. Optional second and third fields hold the sequence number
+// to read before and the maximum number of messages to return.
+func (s *Subscriber) fetchHistory(ctx context.Context, requestId uint32, data []byte) error {
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 || len(fields) > 3 {
+		return fmt.Errorf("%w, expected lobby id, before and limit", errInvalidInput)
+	}
+	lobbyId := fields[0]
 
-	_, err = s.Conn.Write(resp.Bytes())
+	var before uint64
+	if len(fields) > 1 {
+		var err error
+		before, err = strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w, malformed sequence number: %w", errInvalidInput, err)
+		}
+	}
+
+	limit := maxHistoryLimit
+	if len(fields) > 2 {
+		var err error
+		limit, err = strconv.Atoi(fields[2])
+		if err != nil || limit < 1 || limit > maxHistoryLimit {
+			return fmt.Errorf("%w, limit must be between 1 and %d", errInvalidInput, maxHistoryLimit)
+		}
+	}
+
+	messages, err := s.LobbyService.History(ctx, lobbyId, s.session.PlayerId(), before, limit)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	resp := new(bytes.Buffer)
+
+	err = s.writeHeader(resp, HISTORY, requestId)
+	if err != nil {
+		return err
+	}
+
+	err = s.writeString(resp, lobbyId, MaxIdLength)
+	if err != nil {
+		return err
+	}
+
+	err = binary.Write(resp, s.byteOrder, uint32(len(messages)))
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range messages {
+		err = s.writeMessage(resp, msg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.send(ctx, resp)
 }
 
-func (s *Subscriber) sendMessage(ctx context.Context, data []byte) error {
-	s.LobbyService.Publish(ctx, s.lobbyId, []byte(strings.TrimSpace(string(data))))
-	return nil
+// writeError tells the client that a command failed with a SERVER_ERROR
+// frame holding the command and a description of the error.
+func (s *Subscriber) writeError(ctx context.Context, command TCP_COMMAND, requestId uint32, cmdErr error) error {
+	resp, err := s.errorFrame(command, requestId, cmdErr)
+	if err != nil {
+		return err
+	}
+
+	return s.send(ctx, resp)
 }
 
-func (s *Subscriber) writeString(buf *bytes.Buffer, str string) error {
-	if len(str) > s.maxStrLength {
-		return fmt.Errorf("invalid input: String was too long to write")
+func (s *Subscriber) errorFrame(command TCP_COMMAND, requestId uint32, cmdErr error) (*bytes.Buffer, error) {
+	resp := new(bytes.Buffer)
+
+	err := s.writeHeader(resp, SERVER_ERROR, requestId)
+	if err != nil {
+		return nil, err
+	}
+	err = binary.Write(resp, s.byteOrder, byte(command))
+	if err != nil {
+		return nil, err
+	}
+
+	description := describe(cmdErr)
+	if len(description) > s.maxStringLength(MaxErrorLength) {
+		description = description[:s.maxStringLength(MaxErrorLength)]
+	}
+	err = s.writeString(resp, description, MaxErrorLength)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// describe explains to the client why their command failed, without
+// revealing internal errors, which are logged by the caller instead.
+func describe(err error) string {
+	if errors.Is(err, lobby.ErrNotFound) {
+		return "lobby not found"
+	}
+	if errors.Is(err, errInvalidInput) ||
+		errors.Is(err, lobby.ErrRejected) ||
+		errors.Is(err, lobby.ErrUnidentified) ||
+		errors.Is(err, session.ErrNotJoined) {
+		return err.Error()
+	}
+	return "internal error"
+}
+
+// ping answers with a PONG carrying the current server time followed by the
+// payload of the PING, which clients can use to match the two up and measure
+// the round trip.
+func (s *Subscriber) ping(ctx context.Context, requestId uint32, data []byte) error {
+	resp := new(bytes.Buffer)
+
+	err := s.writeHeader(resp, PONG, requestId)
+	if err != nil {
+		return err
+	}
+
+	now, err := time.Now().MarshalBinary()
+	if err != nil {
+		return err
+	}
+	err = binary.Write(resp, s.byteOrder, now)
+	if err != nil {
+		return err
 	}
 
-	err := binary.Write(buf, s.byteOrder, byte(len(str)))
+	err = binary.Write(resp, s.byteOrder, data)
 	if err != nil {
 		return err
 	}
 
-	return binary.Write(buf, s.byteOrder, []byte(str))
+	return s.send(ctx, resp)
+}
+
+func (s *Subscriber) Name() string {
+	return "tcp"
+}
+
+func (s *Subscriber) RemoteAddr() string {
+	return s.Conn.RemoteAddr().String()
+}
+
+// whisperMarker starts a SEND_MESSAGE frame that is whispered. It is
+// followed by a byte holding the number of recipients, the length prefixed
+// id of each recipient and then the message.
+const whisperMarker = 0
+
+// sendMessage publishes to the lobby the client joined last, as the player
+// named by the client certificate the connection was made with. Clients
+// without one are anonymous and cannot whisper.
+func (s *Subscriber) sendMessage(ctx context.Context, data []byte) error {
+	lobbyId := s.session.Lobby()
+	if lobbyId == "" {
+		return fmt.Errorf("%w, join a lobby before sending messages", errInvalidInput)
+	}
+
+	var recipients []string
+	if len(data) > 0 && data[0] == whisperMarker {
+		if len(data) < 2 {
+			return fmt.Errorf("%w, expected recipient count", errInvalidInput)
+		}
+		count := int(data[1])
+		data = data[2:]
+		for i := 0; i < count; i++ {
+			var recipient string
+			var err error
+			recipient, data, err = s.readString(data, MaxIdLength)
+			if err != nil {
+				return fmt.Errorf("%w, expected %d recipients: %w", errInvalidInput, count, err)
+			}
+			recipients = append(recipients, recipient)
+		}
+		if len(recipients) == 0 {
+			return fmt.Errorf("%w, whispers need at least one recipient", errInvalidInput)
+		}
+	}
+
+	content := strings.TrimSpace(string(data))
+	if len(content) > MaxContentLength {
+		return fmt.Errorf("%w, messages cannot be longer than %d bytes", errInvalidInput, MaxContentLength)
+	}
+
+	return s.session.Publish(ctx, lobbyId, []byte(content), recipients)
+}
+
+// sendData publishes a data message. data holds the length prefixed
+// subtype followed by the raw payload, which runs to the end of the frame.
+// Before version 2 of the protocol it cannot contain a tab.
+func (s *Subscriber) sendData(ctx context.Context, data []byte) error {
+	lobbyId := s.session.Lobby()
+	if lobbyId == "" {
+		return fmt.Errorf("%w, join a lobby before sending data", errInvalidInput)
+	}
+
+	subtype, payload, err := s.readString(data, MaxIdLength)
+	if err != nil {
+		return fmt.Errorf("%w, expected subtype and payload: %w", errInvalidInput, err)
+	}
+
+	return s.session.PublishData(ctx, lobbyId, subtype, payload, nil)
 }
 
-func (s *Server) subscribe(ctx context.Context, conn net.Conn, service *lobby.Service) {
-	// Size of a byte (8 bits) which is all we allocate when writing the string length
-	maxStrLen := int(math.Pow(2, 8))
-	sub := &Subscriber{conn, service, binary.LittleEndian, maxStrLen, ""}
-	go sub.Listen(ctx)
+// subscribe serves conn in its own goroutine, calling release once it is
+// closed.
+func (s *Server) subscribe(ctx context.Context, conn net.Conn, service *lobby.Service, release func()) {
+	s.Metrics.TCPConnectionOpened()
+	go func() {
+		defer release()
+		defer s.Metrics.TCPConnectionClosed()
+		defer conn.Close()
+
+		var playerId string
+		if tlsConn, ok := conn.(*tls.Conn); ok {
+			handshakeCtx := ctx
+			if s.HandshakeTimeout > 0 {
+				var cancel context.CancelFunc
+				handshakeCtx, cancel = context.WithTimeout(ctx, s.HandshakeTimeout)
+				defer cancel()
+			}
+			err := tlsConn.HandshakeContext(handshakeCtx)
+			if err != nil {
+				s.Logger.Debug("tls handshake failed",
+					slog.String("remote_addr", conn.RemoteAddr().String()),
+					slog.Any("error", err),
+				)
+				s.Metrics.TCPConnectionRejected("tls_handshake")
+				return
+			}
+			state := tlsConn.ConnectionState()
+			playerId = tlsconfig.PeerIdentity(&state)
+		}
+		if ban, ok := s.Bans.PlayerBanned(playerId); ok {
+			s.Logger.Info("rejected banned player",
+				slog.String("remote_addr", conn.RemoteAddr().String()),
+				slog.String("ban", ban.Value),
+			)
+			s.Metrics.TCPConnectionRejected("banned")
+			return
+		}
+
+		// Clients that skip the handshake are spoken to with the defaults,
+		// little endian and a single byte for string lengths.
+		sub := &Subscriber{
+			Conn:         conn,
+			LobbyService: service,
+			reader:       bufio.NewReader(conn),
+
+			version:      MinProtocolVersion,
+			byteOrder:    binary.LittleEndian,
+			stringLength: STRING_LENGTH_8,
+			maxFrameSize: s.MaxFrameSize,
+
+			compressionThreshold: s.CompressionThreshold,
+
+			idleTimeout: s.IdleTimeout,
+			tracer:      s.Tracer,
+			metrics:     s.Metrics,
+
+			handshakeTimeout: s.HandshakeTimeout,
+		}
+		sub.session = session.New(service, sub, playerId)
+		sub.session.KeepaliveInterval = s.HeartbeatInterval
+		sub.session.WriteTimeout = s.WriteTimeout
+		sub.logger = s.Logger.With(
+			slog.String("conn_id", sub.session.Id),
+			slog.String("remote_addr", conn.RemoteAddr().String()),
+		)
+		sub.session.Logger = sub.logger
+
+		sub.logger.Debug("connection opened", slog.Bool("trusted", playerId != ""))
+		sub.Listen(ctx)
+	}()
 }
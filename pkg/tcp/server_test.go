@@ -0,0 +1,198 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"github.com/lukaspj/go-masterserver/pkg/lobby"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testClient speaks version 2 of the protocol, with length prefixed frames,
+// little endian and varint string lengths.
+type testClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func connect(t *testing.T, addr string) *testClient {
+	t.Helper()
+
+	c := &testClient{t: t, conn: dial(t, addr)}
+	c.reader = bufio.NewReader(c.conn)
+	_, err := c.conn.Write(helloFrame(1, "game"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	welcome := make([]byte, 10)
+	_, err = io.ReadFull(c.reader, welcome)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if TCP_RESPONSE(welcome[0]) != WELCOME {
+		t.Fatalf("got response %d, want WELCOME", welcome[0])
+	}
+	return c
+}
+
+func (c *testClient) send(command TCP_COMMAND, requestId uint32, data []byte) {
+	c.t.Helper()
+
+	body := []byte{byte(command)}
+	body = binary.LittleEndian.AppendUint32(body, requestId)
+	body = append(body, data...)
+	frame := binary.LittleEndian.AppendUint32(nil, uint32(len(body)))
+	_, err := c.conn.Write(append(frame, body...))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// next returns the body of the next frame.
+func (c *testClient) next() ([]byte, error) {
+	var prefix [4]byte
+	_, err := io.ReadFull(c.reader, prefix[:])
+	if err != nil {
+		return nil, err
+	}
+	body := make([]byte, binary.LittleEndian.Uint32(prefix[:]))
+	_, err = io.ReadFull(c.reader, body)
+	return body, err
+}
+
+// answer returns the body of the next frame answering the request, past
+// the request id, skipping the frames in between.
+func (c *testClient) answer(requestId uint32) (TCP_RESPONSE, []byte) {
+	c.t.Helper()
+
+	for {
+		body, err := c.next()
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		if len(body) >= 5 && binary.LittleEndian.Uint32(body[1:5]) == requestId {
+			return TCP_RESPONSE(body[0]), body[5:]
+		}
+	}
+}
+
+func appendString(data []byte, s string) []byte {
+	return append(binary.AppendUvarint(data, uint64(len(s))), s...)
+}
+
+func TestAnonymousClientsCannotWhisper(t *testing.T) {
+	service := lobby.NewService()
+	id, err := service.Create(context.Background(), "whispers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := connect(t, startServer(t, NewServer(service)))
+
+	c.send(JOIN_LOBBY, 2, []byte(id))
+	if response, _ := c.answer(2); response != ACK {
+		t.Fatalf("join answered %d, want ACK", response)
+	}
+
+	whisper := appendString([]byte{whisperMarker, 1}, "bob")
+	c.send(SEND_MESSAGE, 3, append(whisper, "psst"...))
+	response, body := c.answer(3)
+	if response != SERVER_ERROR || !strings.Contains(string(body), "identified") {
+		t.Errorf("anonymous whisper answered %d %q, want SERVER_ERROR", response, body)
+	}
+
+	c.send(SEND_MESSAGE, 4, []byte("hello"))
+	if response, body := c.answer(4); response != ACK {
+		t.Errorf("anonymous message to the lobby answered %d %q, want ACK", response, body)
+	}
+
+	messages, err := service.History(context.Background(), id, "bob", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range messages {
+		if len(msg.Recipients) > 0 {
+			t.Errorf("bob received a whisper from %q", msg.Sender)
+		}
+	}
+}
+
+func TestTabsInVersion1RequestIdsAreRefused(t *testing.T) {
+	service := lobby.NewService()
+	_, err := service.Create(context.Background(), "listed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := dial(t, startServer(t, NewServer(service)))
+	reader := bufio.NewReader(conn)
+
+	// answer returns the next frame answering the request, skipping the
+	// frames in between.
+	answer := func(requestId uint32) (TCP_RESPONSE, []byte) {
+		t.Helper()
+		for {
+			frame, err := reader.ReadBytes('\t')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(frame) >= 6 && binary.LittleEndian.Uint32(frame[1:5]) == requestId {
+				return TCP_RESPONSE(frame[0]), frame[5 : len(frame)-1]
+			}
+		}
+	}
+
+	for _, requestId := range []uint32{9, 0x0909, 0x09000102} {
+		frame := binary.LittleEndian.AppendUint32([]byte{byte(JOIN_LOBBY)}, requestId)
+		frame = append(frame, "unknown\t"...)
+		frame = binary.LittleEndian.AppendUint32(append(frame, byte(LIST_LOBBIES)), 2)
+		_, err := conn.Write(append(frame, '\t'))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		response, body := answer(0)
+		if response != SERVER_ERROR || !strings.Contains(string(body), "tab") {
+			t.Errorf("request id %#x answered %d %q, want SERVER_ERROR", requestId, response, body)
+		}
+		if response, _ := answer(2); response != LOBBY_LIST {
+			t.Errorf("command after request id %#x answered %d, want LOBBY_LIST", requestId, response)
+		}
+	}
+}
+
+func TestWatchingLobbiesTwiceWritesEventsOnce(t *testing.T) {
+	service := lobby.NewService()
+	c := connect(t, startServer(t, NewServer(service)))
+
+	for requestId := uint32(2); requestId <= 3; requestId++ {
+		c.send(WATCH_LOBBIES, requestId, nil)
+		if response, body := c.answer(requestId); response != ACK {
+			t.Fatalf("watch %d answered %d %q, want ACK", requestId, response, body)
+		}
+	}
+
+	_, err := service.Create(context.Background(), "watched")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Duplicated events follow the first one closely.
+	created := 0
+	for {
+		body, err := c.next()
+		if err != nil {
+			break
+		}
+		if TCP_RESPONSE(body[0]) == LOBBY_EVENT && strings.Contains(string(body), "created") {
+			created++
+			c.conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		}
+	}
+	if created != 1 {
+		t.Errorf("got %d events for the created lobby, want 1", created)
+	}
+}
@@ -0,0 +1,250 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Config describes how a server serves TLS.
+type Config struct {
+	// CertFile and KeyFile hold the PEM encoded certificate chain and
+	// private key of the server. They are reloaded when they change.
+	CertFile string
+	KeyFile  string
+
+	// ClientCAFile holds the PEM encoded certificates of the authorities
+	// that sign the certificates of trusted clients, such as game servers.
+	// Clients presenting a certificate signed by one of them are identified
+	// by its common name. Empty disables client certificates.
+	ClientCAFile string
+
+	// RequireClientCert refuses clients without a valid certificate, rather
+	// than treating them as untrusted.
+	RequireClientCert bool
+}
+
+// Enabled reports whether the config has a certificate to serve.
+func (c Config) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// Load builds a tls.Config from the config. The certificate is reloaded
+// from its files when they change until ctx is done.
+func (c Config) Load(ctx context.Context, logger *slog.Logger) (*tls.Config, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, errors.New("tls needs both a certificate and a key file")
+	}
+
+	reloader, err := NewCertReloader(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	reloader.Logger = logger
+	go reloader.Watch(ctx)
+
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if c.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", c.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if c.RequireClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if c.RequireClientCert {
+		return nil, errors.New("requiring client certificates needs a client CA file")
+	}
+
+	return config, nil
+}
+
+// CertReloader serves a certificate loaded from files, and loads it again
+// when the files change, so that certificates can be renewed without a
+// restart.
+type CertReloader struct {
+	// Interval is how often the files are checked for changes.
+	//
+	// Defaults to 10 seconds.
+	Interval time.Duration
+
+	// Logger controls where logs are sent.
+	// Defaults to slog.Default().
+	Logger *slog.Logger
+
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	modTime  time.Time
+	mu       sync.RWMutex
+}
+
+// NewCertReloader constructs a CertReloader with the defaults, loading the
+// certificate right away.
+func NewCertReloader(certFile string, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{
+		Interval: time.Second * 10,
+		Logger:   slog.Default(),
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	_, err := r.reload()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// Watch checks the files for changes every Interval until ctx is done.
+// Certificates that fail to load are logged and the previous one is kept.
+func (r *CertReloader) Watch(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := r.reload()
+		if err != nil {
+			r.Logger.Error("failed to reload certificate", slog.String("cert_file", r.certFile), slog.Any("error", err))
+			continue
+		}
+		if reloaded {
+			r.Logger.Info("reloaded certificate", slog.String("cert_file", r.certFile))
+		}
+	}
+}
+
+// reload loads the certificate if either file changed since it was last
+// loaded, reporting whether it did.
+func (r *CertReloader) reload() (bool, error) {
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	unchanged := r.cert != nil && modTime.Equal(r.modTime)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert = &cert
+	r.modTime = modTime
+	return true, nil
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// ClientConfig describes how a client connects over TLS.
+type ClientConfig struct {
+	// CAFile holds the PEM encoded certificates of the authorities to trust
+	// in addition to those of the system, such as a self-signed server
+	// certificate.
+	CAFile string
+
+	// CertFile and KeyFile hold the certificate a trusted client identifies
+	// itself with, empty for untrusted clients.
+	CertFile string
+	KeyFile  string
+
+	// ServerName overrides the name the certificate of the server is
+	// verified against, which defaults to the host dialed.
+	ServerName string
+
+	// InsecureSkipVerify accepts any certificate from the server. It is
+	// only meant for testing.
+	InsecureSkipVerify bool
+}
+
+// Load builds a tls.Config for dialing from the config.
+func (c ClientConfig) Load() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", c.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// PeerIdentity returns the common name of the verified certificate the
+// client presented, empty for clients without one.
+func PeerIdentity(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return state.VerifiedChains[0][0].Subject.CommonName
+}
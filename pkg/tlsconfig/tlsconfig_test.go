@@ -0,0 +1,268 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// issued is a certificate and key written to PEM files.
+type issued struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// issue writes a certificate for commonName signed by parent, or a
+// self-signed authority when parent is nil.
+func issue(t *testing.T, commonName string, parent *issued) issued {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	i := issued{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, "cert.pem"),
+		keyFile:  filepath.Join(dir, "key.pem"),
+	}
+	writePEM(t, i.certFile, "CERTIFICATE", der)
+	writePEM(t, i.keyFile, "EC PRIVATE KEY", keyDer)
+	return i
+}
+
+func writePEM(t *testing.T, file string, typ string, der []byte) {
+	t.Helper()
+
+	err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// handshake connects a client with clientConfig to a server with
+// serverConfig, returning the identity the server saw and the error of
+// the client.
+func handshake(t *testing.T, serverConfig *tls.Config, clientConfig *tls.Config) (string, error) {
+	t.Helper()
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	identity := make(chan string, 1)
+	go func() {
+		server := tls.Server(serverConn, serverConfig)
+		err := server.Handshake()
+		if err != nil {
+			identity <- ""
+			serverConn.Close()
+			return
+		}
+		state := server.ConnectionState()
+		identity <- PeerIdentity(&state)
+		// Complete the handshake for TLS 1.3 clients, which only learn that
+		// their certificate was refused on their first read.
+		server.Write([]byte{0})
+	}()
+
+	client := tls.Client(clientConn, clientConfig)
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	err := client.Handshake()
+	if err == nil {
+		_, err = client.Read(make([]byte, 1))
+	}
+	return <-identity, err
+}
+
+func TestClientsAreIdentifiedByTheirCertificate(t *testing.T) {
+	ca := issue(t, "test ca", nil)
+	server := issue(t, "masterserver", &ca)
+	gameServer := issue(t, "game-server-1", &ca)
+
+	serverConfig, err := Config{
+		CertFile:     server.certFile,
+		KeyFile:      server.keyFile,
+		ClientCAFile: ca.certFile,
+	}.Load(context.Background(), slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trusted, err := ClientConfig{
+		CAFile:     ca.certFile,
+		CertFile:   gameServer.certFile,
+		KeyFile:    gameServer.keyFile,
+		ServerName: "masterserver",
+	}.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := handshake(t, serverConfig, trusted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity != "game-server-1" {
+		t.Errorf("identified as %q, want game-server-1", identity)
+	}
+
+	untrusted, err := ClientConfig{CAFile: ca.certFile, ServerName: "masterserver"}.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err = handshake(t, serverConfig, untrusted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity != "" {
+		t.Errorf("client without certificate identified as %q", identity)
+	}
+}
+
+func TestCertificatesOfOtherAuthoritiesAreRefused(t *testing.T) {
+	ca := issue(t, "test ca", nil)
+	other := issue(t, "other ca", nil)
+	server := issue(t, "masterserver", &ca)
+	impostor := issue(t, "game-server-1", &other)
+
+	serverConfig, err := Config{
+		CertFile:          server.certFile,
+		KeyFile:           server.keyFile,
+		ClientCAFile:      ca.certFile,
+		RequireClientCert: true,
+	}.Load(context.Background(), slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientConfig, err := ClientConfig{
+		CAFile:     ca.certFile,
+		CertFile:   impostor.certFile,
+		KeyFile:    impostor.keyFile,
+		ServerName: "masterserver",
+	}.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := handshake(t, serverConfig, clientConfig)
+	if err == nil || identity != "" {
+		t.Errorf("client of another authority accepted as %q", identity)
+	}
+
+	withoutCert, err := ClientConfig{CAFile: ca.certFile, ServerName: "masterserver"}.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = handshake(t, serverConfig, withoutCert)
+	if err == nil {
+		t.Error("client without certificate accepted when one is required")
+	}
+}
+
+func TestCertReloaderLoadsRenewedCertificates(t *testing.T) {
+	ca := issue(t, "test ca", nil)
+	first := issue(t, "masterserver", &ca)
+
+	reloader, err := NewCertReloader(first.certFile, first.keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renewed := issue(t, "masterserver", &ca)
+	replace(t, first.certFile, renewed.certFile)
+	replace(t, first.keyFile, renewed.keyFile)
+
+	reloaded, err := reloader.reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded {
+		t.Fatal("renewed certificate not reloaded")
+	}
+	cert, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.SerialNumber.Cmp(renewed.cert.SerialNumber) != 0 {
+		t.Error("still serving the first certificate")
+	}
+
+	reloaded, err = reloader.reload()
+	if err != nil || reloaded {
+		t.Errorf("unchanged files reloaded: %v, %v", reloaded, err)
+	}
+}
+
+// replace overwrites file with the contents of from, and dates it later so
+// that the change is seen whatever the resolution of modification times.
+func replace(t *testing.T, file string, from string) {
+	t.Helper()
+
+	data, err := os.ReadFile(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(file, data, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	err = os.Chtimes(file, later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+}